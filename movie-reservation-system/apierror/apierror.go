@@ -0,0 +1,151 @@
+package apierror
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable error codes. Clients should branch on the code, the
+// message is meant for people.
+const (
+	CODE_INVALID_REQUEST   = "invalid_request"
+	CODE_VALIDATION_FAILED = "validation_failed"
+	CODE_UNAUTHORIZED      = "unauthorized"
+	CODE_FORBIDDEN         = "forbidden"
+	CODE_NOT_FOUND         = "not_found"
+	CODE_CONFLICT          = "conflict"
+	CODE_GONE              = "gone"
+	CODE_PAYMENT_REQUIRED  = "payment_required"
+	CODE_UNPROCESSABLE     = "unprocessable"
+	CODE_INTERNAL          = "internal_error"
+	CODE_BAD_GATEWAY       = "bad_gateway"
+	CODE_UNAVAILABLE       = "service_unavailable"
+	CODE_TOO_MANY_REQUESTS = "too_many_requests"
+)
+
+// Error is an error meant for API clients. It is rendered as
+// {"error": {"code": ..., "message": ..., "fields": ..., "details": ...}} by
+// the error middleware. Fields maps the invalid request fields to what is
+// wrong with them and Details carries extra data for the client. The cause,
+// if any, is logged and never rendered.
+type Error struct {
+	Status  int               `json:"-"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Details interface{}       `json:"details,omitempty"`
+	cause   error
+}
+
+func New(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CODE_INVALID_REQUEST, message)
+}
+
+// Invalid reports a request that breaks a rule spanning several fields, or
+// one described well enough by message alone.
+func Invalid(message string) *Error {
+	return New(http.StatusBadRequest, CODE_VALIDATION_FAILED, message)
+}
+
+// InvalidField reports a single invalid field.
+func InvalidField(field string, message string) *Error {
+	return Validation(map[string]string{field: message})
+}
+
+func Validation(fields map[string]string) *Error {
+	err := New(http.StatusBadRequest, CODE_VALIDATION_FAILED, "request validation failed")
+	err.Fields = fields
+	return err
+}
+
+func Unauthorized() *Error {
+	return New(http.StatusUnauthorized, CODE_UNAUTHORIZED, "unauthorized")
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CODE_FORBIDDEN, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CODE_NOT_FOUND, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CODE_CONFLICT, message)
+}
+
+func Gone(message string) *Error {
+	return New(http.StatusGone, CODE_GONE, message)
+}
+
+func PaymentRequired(message string) *Error {
+	return New(http.StatusPaymentRequired, CODE_PAYMENT_REQUIRED, message)
+}
+
+func Unprocessable(message string) *Error {
+	return New(http.StatusUnprocessableEntity, CODE_UNPROCESSABLE, message)
+}
+
+func TooManyRequests(message string) *Error {
+	return New(http.StatusTooManyRequests, CODE_TOO_MANY_REQUESTS, message)
+}
+
+func BadGateway(message string, cause error) *Error {
+	err := New(http.StatusBadGateway, CODE_BAD_GATEWAY, message)
+	err.cause = cause
+	return err
+}
+
+func Unavailable(message string, cause error) *Error {
+	err := New(http.StatusServiceUnavailable, CODE_UNAVAILABLE, message)
+	err.cause = cause
+	return err
+}
+
+// Internal hides cause, which may carry SQL or other details, behind a
+// generic message.
+func Internal(cause error) *Error {
+	err := New(http.StatusInternalServerError, CODE_INTERNAL, "an error occurred")
+	err.cause = cause
+	return err
+}
+
+// From returns err as an API error. Errors that are not API errors are
+// internal errors.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	return Internal(err)
+}
+
+// Abort records err for the error middleware and stops the handler chain.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
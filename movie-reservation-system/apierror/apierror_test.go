@@ -0,0 +1,113 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type testBody struct {
+	Name  string `json:"name" binding:"required"`
+	Seats []int  `json:"seats" binding:"max=2"`
+}
+
+type envelope struct {
+	Error Error `json:"error"`
+}
+
+func newTestRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(Middleware())
+	router.POST("/things/:id", func(c *gin.Context) {
+		if _, err := IDParam(c, "id", "thing"); err != nil {
+			Abort(c, err)
+			return
+		}
+
+		var body testBody
+		if err := BindJSON(c, &body); err != nil {
+			Abort(c, err)
+			return
+		}
+
+		switch body.Name {
+		case "sql":
+			Abort(c, errors.New(`pq: relation "things" does not exist`))
+		case "missing":
+			Abort(c, NotFound("thing not found"))
+		case "panic":
+			panic("boom")
+		default:
+			c.JSON(http.StatusOK, body)
+		}
+	})
+	return router
+}
+
+func send(path string, body string) (*httptest.ResponseRecorder, envelope) {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(res, req)
+
+	var parsed envelope
+	json.Unmarshal(res.Body.Bytes(), &parsed)
+	return res, parsed
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	cases := []struct {
+		path   string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{"/things/abc", `{"name":"a"}`, http.StatusBadRequest, CODE_INVALID_REQUEST, ""},
+		{"/things/0", `{"name":"a"}`, http.StatusBadRequest, CODE_INVALID_REQUEST, ""},
+		{"/things/1", `{"name":`, http.StatusBadRequest, CODE_INVALID_REQUEST, ""},
+		{"/things/1", ``, http.StatusBadRequest, CODE_INVALID_REQUEST, ""},
+		{"/things/1", `{}`, http.StatusBadRequest, CODE_VALIDATION_FAILED, "name"},
+		{"/things/1", `{"name":"a","seats":[1,2,3]}`, http.StatusBadRequest, CODE_VALIDATION_FAILED, "seats"},
+		{"/things/1", `{"name":1}`, http.StatusBadRequest, CODE_VALIDATION_FAILED, "name"},
+		{"/things/1", `{"name":"missing"}`, http.StatusNotFound, CODE_NOT_FOUND, ""},
+		{"/things/1", `{"name":"sql"}`, http.StatusInternalServerError, CODE_INTERNAL, ""},
+		{"/things/1", `{"name":"panic"}`, http.StatusInternalServerError, CODE_INTERNAL, ""},
+	}
+
+	for _, tc := range cases {
+		res, body := send(tc.path, tc.body)
+		if res.Code != tc.status || body.Error.Code != tc.code || body.Error.Message == "" {
+			t.Errorf("%s %s: expected %d %s, got %d: %s", tc.path, tc.body, tc.status, tc.code, res.Code, res.Body)
+			continue
+		}
+
+		if tc.field != "" && body.Error.Fields[tc.field] == "" {
+			t.Errorf("%s %s: expected %s to be reported, got %s", tc.path, tc.body, tc.field, res.Body)
+		}
+
+		if strings.Contains(res.Body.String(), "pq:") || strings.Contains(res.Body.String(), "boom") {
+			t.Errorf("%s %s: internal details leaked: %s", tc.path, tc.body, res.Body)
+		}
+	}
+}
+
+func TestFromWrappedErrors(t *testing.T) {
+	err := From(errors.Join(errors.New("context"), Conflict("taken")))
+	if err.Status != http.StatusConflict || err.Code != CODE_CONFLICT {
+		t.Fatalf("expected the wrapped conflict, got %+v", err)
+	}
+
+	if err := From(errors.New("boom")); err.Status != http.StatusInternalServerError || err.Message == "boom" {
+		t.Fatalf("expected a generic internal error, got %+v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// BindJSON decodes the request body into obj and checks its binding tags.
+// Decoding and validation failures are returned as API errors naming the
+// offending JSON fields.
+func BindJSON(c *gin.Context, obj interface{}) error {
+	return bindingError(obj, c.ShouldBindJSON(obj))
+}
+
+// Bind is BindJSON for routes that also accept forms.
+func Bind(c *gin.Context, obj interface{}) error {
+	return bindingError(obj, c.ShouldBind(obj))
+}
+
+func bindingError(obj interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := make(map[string]string)
+		for _, fieldError := range validationErrors {
+			fields[jsonName(obj, fieldError.StructField())] = describe(fieldError)
+		}
+		return Validation(fields)
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		return InvalidField(typeError.Field, "must be a "+typeError.Type.String())
+	}
+
+	if errors.Is(err, io.EOF) {
+		return BadRequest("request body is required")
+	}
+
+	return BadRequest("invalid json")
+}
+
+// IDParam reads a positive numeric path parameter. what names the resource
+// in the error, like "movie", and may be empty.
+func IDParam(c *gin.Context, name string, what string) (int, error) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id < 1 {
+		return 0, BadRequest(strings.TrimSpace(fmt.Sprintf("invalid %s id", what)))
+	}
+
+	return id, nil
+}
+
+// jsonName returns the JSON name of a top level field of obj.
+func jsonName(obj interface{}, field string) string {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() == reflect.Struct {
+		if structField, ok := t.FieldByName(field); ok {
+			name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+	}
+
+	return strings.ToLower(field)
+}
+
+func describe(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fieldError.Kind() == reflect.Slice {
+			return "must have at least " + fieldError.Param() + " items"
+		}
+		if fieldError.Kind() == reflect.String {
+			return "must be at least " + fieldError.Param() + " characters"
+		}
+		return "must be at least " + fieldError.Param()
+	case "max":
+		if fieldError.Kind() == reflect.Slice {
+			return "must have at most " + fieldError.Param() + " items"
+		}
+		if fieldError.Kind() == reflect.String {
+			return "must be at most " + fieldError.Param() + " characters"
+		}
+		return "must be at most " + fieldError.Param()
+	case "email":
+		return "must be a valid email"
+	case "oneof":
+		return "must be one of " + fieldError.Param()
+	}
+
+	return "is invalid"
+}
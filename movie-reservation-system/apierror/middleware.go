@@ -0,0 +1,44 @@
+package apierror
+
+import (
+	"fmt"
+	"movie-reservation-system/logging"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware renders the last error recorded by a handler, or by another
+// middleware, as the JSON error envelope. Internal errors are logged and
+// replaced by a generic message. Panics are rendered as internal errors too.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err, ok := recovered.(error); ok && err == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				Abort(c, fmt.Errorf("panic: %v", recovered))
+				Render(c)
+			}
+		}()
+
+		c.Next()
+		Render(c)
+	}
+}
+
+// Render writes the last recorded error unless a response was written
+// already.
+func Render(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	err := From(c.Errors.Last().Err)
+	if err.Status >= http.StatusInternalServerError {
+		logging.FromContext(c.Request.Context()).Error("request failed", "method", c.Request.Method, "path", c.Request.URL.Path, "error", c.Errors.Last().Err)
+	}
+
+	c.JSON(err.Status, gin.H{"error": err})
+}
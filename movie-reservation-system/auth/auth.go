@@ -1,38 +1,148 @@
 package auth
 
 import (
-	"fmt"
+	"movie-reservation-system/apierror"
 	"movie-reservation-system/hashing"
+	"movie-reservation-system/ratelimit"
 	"movie-reservation-system/users"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-func HandleLogin(c *gin.Context) {
-	email := c.Request.FormValue("email")
-	password := c.Request.FormValue("password")
+type Handler struct {
+	users         users.UserRepository
+	refreshTokens RefreshTokenRepository
+	lockout       *ratelimit.Lockout
+}
+
+func NewHandler(users users.UserRepository, refreshTokens RefreshTokenRepository, lockout *ratelimit.Lockout) *Handler {
+	return &Handler{users: users, refreshTokens: refreshTokens, lockout: lockout}
+}
+
+type LoginBody struct {
+	Email    string `json:"email" form:"email" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+func invalidCredentials() *apierror.Error {
+	return apierror.New(http.StatusUnauthorized, apierror.CODE_UNAUTHORIZED, "invalid credentials")
+}
+
+// HandleLogin answers unknown emails and wrong passwords the same way, in
+// the same time, and counts both against the account lockout.
+func (h *Handler) HandleLogin(c *gin.Context) {
+	var body LoginBody
+	if err := apierror.Bind(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
 
-	user := users.FindUserByEmail(email)
-	fmt.Println(user, email)
+	email := users.NormalizeEmail(body.Email)
+	locked, err := h.lockout.Locked(email)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	if locked > 0 {
+		ratelimit.Abort(c, "too many failed logins, try again later", locked)
+		return
+	}
 
-	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	user, err := h.users.FindByEmail(email)
+	if err != nil && err != users.ErrUserNotFound {
+		apierror.Abort(c, err)
 		return
 	}
 
-	if !hashing.ComparePasswords(user.Password, password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	hash := ""
+	if user != nil {
+		hash = user.Password
+	}
+
+	if !comparePassword(hash, body.Password) {
+		if _, err := h.lockout.Fail(email); err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+		apierror.Abort(c, invalidCredentials())
+		return
+	}
 
+	if err := h.lockout.Succeed(email); err != nil {
+		apierror.Abort(c, err)
 		return
 	}
 
-	token, err := SignToken(user.ID, user.Role)
+	tokens, err := h.IssueTokens(user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		apierror.Abort(c, err)
 		return
 	}
 
 	welcomeMessage := "Welcome, " + user.Name
-	c.JSON(http.StatusOK, gin.H{"message": welcomeMessage, "token": token})
+	c.JSON(http.StatusOK, gin.H{
+		"message":       welcomeMessage,
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+type RegisterBody struct {
+	users.ProfileBody
+	Password string `json:"password" form:"password"`
+}
+
+func (h *Handler) HandleRegister(c *gin.Context) {
+	var body RegisterBody
+	if err := apierror.Bind(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if err := users.ValidateProfile(&body.ProfileBody); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if err := users.ValidatePassword(body.Password); err != nil {
+		apierror.Abort(c, apierror.InvalidField("password", err.Error()))
+		return
+	}
+
+	hash, err := hashing.HashPassword(body.Password)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	user := &users.User{
+		Name:      body.Name,
+		Birthdate: body.Birthdate,
+		Email:     body.Email,
+		Password:  hash,
+	}
+	err = h.users.Create(user)
+	if err == users.ErrEmailTaken {
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	tokens, err := h.IssueTokens(user)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"user":          user.Profile(),
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
 }
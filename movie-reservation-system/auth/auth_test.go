@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/hashing"
+	"movie-reservation-system/ratelimit"
+	"movie-reservation-system/users"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testSettings = Settings{Secret: "test-secret", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	if err := Configure(testSettings); err != nil {
+		panic(err)
+	}
+}
+
+func newTestRouter(t *testing.T, accountLimit int) (*gin.Engine, *ratelimit.Lockout) {
+	repo := users.NewMemoryRepository()
+	hash, err := hashing.HashPassword("nostromo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Create(&users.User{Name: "Ripley", Birthdate: "1979-05-25", Email: "ripley@example.com", Password: hash})
+
+	store := ratelimit.NewMemoryStore()
+	lockout := NewLoginLockout(store)
+	handler := NewHandler(repo, NewMemoryRepository(), lockout)
+	byAccount := ratelimit.NewLimiter(store, "login-account:", accountLimit, time.Minute)
+
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.POST("/auth/login", ratelimit.Middleware(byAccount, LoginEmail), handler.HandleLogin)
+	router.POST("/auth/refresh", handler.HandleRefresh)
+	return router, lockout
+}
+
+func post(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func login(router *gin.Engine, email string, password string) *httptest.ResponseRecorder {
+	return post(router, "/auth/login", LoginBody{Email: email, Password: password})
+}
+
+func TestLoginFailuresLookAlike(t *testing.T) {
+	router, _ := newTestRouter(t, 100)
+
+	unknown := login(router, "nobody@example.com", "nostromo1")
+	wrong := login(router, "ripley@example.com", "wrong-password")
+
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for both, got %d and %d", unknown.Code, wrong.Code)
+	}
+	if unknown.Body.String() != wrong.Body.String() {
+		t.Fatalf("expected the same body, got %s and %s", unknown.Body, wrong.Body)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	router, lockout := newTestRouter(t, 100)
+
+	for i := 0; i < LOGIN_FAILURE_THRESHOLD; i++ {
+		if res := login(router, "Ripley@example.com", "wrong-password"); res.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, res.Code)
+		}
+	}
+
+	res := login(router, "ripley@example.com", "nostromo1")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a locked account even with the right password, got %d", res.Code)
+	}
+
+	// Unknown accounts lock the same way so lockouts do not reveal which
+	// emails are registered.
+	for i := 0; i < LOGIN_FAILURE_THRESHOLD; i++ {
+		login(router, "nobody@example.com", "wrong-password")
+	}
+	if locked, _ := lockout.Locked("nobody@example.com"); locked <= 0 {
+		t.Fatal("expected the unknown account to be locked too")
+	}
+}
+
+func TestLoginAccountRateLimit(t *testing.T) {
+	router, _ := newTestRouter(t, 2)
+
+	login(router, "newt@example.com", "a")
+	login(router, "newt@example.com", "b")
+
+	res := login(router, "newt@example.com", "c")
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 past the account limit, got %d", res.Code)
+	}
+
+	if res := login(router, "burke@example.com", "c"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected other accounts to be unaffected, got %d", res.Code)
+	}
+}
+
+func TestLoginSucceeds(t *testing.T) {
+	router, lockout := newTestRouter(t, 100)
+
+	for i := 0; i < LOGIN_FAILURE_THRESHOLD-1; i++ {
+		login(router, "ripley@example.com", "wrong-password")
+	}
+
+	res := login(router, "Ripley@example.com", "nostromo1")
+	var tokens Tokens
+	json.Unmarshal(res.Body.Bytes(), &tokens)
+	if res.Code != http.StatusOK || tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("expected tokens, got %d: %s", res.Code, res.Body)
+	}
+
+	// The failures before a successful login are forgotten.
+	for i := 0; i < LOGIN_FAILURE_THRESHOLD-1; i++ {
+		login(router, "ripley@example.com", "wrong-password")
+	}
+	if locked, _ := lockout.Locked("ripley@example.com"); locked > 0 {
+		t.Fatal("expected the successful login to reset the lockout")
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	router, _ := newTestRouter(t, 100)
+
+	var first Tokens
+	json.Unmarshal(login(router, "ripley@example.com", "nostromo1").Body.Bytes(), &first)
+
+	res := post(router, "/auth/refresh", RefreshBody{RefreshToken: first.RefreshToken})
+	var second Tokens
+	json.Unmarshal(res.Body.Bytes(), &second)
+	if res.Code != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected a new refresh token, got %d: %s", res.Code, res.Body)
+	}
+
+	// Reusing a rotated token revokes the whole family.
+	if res := post(router, "/auth/refresh", RefreshBody{RefreshToken: first.RefreshToken}); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a reused token, got %d", res.Code)
+	}
+	if res := post(router, "/auth/refresh", RefreshBody{RefreshToken: second.RefreshToken}); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the newer token to be revoked too, got %d", res.Code)
+	}
+}
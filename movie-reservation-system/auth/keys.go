@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+const HMAC_KEY_ID = "hs256"
+
+// SigningKey is one entry of the key set. Public is what verifies tokens; it
+// is the shared secret for HMAC keys. Private is nil for keys that are only
+// kept around to verify tokens signed before a rotation.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+type KeySet struct {
+	Active *SigningKey
+	Keys   map[string]*SigningKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// Settings are the token settings of the configuration.
+type Settings struct {
+	// Secret signs tokens with HS256 when KeysDir is not set.
+	Secret          string
+	KeysDir         string
+	SigningKid      string
+	Audience        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+var (
+	settings = Settings{Audience: DEFAULT_AUDIENCE, AccessTokenTTL: DEFAULT_ACCESS_TOKEN_TTL, RefreshTokenTTL: DEFAULT_REFRESH_TOKEN_TTL}
+	keySet   *KeySet
+)
+
+// Configure applies the token settings and loads the key set. It must run
+// before tokens are signed or verified. When KeysDir is set, every
+// "<kid>.pem" file in it is loaded: RSA keys sign with RS256 and Ed25519 keys
+// with EdDSA. Private keys can sign and verify, public keys only verify.
+// SigningKid picks the key that signs new tokens; it may be omitted when the
+// directory holds a single private key. Without KeysDir tokens are signed
+// with HS256 using Secret.
+func Configure(s Settings) error {
+	set, err := loadKeySet(s.KeysDir, s.SigningKid, s.Secret)
+	if err != nil {
+		return err
+	}
+
+	if s.Audience == "" {
+		s.Audience = DEFAULT_AUDIENCE
+	}
+	if s.AccessTokenTTL <= 0 {
+		s.AccessTokenTTL = DEFAULT_ACCESS_TOKEN_TTL
+	}
+	if s.RefreshTokenTTL <= 0 {
+		s.RefreshTokenTTL = DEFAULT_REFRESH_TOKEN_TTL
+	}
+
+	settings = s
+	keySet = set
+	return nil
+}
+
+func keys() (*KeySet, error) {
+	if keySet == nil {
+		return nil, fmt.Errorf("signing keys are not configured")
+	}
+
+	return keySet, nil
+}
+
+func loadKeySet(dir string, activeKid string, secret string) (*KeySet, error) {
+	set := &KeySet{Keys: make(map[string]*SigningKey)}
+
+	if dir == "" {
+		if secret == "" {
+			return nil, fmt.Errorf("a secret is required when no keys directory is set")
+		}
+
+		set.Active = &SigningKey{
+			ID:      HMAC_KEY_ID,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(secret),
+			Public:  []byte(secret),
+		}
+		set.Keys[HMAC_KEY_ID] = set.Active
+		return set, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []string
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		set.Keys[kid] = key
+		if key.Private != nil {
+			signers = append(signers, kid)
+		}
+	}
+
+	if activeKid == "" && len(signers) == 1 {
+		activeKid = signers[0]
+	}
+
+	active, ok := set.Keys[activeKid]
+	if !ok || active.Private == nil {
+		return nil, fmt.Errorf("no private key for signing kid %q in %s", activeKid, dir)
+	}
+	set.Active = active
+
+	return set, nil
+}
+
+func parseKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("not a PEM file")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Private: key, Public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Public: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: key, Public: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Public: key}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %T, only RSA and Ed25519 are supported", parsed)
+}
+
+// keyFunc resolves the verification key from the token kid and refuses
+// tokens whose alg does not match that key, so an RSA public key can never be
+// used as an HMAC secret.
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	set, err := keys()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := set.Keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+func encodeBase64Url(bytes []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func (k *SigningKey) JWK() (JWK, bool) {
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			N:   encodeBase64Url(public.N.Bytes()),
+			E:   encodeBase64Url(big.NewInt(int64(public.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			Crv: "Ed25519",
+			X:   encodeBase64Url(public),
+		}, true
+	}
+
+	// HMAC secrets are never published.
+	return JWK{}, false
+}
+
+// HandleJWKS publishes the public half of every asymmetric key, including
+// verify-only keys, so other services can check our tokens.
+func HandleJWKS(c *gin.Context) {
+	set, err := keys()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	jwks := []JWK{}
+	for _, key := range set.Keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks = append(jwks, jwk)
+		}
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": jwks})
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ed25519: edKey}
+}
+
+func writePEM(t *testing.T, dir string, kid string, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePKIX(t *testing.T, dir string, kid string, public interface{}) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PUBLIC KEY", der)
+}
+
+func writePKCS8(t *testing.T, dir string, kid string, private interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PRIVATE KEY", der)
+}
+
+// useKeys configures the key set of dir for the rest of the test.
+func useKeys(t *testing.T, dir string, signingKid string) {
+	t.Cleanup(func() {
+		if err := Configure(testSettings); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	settings := testSettings
+	settings.Secret = ""
+	settings.KeysDir = dir
+	settings.SigningKid = signingKid
+	if err := Configure(settings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	generated := newTestKeys(t)
+
+	cases := []struct {
+		kid   string
+		write func(dir string)
+		alg   string
+	}{
+		{"rsa-2026", func(dir string) {
+			writePEM(t, dir, "rsa-2026", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(generated.rsa))
+		}, "RS256"},
+		{"ed-2026", func(dir string) { writePKCS8(t, dir, "ed-2026", generated.ed25519) }, "EdDSA"},
+	}
+
+	for _, tc := range cases {
+		dir := t.TempDir()
+		tc.write(dir)
+		useKeys(t, dir, "")
+
+		signed, err := SignToken(1, "user")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.kid, err)
+		}
+
+		token, err := validate(signed)
+		if err != nil {
+			t.Fatalf("%s: expected the token to verify, got %v", tc.kid, err)
+		}
+		if token.Header["alg"] != tc.alg || token.Header["kid"] != tc.kid {
+			t.Fatalf("%s: unexpected header %v", tc.kid, token.Header)
+		}
+	}
+}
+
+func TestRetiredKeyStillVerifies(t *testing.T) {
+	generated := newTestKeys(t)
+
+	before := t.TempDir()
+	writePEM(t, before, "rsa-2026", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(generated.rsa))
+	useKeys(t, before, "")
+	old, err := SignToken(1, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the rotation the RSA key is only kept to verify older tokens.
+	after := t.TempDir()
+	writePKCS8(t, after, "ed-2027", generated.ed25519)
+	writePKIX(t, after, "rsa-2026", &generated.rsa.PublicKey)
+	useKeys(t, after, "ed-2027")
+
+	if _, err := validate(old); err != nil {
+		t.Fatalf("expected a token of the retired key to verify, got %v", err)
+	}
+
+	signed, err := SignToken(1, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := validate(signed)
+	if err != nil || token.Header["kid"] != "ed-2027" {
+		t.Fatalf("expected new tokens to be signed by the active key, got %v: %v", token, err)
+	}
+
+	// A token naming a kid the set does not hold is refused, even when its
+	// signature is good.
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, token.Claims)
+	forged.Header["kid"] = "ed-2025"
+	unknown, err := forged.SignedString(generated.ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validate(unknown); err == nil {
+		t.Fatal("expected an unknown kid to be rejected")
+	}
+
+	// Nor can a verify-only RSA key be used as an HMAC secret.
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, token.Claims)
+	confused.Header["kid"] = "rsa-2026"
+	der, _ := x509.MarshalPKIXPublicKey(&generated.rsa.PublicKey)
+	hmacSigned, err := confused.SignedString(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validate(hmacSigned); err == nil {
+		t.Fatal("expected a mismatched alg to be rejected")
+	}
+}
+
+func TestHandleJWKS(t *testing.T) {
+	generated := newTestKeys(t)
+	dir := t.TempDir()
+	writePEM(t, dir, "rsa-2026", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(generated.rsa))
+	writePKIX(t, dir, "ed-2025", generated.ed25519.Public())
+	useKeys(t, dir, "rsa-2026")
+
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", HandleJWKS)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	encode := base64.RawURLEncoding.EncodeToString
+	expected := fmt.Sprintf(
+		`{"keys":[{"kty":"OKP","kid":"ed-2025","use":"sig","alg":"EdDSA","crv":"Ed25519","x":"%s"},{"kty":"RSA","kid":"rsa-2026","use":"sig","alg":"RS256","n":"%s","e":"AQAB"}]}`,
+		encode(generated.ed25519.Public().(ed25519.PublicKey)),
+		encode(generated.rsa.N.Bytes()),
+	)
+	if res.Code != http.StatusOK || res.Body.String() != expected {
+		t.Fatalf("unexpected JWKS %d:\n%s\nexpected:\n%s", res.Code, res.Body, expected)
+	}
+	if res.Header().Get("Cache-Control") == "" {
+		t.Fatal("expected the JWKS to be cacheable")
+	}
+}
+
+func TestHandleJWKSHidesSecrets(t *testing.T) {
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", HandleJWKS)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	if res.Body.String() != `{"keys":[]}` {
+		t.Fatalf("expected no key to be published for HS256, got %s", res.Body)
+	}
+}
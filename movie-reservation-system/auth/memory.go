@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryRefreshToken struct {
+	RefreshToken
+	Revoked bool
+}
+
+// MemoryRepository keeps refresh tokens in memory. It is meant for tests and
+// local experiments, not for production.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	tokens map[string]*memoryRefreshToken
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{tokens: make(map[string]*memoryRefreshToken)}
+}
+
+func (r *MemoryRepository) Create(token RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens[token.TokenHash] = &memoryRefreshToken{RefreshToken: token}
+	return nil
+}
+
+func (r *MemoryRepository) Rotate(tokenHash string, next func(userId int) (RefreshToken, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tokens[tokenHash]
+	if !ok {
+		return ErrInvalidRefreshToken
+	}
+
+	if stored.Revoked {
+		r.revokeUser(stored.UserID)
+		return ErrInvalidRefreshToken
+	}
+
+	if stored.ExpiresAt.Before(time.Now()) {
+		return ErrInvalidRefreshToken
+	}
+
+	token, err := next(stored.UserID)
+	if err != nil {
+		return err
+	}
+
+	stored.Revoked = true
+	r.tokens[token.TokenHash] = &memoryRefreshToken{RefreshToken: token}
+	return nil
+}
+
+func (r *MemoryRepository) Revoke(tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tokens[tokenHash]
+	if !ok || stored.Revoked {
+		return ErrInvalidRefreshToken
+	}
+
+	stored.Revoked = true
+	return nil
+}
+
+func (r *MemoryRepository) revokeUser(userId int) {
+	for _, stored := range r.tokens {
+		if stored.UserID == userId {
+			stored.Revoked = true
+		}
+	}
+}
+
+func (r *MemoryRepository) RevokeUser(userId int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokeUser(userId)
+	return nil
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"database/sql"
+	"movie-reservation-system/database"
+	"time"
+)
+
+type PostgresRepository struct {
+	db *database.DB
+}
+
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func createRefreshToken(tx *sql.Tx, token RefreshToken) error {
+	_, err := tx.Exec(`
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, token.UserID, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+func (r *PostgresRepository) Create(token RefreshToken) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	if err := createRefreshToken(tx, token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) Rotate(tokenHash string, next func(userId int) (RefreshToken, error)) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var id, userId int
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, user_id, expires_at, revoked_at FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, tokenHash).Scan(&id, &userId, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if revokedAt.Valid {
+		_, err = tx.Exec(`
+			UPDATE refresh_tokens SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL
+		`, userId)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			return err
+		}
+		return ErrInvalidRefreshToken
+	}
+
+	if expiresAt.Before(time.Now()) {
+		return ErrInvalidRefreshToken
+	}
+
+	token, err := next(userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if err := createRefreshToken(tx, token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) Revoke(tokenHash string) error {
+	res, err := r.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidRefreshToken
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) RevokeUser(userId int) error {
+	_, err := r.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userId)
+	return err
+}
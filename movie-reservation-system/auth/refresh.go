@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/users"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const DEFAULT_REFRESH_TOKEN_TTL = 30 * 24 * time.Hour
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+type Tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshBody struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token" binding:"required"`
+}
+
+func RefreshTokenTTL() time.Duration {
+	return settings.RefreshTokenTTL
+}
+
+// Only a hash of each refresh token is stored, so a database leak does not
+// hand out usable tokens.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken returns a new refresh token of userId and the record to
+// store for it.
+func newRefreshToken(userId int) (string, RefreshToken, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", RefreshToken{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	return token, RefreshToken{
+		UserID:    userId,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+	}, nil
+}
+
+// newTokens signs an access token for user and creates a refresh token,
+// which is returned for the caller to store.
+func newTokens(user *users.User) (*Tokens, RefreshToken, error) {
+	token, err := SignToken(user.ID, user.Role)
+	if err != nil {
+		return nil, RefreshToken{}, err
+	}
+
+	refreshToken, stored, err := newRefreshToken(user.ID)
+	if err != nil {
+		return nil, RefreshToken{}, err
+	}
+
+	return &Tokens{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL().Seconds()),
+	}, stored, nil
+}
+
+// IssueTokens signs an access token and stores a new refresh token for user.
+func (h *Handler) IssueTokens(user *users.User) (*Tokens, error) {
+	tokens, stored, err := newTokens(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.refreshTokens.Create(stored); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RotateRefreshToken revokes the given refresh token and issues a new pair.
+// Presenting a token that was already revoked means it leaked, so every
+// refresh token of its user is revoked.
+func (h *Handler) RotateRefreshToken(refreshToken string) (*Tokens, error) {
+	var tokens *Tokens
+	err := h.refreshTokens.Rotate(hashRefreshToken(refreshToken), func(userId int) (RefreshToken, error) {
+		user, err := h.users.FindById(userId)
+		if err == users.ErrUserNotFound {
+			return RefreshToken{}, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return RefreshToken{}, err
+		}
+
+		var stored RefreshToken
+		tokens, stored, err = newTokens(user)
+		return stored, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func bindRefreshToken(c *gin.Context) (string, bool) {
+	var body RefreshBody
+	if err := apierror.Bind(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return "", false
+	}
+
+	return body.RefreshToken, true
+}
+
+func (h *Handler) HandleRefresh(c *gin.Context) {
+	refreshToken, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.RotateRefreshToken(refreshToken)
+	if err == ErrInvalidRefreshToken {
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CODE_UNAUTHORIZED, err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// HandleLogout revokes the refresh token in the body. Access tokens are short
+// lived and simply expire.
+func (h *Handler) HandleLogout(c *gin.Context) {
+	refreshToken, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+
+	err := h.refreshTokens.Revoke(hashRefreshToken(refreshToken))
+	if err == ErrInvalidRefreshToken {
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CODE_UNAUTHORIZED, err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// HandleLogoutAll revokes every refresh token of the authenticated user, e.g.
+// after a password change or a lost device.
+func (h *Handler) HandleLogoutAll(c *gin.Context) {
+	err := h.refreshTokens.RevokeUser(users.ExtractUserIdFromClaims(c))
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out of every session"})
+}
@@ -0,0 +1,25 @@
+package auth
+
+import "time"
+
+// RefreshToken is a stored refresh token. Only the hash of the token is
+// kept.
+type RefreshToken struct {
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// RefreshTokenRepository is the storage behind refresh tokens.
+type RefreshTokenRepository interface {
+	Create(token RefreshToken) error
+	// Rotate revokes the active token with tokenHash and stores the token
+	// returned by next for its user in the same transaction. Unknown and
+	// expired tokens return ErrInvalidRefreshToken. So does a token that was
+	// already revoked, which means it leaked: every token of its user is
+	// revoked. An error from next leaves the token untouched.
+	Rotate(tokenHash string, next func(userId int) (RefreshToken, error)) error
+	// Revoke returns ErrInvalidRefreshToken unless the token was active.
+	Revoke(tokenHash string) error
+	RevokeUser(userId int) error
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"movie-reservation-system/hashing"
+	"movie-reservation-system/ratelimit"
+	"movie-reservation-system/users"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Rate limits on POST /auth/login, per client address and per account.
+	LOGIN_IP_LIMIT      = 20
+	LOGIN_ACCOUNT_LIMIT = 10
+	LOGIN_LIMIT_WINDOW  = time.Minute
+
+	// After LOGIN_FAILURE_THRESHOLD failed logins within
+	// LOGIN_FAILURE_WINDOW the account is locked, for LOGIN_LOCKOUT_BASE at
+	// first and twice as long after every further failure.
+	LOGIN_FAILURE_THRESHOLD = 5
+	LOGIN_FAILURE_WINDOW    = 15 * time.Minute
+	LOGIN_LOCKOUT_BASE      = time.Minute
+	LOGIN_LOCKOUT_MAX       = time.Hour
+)
+
+// NewLoginLockout locks accounts after repeated failed logins.
+func NewLoginLockout(store ratelimit.Store) *ratelimit.Lockout {
+	return ratelimit.NewLockout(store, "login-failures:", LOGIN_FAILURE_THRESHOLD, LOGIN_FAILURE_WINDOW, LOGIN_LOCKOUT_BASE, LOGIN_LOCKOUT_MAX)
+}
+
+// LoginEmail keys rate limits by the account a login targets. The body is
+// put back for the handler.
+func LoginEmail(c *gin.Context) string {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+
+	if c.ContentType() == gin.MIMEJSON {
+		var body LoginBody
+		if json.Unmarshal(data, &body) != nil {
+			return ""
+		}
+		return users.NormalizeEmail(body.Email)
+	}
+
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return ""
+	}
+
+	return users.NormalizeEmail(form.Get("email"))
+}
+
+// dummyHash is computed at startup so that the first login for an unknown
+// account does not take longer than the next ones.
+var dummyHash = func() string {
+	hash, err := hashing.HashPassword("not a real password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}()
+
+// comparePassword checks password against hash. Without a hash, for unknown
+// accounts, it compares against a throwaway hash of the same cost so both
+// cases take as long.
+func comparePassword(hash string, password string) bool {
+	if hash != "" {
+		return hashing.ComparePasswords(hash, password)
+	}
+
+	hashing.ComparePasswords(dummyHash, password)
+	return false
+}
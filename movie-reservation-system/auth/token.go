@@ -2,21 +2,44 @@ package auth
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
+const (
+	DEFAULT_ACCESS_TOKEN_TTL = 15 * time.Minute
+	DEFAULT_AUDIENCE         = "movie-reservation-system"
+)
+
+func AccessTokenTTL() time.Duration {
+	return settings.AccessTokenTTL
+}
+
+func audience() string {
+	return settings.Audience
+}
+
 func SignToken(userId int, role string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	set, err := keys()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(set.Active.Method, jwt.MapClaims{
 		"_id":  strconv.Itoa(userId),
 		"role": role,
+		"aud":  audience(),
+		"iat":  now.Unix(),
+		"exp":  now.Add(AccessTokenTTL()).Unix(),
 	})
+	token.Header["kid"] = set.Active.ID
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	tokenString, err := token.SignedString(set.Active.Private)
 	if err != nil {
 		return "", err
 	}
@@ -24,19 +47,35 @@ func SignToken(userId int, role string) (string, error) {
 	return tokenString, nil
 }
 
+// TokenValid parses the request token and only accepts it when it carries an
+// unexpired exp, an iat that is not in the future and our audience. Tokens
+// issued before expiry was introduced have no exp and are rejected.
 func TokenValid(c *gin.Context) (*jwt.Token, error) {
 	token := extractToken(c)
 
-	user, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("SECRET")), nil
-	})
+	user, err := jwt.Parse(token, keyFunc)
 	if err != nil {
 		return nil, err
 	}
 
+	claims, ok := user.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("unexpected claims")
+	}
+
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, fmt.Errorf("token expired or missing exp")
+	}
+
+	if !claims.VerifyIssuedAt(now, true) {
+		return nil, fmt.Errorf("token used before issued or missing iat")
+	}
+
+	if !claims.VerifyAudience(audience(), true) {
+		return nil, fmt.Errorf("invalid audience")
+	}
+
 	return user, nil
 }
 
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// signClaims signs claims with the active test key, bypassing SignToken so
+// that tests can forge any claim.
+func signClaims(t *testing.T, kid string, claims jwt.MapClaims) string {
+	set, err := keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(set.Active.Method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(set.Active.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validate(token string) (*jwt.Token, error) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+token)
+	return TokenValid(c)
+}
+
+func TestTokenValid(t *testing.T) {
+	now := time.Now()
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"_id":  "1",
+			"role": "user",
+			"aud":  DEFAULT_AUDIENCE,
+			"iat":  now.Unix(),
+			"exp":  now.Add(time.Minute).Unix(),
+		}
+		change(c)
+		return c
+	}
+
+	cases := []struct {
+		name   string
+		kid    string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"valid", HMAC_KEY_ID, claims(func(c jwt.MapClaims) {}), true},
+		{"expired", HMAC_KEY_ID, claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Second).Unix() }), false},
+		{"missing exp", HMAC_KEY_ID, claims(func(c jwt.MapClaims) { delete(c, "exp") }), false},
+		{"future iat", HMAC_KEY_ID, claims(func(c jwt.MapClaims) { c["iat"] = now.Add(time.Hour).Unix() }), false},
+		{"missing iat", HMAC_KEY_ID, claims(func(c jwt.MapClaims) { delete(c, "iat") }), false},
+		{"wrong aud", HMAC_KEY_ID, claims(func(c jwt.MapClaims) { c["aud"] = "another-service" }), false},
+		{"missing aud", HMAC_KEY_ID, claims(func(c jwt.MapClaims) { delete(c, "aud") }), false},
+		{"unknown kid", "retired", claims(func(c jwt.MapClaims) {}), false},
+	}
+
+	for _, tc := range cases {
+		_, err := validate(signClaims(t, tc.kid, tc.claims))
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", tc.name, tc.valid, err)
+		}
+	}
+
+	if _, err := validate("not-a-token"); err == nil {
+		t.Error("expected a malformed token to be rejected")
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	repo := NewMemoryRepository()
+	first := RefreshToken{UserID: 1, TokenHash: "first", ExpiresAt: time.Now().Add(time.Hour)}
+	other := RefreshToken{UserID: 2, TokenHash: "other", ExpiresAt: time.Now().Add(time.Hour)}
+	repo.Create(first)
+	repo.Create(other)
+
+	rotateTo := func(hash string) func(int) (RefreshToken, error) {
+		return func(userId int) (RefreshToken, error) {
+			return RefreshToken{UserID: userId, TokenHash: hash, ExpiresAt: time.Now().Add(time.Hour)}, nil
+		}
+	}
+
+	if err := repo.Rotate("first", rotateTo("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"reused", "first", ErrInvalidRefreshToken},
+		{"rotated after reuse", "second", ErrInvalidRefreshToken},
+		{"unknown", "missing", ErrInvalidRefreshToken},
+		{"other user", "other", nil},
+	}
+
+	for _, tc := range cases {
+		if err := repo.Rotate(tc.hash, rotateTo(tc.hash+"-next")); err != tc.err {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+
+	expired := RefreshToken{UserID: 3, TokenHash: "expired", ExpiresAt: time.Now().Add(-time.Second)}
+	repo.Create(expired)
+	if err := repo.Rotate("expired", rotateTo("expired-next")); err != ErrInvalidRefreshToken {
+		t.Fatalf("expected an expired token to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,567 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"movie-reservation-system/auth"
+	"movie-reservation-system/idempotency"
+	"movie-reservation-system/logging"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/pricing"
+	"movie-reservation-system/reservation"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	ENV_DEVELOPMENT = "development"
+	ENV_STAGING     = "staging"
+	ENV_PRODUCTION  = "production"
+)
+
+const (
+	// SENDER_FILE writes notifications to a file or stdout instead of
+	// sending them.
+	SENDER_FILE = "file"
+	SENDER_SMTP = "smtp"
+)
+
+const (
+	DEFAULT_PORT             = 8080
+	DEFAULT_SHUTDOWN_TIMEOUT = 15 * time.Second
+	DEFAULT_CONNECT_ATTEMPTS = 10
+)
+
+// Duration reads Go durations like "15s" from JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"15s\"")
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = parsed
+	return nil
+}
+
+type CORS struct {
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowCredentials bool     `json:"allow_credentials"`
+}
+
+type Database struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	SSLMode  string `json:"ssl_mode"`
+	// ConnectAttempts is how many times startup pings the database before
+	// giving up.
+	ConnectAttempts int `json:"connect_attempts"`
+}
+
+// URL is the connection string for lib/pq.
+func (d Database) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     fmt.Sprintf("%s:%d", d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: "sslmode=" + url.QueryEscape(d.SSLMode),
+	}
+
+	return u.String()
+}
+
+type SMTP struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type Notifications struct {
+	// Sender is file or smtp.
+	Sender string `json:"sender"`
+	// File is where the file sender appends messages, stdout when empty.
+	File string `json:"file"`
+	// From is the sender address, like "Cinema <no-reply@example.com>".
+	From string `json:"from"`
+	SMTP SMTP   `json:"smtp"`
+	// Interval is how often the outbox is checked for notifications to send.
+	Interval Duration `json:"interval"`
+}
+
+type Auth struct {
+	// Secret signs tokens with HS256 when KeysDir is not set.
+	Secret string `json:"secret"`
+	// KeysDir holds "<kid>.pem" keys; SigningKid picks the one that signs
+	// and may be omitted when there is a single private key.
+	KeysDir         string   `json:"keys_dir"`
+	SigningKid      string   `json:"signing_kid"`
+	Audience        string   `json:"audience"`
+	AccessTokenTTL  Duration `json:"access_token_ttl"`
+	RefreshTokenTTL Duration `json:"refresh_token_ttl"`
+}
+
+type Payments struct {
+	// Provider is the payment gateway. Only the fake provider is built in.
+	Provider      string `json:"provider"`
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+type Config struct {
+	Environment string   `json:"environment"`
+	Port        int      `json:"port"`
+	Database    Database `json:"database"`
+	// CORS holds the allowlist of each environment.
+	CORS map[string]CORS `json:"cors"`
+	// AutoMigrate applies pending migrations when the server starts.
+	AutoMigrate bool `json:"auto_migrate"`
+	// ShutdownTimeout is how long in-flight requests get to finish after a
+	// termination signal.
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// TrustedProxies are the addresses whose X-Forwarded-For is believed
+	// when rate limiting by client address. None by default.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// LogFormat is json or text.
+	LogFormat     string        `json:"log_format"`
+	LogLevel      string        `json:"log_level"`
+	Notifications Notifications `json:"notifications"`
+	Auth          Auth          `json:"auth"`
+	Payments      Payments      `json:"payments"`
+	// CancellationCutoff is how long before the screening users can no
+	// longer cancel their bookings.
+	CancellationCutoff Duration `json:"cancellation_cutoff"`
+	// IdempotencyWindow is how long idempotency keys are remembered.
+	IdempotencyWindow Duration `json:"idempotency_window"`
+	// PricingHolidays are YYYY-MM-DD dates priced as holidays.
+	PricingHolidays []string `json:"pricing_holidays"`
+	// MetricsToken is the bearer token scrapers send to /metrics, which is
+	// not served without one.
+	MetricsToken string `json:"metrics_token"`
+	// Timezone is the IANA zone the days of requests and reports are in.
+	Timezone string `json:"timezone"`
+}
+
+// Defaults is the configuration before any file, variable or flag is applied.
+// Only development allows origins out of the box.
+func Defaults() Config {
+	return Config{
+		Environment: ENV_DEVELOPMENT,
+		Port:        DEFAULT_PORT,
+		Database:    Database{Host: "localhost", Port: 5432, SSLMode: "disable", ConnectAttempts: DEFAULT_CONNECT_ATTEMPTS},
+		CORS: map[string]CORS{
+			ENV_DEVELOPMENT: {AllowOrigins: []string{"http://localhost:3000", "http://localhost:5173"}, AllowCredentials: true},
+			ENV_STAGING:     {AllowOrigins: []string{}},
+			ENV_PRODUCTION:  {AllowOrigins: []string{}},
+		},
+		AutoMigrate:     true,
+		ShutdownTimeout: Duration{DEFAULT_SHUTDOWN_TIMEOUT},
+		LogFormat:       logging.FORMAT_JSON,
+		LogLevel:        "info",
+		Notifications: Notifications{
+			Sender:   SENDER_FILE,
+			From:     "Movie Reservations <no-reply@localhost>",
+			SMTP:     SMTP{Port: 587},
+			Interval: Duration{10 * time.Second},
+		},
+		Auth:               Auth{Audience: auth.DEFAULT_AUDIENCE, AccessTokenTTL: Duration{auth.DEFAULT_ACCESS_TOKEN_TTL}, RefreshTokenTTL: Duration{auth.DEFAULT_REFRESH_TOKEN_TTL}},
+		Payments:           Payments{Provider: payments.FAKE_PROVIDER},
+		CancellationCutoff: Duration{reservation.DEFAULT_CANCELLATION_CUTOFF},
+		IdempotencyWindow:  Duration{idempotency.DEFAULT_WINDOW},
+		PricingHolidays:    []string{},
+		Timezone:           "UTC",
+	}
+}
+
+// Location loads Timezone. Local is refused because the database would not
+// know which zone it stands for.
+func (c *Config) Location() (*time.Location, error) {
+	if c.Timezone == "" || c.Timezone == "Local" {
+		return nil, fmt.Errorf("timezone must be an IANA name like Europe/Paris, got %q", c.Timezone)
+	}
+
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timezone %q is unknown", c.Timezone)
+	}
+
+	return location, nil
+}
+
+// CurrentCORS is the allowlist of the running environment.
+func (c *Config) CurrentCORS() CORS {
+	return c.CORS[c.Environment]
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	problems := []string{}
+
+	switch c.Environment {
+	case ENV_DEVELOPMENT, ENV_STAGING, ENV_PRODUCTION:
+	default:
+		problems = append(problems, fmt.Sprintf("environment must be %s, %s or %s, got %q", ENV_DEVELOPMENT, ENV_STAGING, ENV_PRODUCTION, c.Environment))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port must be between 1 and 65535, got %d", c.Port))
+	}
+
+	if c.Database.Host == "" {
+		problems = append(problems, "database host is required")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("database port must be between 1 and 65535, got %d", c.Database.Port))
+	}
+	if c.Database.ConnectAttempts < 1 {
+		problems = append(problems, "database connect attempts must be at least 1")
+	}
+	if c.Database.User == "" {
+		problems = append(problems, "database user is required")
+	}
+	if c.Database.Name == "" {
+		problems = append(problems, "database name is required")
+	}
+
+	if c.LogFormat != logging.FORMAT_JSON && c.LogFormat != logging.FORMAT_TEXT {
+		problems = append(problems, fmt.Sprintf("log format must be %s or %s, got %q", logging.FORMAT_JSON, logging.FORMAT_TEXT, c.LogFormat))
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("trusted proxy %q must be an IP or a CIDR", proxy))
+		}
+	}
+
+	if c.ShutdownTimeout.Duration <= 0 {
+		problems = append(problems, "shutdown timeout must be positive")
+	}
+
+	switch c.Notifications.Sender {
+	case SENDER_FILE:
+	case SENDER_SMTP:
+		if c.Notifications.SMTP.Host == "" {
+			problems = append(problems, "smtp host is required by the smtp sender")
+		}
+		if c.Notifications.SMTP.Port < 1 || c.Notifications.SMTP.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("smtp port must be between 1 and 65535, got %d", c.Notifications.SMTP.Port))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("notification sender must be %s or %s, got %q", SENDER_FILE, SENDER_SMTP, c.Notifications.Sender))
+	}
+	if _, err := mail.ParseAddress(c.Notifications.From); err != nil {
+		problems = append(problems, fmt.Sprintf("notification sender address %q is invalid", c.Notifications.From))
+	}
+	if c.Notifications.Interval.Duration <= 0 {
+		problems = append(problems, "notification interval must be positive")
+	}
+
+	if c.Auth.Secret == "" && c.Auth.KeysDir == "" {
+		problems = append(problems, "auth secret is required when no keys directory is set")
+	}
+	if c.Auth.Audience == "" {
+		problems = append(problems, "auth audience is required")
+	}
+	if c.Auth.AccessTokenTTL.Duration <= 0 || c.Auth.RefreshTokenTTL.Duration <= 0 {
+		problems = append(problems, "token ttls must be positive")
+	}
+
+	if c.Payments.Provider != payments.FAKE_PROVIDER {
+		problems = append(problems, fmt.Sprintf("payment provider must be %s, got %q", payments.FAKE_PROVIDER, c.Payments.Provider))
+	}
+	if c.Payments.Provider == payments.FAKE_PROVIDER && c.Environment == ENV_PRODUCTION {
+		problems = append(problems, "the fake payment provider cannot run in production")
+	}
+	if c.Payments.WebhookSecret == "" {
+		problems = append(problems, "payment webhook secret is required")
+	}
+
+	if c.CancellationCutoff.Duration < 0 {
+		problems = append(problems, "cancellation cutoff cannot be negative")
+	}
+	if c.IdempotencyWindow.Duration <= 0 {
+		problems = append(problems, "idempotency window must be positive")
+	}
+	for _, date := range c.PricingHolidays {
+		if _, err := time.Parse(pricing.HOLIDAY_LAYOUT, date); err != nil {
+			problems = append(problems, fmt.Sprintf("pricing holiday %q must be a YYYY-MM-DD date", date))
+		}
+	}
+
+	if _, err := c.Location(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	cors := c.CurrentCORS()
+	for _, origin := range cors.AllowOrigins {
+		if origin == "*" {
+			if cors.AllowCredentials {
+				problems = append(problems, "cors cannot allow every origin with credentials")
+			}
+			if c.Environment == ENV_PRODUCTION {
+				problems = append(problems, "cors cannot allow every origin in production")
+			}
+			continue
+		}
+
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path != "" {
+			problems = append(problems, fmt.Sprintf("cors origin %q must look like https://example.com", origin))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// LoadDotEnv loads ENV_FILE, or .env when it is not set. A missing .env is
+// fine since the variables may come from the environment, but an ENV_FILE
+// that cannot be read is an error.
+func LoadDotEnv() error {
+	path := os.Getenv("ENV_FILE")
+	if path == "" {
+		err := godotenv.Load()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return godotenv.Load(path)
+}
+
+// Load builds the configuration from the defaults, the JSON config file, the
+// environment and the command line flags, each overriding the previous one.
+// args are the arguments after the program name; the ones left after the
+// flags are returned, like a migrate subcommand.
+func Load(args []string) (*Config, []string, error) {
+	flags := flag.NewFlagSet("movie-reservation-system", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file")
+	environment := flags.String("env", "", "environment: development, staging or production")
+	port := flags.Int("port", 0, "port to listen on")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Defaults()
+
+	if *configFile != "" {
+		if err := loadFile(&cfg, *configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return nil, nil, err
+	}
+
+	if *environment != "" {
+		cfg.Environment = *environment
+	}
+	if *port != 0 {
+		cfg.Port = *port
+	}
+
+	if err := applyCORSEnv(&cfg, os.LookupEnv); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return &cfg, flags.Args(), nil
+}
+
+// loadFile merges the file into cfg. CORS entries replace the defaults of
+// their environment only.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	defaultCORS := cfg.CORS
+	cfg.CORS = nil
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	for environment, cors := range defaultCORS {
+		if _, ok := cfg.CORS[environment]; !ok {
+			if cfg.CORS == nil {
+				cfg.CORS = make(map[string]CORS)
+			}
+			cfg.CORS[environment] = cors
+		}
+	}
+
+	return nil
+}
+
+// applyEnv overrides cfg with the variables that are set, except for CORS.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	if value, ok := lookup("APP_ENV"); ok && value != "" {
+		cfg.Environment = value
+	}
+
+	ints := map[string]*int{
+		"PORT":                &cfg.Port,
+		"DB_PORT":             &cfg.Database.Port,
+		"DB_CONNECT_ATTEMPTS": &cfg.Database.ConnectAttempts,
+		"SMTP_PORT":           &cfg.Notifications.SMTP.Port,
+	}
+	for name, target := range ints {
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, got %q", name, value)
+		}
+		*target = parsed
+	}
+
+	strs := map[string]*string{
+		"DB_HOST":     &cfg.Database.Host,
+		"DB_USER":     &cfg.Database.User,
+		"DB_PASSWORD": &cfg.Database.Password,
+		"DB_NAME":     &cfg.Database.Name,
+		"DB_SSLMODE":  &cfg.Database.SSLMode,
+		"LOG_FORMAT":  &cfg.LogFormat,
+		"LOG_LEVEL":   &cfg.LogLevel,
+
+		"NOTIFICATION_SENDER": &cfg.Notifications.Sender,
+		"NOTIFICATION_FILE":   &cfg.Notifications.File,
+		"NOTIFICATION_FROM":   &cfg.Notifications.From,
+		"SMTP_HOST":           &cfg.Notifications.SMTP.Host,
+		"SMTP_USERNAME":       &cfg.Notifications.SMTP.Username,
+		"SMTP_PASSWORD":       &cfg.Notifications.SMTP.Password,
+
+		"SECRET":                 &cfg.Auth.Secret,
+		"JWT_KEYS_DIR":           &cfg.Auth.KeysDir,
+		"JWT_SIGNING_KID":        &cfg.Auth.SigningKid,
+		"JWT_AUDIENCE":           &cfg.Auth.Audience,
+		"PAYMENT_PROVIDER":       &cfg.Payments.Provider,
+		"PAYMENT_WEBHOOK_SECRET": &cfg.Payments.WebhookSecret,
+		"METRICS_TOKEN":          &cfg.MetricsToken,
+		"TIMEZONE":               &cfg.Timezone,
+	}
+	for name, target := range strs {
+		if value, ok := lookup(name); ok && value != "" {
+			*target = value
+		}
+	}
+
+	if value, ok := lookup("AUTO_MIGRATE"); ok && value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("AUTO_MIGRATE must be true or false, got %q", value)
+		}
+		cfg.AutoMigrate = parsed
+	}
+
+	if value, ok := lookup("TRUSTED_PROXIES"); ok {
+		cfg.TrustedProxies = []string{}
+		for _, proxy := range strings.Split(value, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+			}
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT":      &cfg.ShutdownTimeout.Duration,
+		"NOTIFICATION_INTERVAL": &cfg.Notifications.Interval.Duration,
+		"ACCESS_TOKEN_TTL":      &cfg.Auth.AccessTokenTTL.Duration,
+		"REFRESH_TOKEN_TTL":     &cfg.Auth.RefreshTokenTTL.Duration,
+		"CANCELLATION_CUTOFF":   &cfg.CancellationCutoff.Duration,
+		"IDEMPOTENCY_WINDOW":    &cfg.IdempotencyWindow.Duration,
+	}
+	for name, target := range durations {
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration like 15s, got %q", name, value)
+		}
+		*target = parsed
+	}
+
+	if value, ok := lookup("PRICING_HOLIDAYS"); ok {
+		cfg.PricingHolidays = []string{}
+		for _, date := range strings.Split(value, ",") {
+			if date = strings.TrimSpace(date); date != "" {
+				cfg.PricingHolidays = append(cfg.PricingHolidays, date)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyCORSEnv overrides the allowlist of the selected environment.
+func applyCORSEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	cors := cfg.CurrentCORS()
+	changed := false
+	if value, ok := lookup("CORS_ALLOW_ORIGINS"); ok {
+		cors.AllowOrigins = []string{}
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cors.AllowOrigins = append(cors.AllowOrigins, origin)
+			}
+		}
+		changed = true
+	}
+	if value, ok := lookup("CORS_ALLOW_CREDENTIALS"); ok && value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("CORS_ALLOW_CREDENTIALS must be true or false, got %q", value)
+		}
+		cors.AllowCredentials = parsed
+		changed = true
+	}
+	if changed {
+		if cfg.CORS == nil {
+			cfg.CORS = make(map[string]CORS)
+		}
+		cfg.CORS[cfg.Environment] = cors
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"movie-reservation-system/payments"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"environment": "staging",
+		"port": 9000,
+		"shutdown_timeout": "30s",
+		"database": {"host": "db", "user": "app", "name": "movies"},
+		"cors": {"staging": {"allow_origins": ["https://staging.example.com"]}}
+	}`)
+	t.Setenv("PORT", "9100")
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("SECRET", "signing-secret")
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", "webhook-secret")
+
+	cfg, args, err := Load([]string{"-config", path, "-port", "9200", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ShutdownTimeout.Duration != 30*time.Second {
+		t.Fatalf("expected the file shutdown timeout, got %s", cfg.ShutdownTimeout)
+	}
+	if cfg.Port != 9200 {
+		t.Fatalf("expected the flag to win, got port %d", cfg.Port)
+	}
+	if cfg.Environment != ENV_STAGING || cfg.Database.Host != "db" || cfg.Database.Port != 5432 || cfg.Database.Password != "secret" {
+		t.Fatalf("expected the file and env to be merged over the defaults, got %+v", cfg)
+	}
+	if origins := cfg.CurrentCORS().AllowOrigins; len(origins) != 1 || origins[0] != "https://staging.example.com" {
+		t.Fatalf("expected the staging allowlist, got %v", origins)
+	}
+	if len(cfg.CORS[ENV_DEVELOPMENT].AllowOrigins) == 0 {
+		t.Fatal("expected the development defaults to be kept")
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Fatalf("expected the subcommand to be left over, got %v", args)
+	}
+}
+
+func TestCORSEnvFollowsEnvironmentFlag(t *testing.T) {
+	t.Setenv("DB_USER", "app")
+	t.Setenv("DB_NAME", "movies")
+	t.Setenv("SECRET", "signing-secret")
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", "webhook-secret")
+	t.Setenv("CORS_ALLOW_ORIGINS", "https://example.com, https://www.example.com")
+
+	cfg, _, err := Load([]string{"-env", "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if origins := cfg.CORS[ENV_STAGING].AllowOrigins; len(origins) != 2 {
+		t.Fatalf("expected the staging allowlist to be overridden, got %v", origins)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]func(cfg *Config){
+		"environment": func(cfg *Config) { cfg.Environment = "qa" },
+		"port":        func(cfg *Config) { cfg.Port = 70000 },
+		"database":    func(cfg *Config) { cfg.Database.Name = "" },
+		"wildcard": func(cfg *Config) {
+			cfg.CORS[ENV_DEVELOPMENT] = CORS{AllowOrigins: []string{"*"}, AllowCredentials: true}
+		},
+		"origin": func(cfg *Config) { cfg.CORS[ENV_DEVELOPMENT] = CORS{AllowOrigins: []string{"example.com"}} },
+		"production *": func(cfg *Config) {
+			cfg.Environment = ENV_PRODUCTION
+			cfg.CORS[ENV_PRODUCTION] = CORS{AllowOrigins: []string{"*"}}
+		},
+		"sender":    func(cfg *Config) { cfg.Notifications.Sender = "pigeon" },
+		"smtp host": func(cfg *Config) { cfg.Notifications.Sender = SENDER_SMTP },
+		"from":      func(cfg *Config) { cfg.Notifications.From = "not an address" },
+		"secret":    func(cfg *Config) { cfg.Auth.Secret = "" },
+		"token ttl": func(cfg *Config) { cfg.Auth.AccessTokenTTL.Duration = 0 },
+		"provider":  func(cfg *Config) { cfg.Payments.Provider = "stripe" },
+		"webhook":   func(cfg *Config) { cfg.Payments.WebhookSecret = "" },
+		"production provider": func(cfg *Config) {
+			cfg.Environment = ENV_PRODUCTION
+			cfg.Payments.Provider = payments.FAKE_PROVIDER
+		},
+		"cutoff":   func(cfg *Config) { cfg.CancellationCutoff.Duration = -time.Hour },
+		"window":   func(cfg *Config) { cfg.IdempotencyWindow.Duration = 0 },
+		"holiday":  func(cfg *Config) { cfg.PricingHolidays = []string{"2030-13-01"} },
+		"timezone": func(cfg *Config) { cfg.Timezone = "Mars/Olympus_Mons" },
+		"local":    func(cfg *Config) { cfg.Timezone = "Local" },
+	}
+
+	for name, change := range cases {
+		cfg := Defaults()
+		cfg.Database.User = "app"
+		cfg.Database.Name = "movies"
+		cfg.Auth.Secret = "signing-secret"
+		cfg.Payments.WebhookSecret = "webhook-secret"
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("expected the defaults to be valid, got %v", err)
+		}
+
+		change(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadReadsServiceSettings(t *testing.T) {
+	t.Setenv("DB_USER", "app")
+	t.Setenv("DB_NAME", "movies")
+	t.Setenv("SECRET", "signing-secret")
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", "webhook-secret")
+	t.Setenv("CANCELLATION_CUTOFF", "90m")
+	t.Setenv("IDEMPOTENCY_WINDOW", "12h")
+	t.Setenv("PRICING_HOLIDAYS", "2030-12-25, 2030-01-01")
+	t.Setenv("METRICS_TOKEN", "scrape-token")
+
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.CancellationCutoff.Duration != 90*time.Minute || cfg.IdempotencyWindow.Duration != 12*time.Hour || len(cfg.PricingHolidays) != 2 || cfg.Auth.Secret != "signing-secret" || cfg.MetricsToken != "scrape-token" {
+		t.Fatalf("unexpected settings %+v", cfg)
+	}
+
+	t.Setenv("CANCELLATION_CUTOFF", "soon")
+	if _, _, err := Load(nil); err == nil {
+		t.Fatal("expected an invalid cutoff to fail the startup")
+	}
+
+	t.Setenv("CANCELLATION_CUTOFF", "")
+	t.Setenv("PRICING_HOLIDAYS", "christmas")
+	if _, _, err := Load(nil); err == nil {
+		t.Fatal("expected an invalid holiday to fail the startup")
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	path := writeConfig(t, `{"prot": 9000}`)
+	if _, _, err := Load([]string{"-config", path}); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
@@ -3,7 +3,8 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"os"
+	"log/slog"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -18,23 +19,38 @@ func GetDB() (*DB, error) {
 	return Db, nil
 }
 
-func Connect() {
-	fmt.Println("Connecting to the database")
+// MAX_CONNECT_BACKOFF caps the wait between two connection attempts.
+const MAX_CONNECT_BACKOFF = 30 * time.Second
 
-	databaseUrl := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+// Connect opens the database and pings it, retrying with an exponential
+// backoff since the database often starts at the same time as the API.
+func Connect(databaseUrl string, attempts int) error {
+	slog.Info("connecting to the database")
 
 	db, err := sql.Open("postgres", databaseUrl)
 	if err != nil {
-		fmt.Println("Error connecting to the database: ", err)
-		panic(err)
+		return err
 	}
 
-	dbConnection := db.Ping()
-	if dbConnection != nil {
-		panic(dbConnection.Error())
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+
+		if attempt >= attempts {
+			db.Close()
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("database not ready", "attempt", attempt, "retry_in", backoff.String(), "error", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, MAX_CONNECT_BACKOFF)
 	}
 
-	fmt.Println("Connected to the database")
+	slog.Info("connected to the database")
 
 	Db = &DB{db}
+	return nil
 }
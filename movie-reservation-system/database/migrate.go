@@ -0,0 +1,255 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+//go:embed seed.sql
+var seedFile string
+
+// MIGRATION_LOCK_ID is the advisory lock taken while migrating, so several
+// instances starting together do not apply the same migration twice.
+const MIGRATION_LOCK_ID = 720_174_361
+
+// Migrations are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		direction := ""
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", base)
+		}
+
+		name := strings.TrimSuffix(base, "."+direction+".sql")
+		versionPart, name, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionPart)
+		if !found || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s must start with a positive version", base)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func ensureMigrationsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+func appliedVersions(tx *sql.Tx) (map[int]bool, error) {
+	rows, err := tx.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// migrate runs fn in a single transaction holding the migration lock, so a
+// failing migration leaves the schema untouched.
+func (db *DB) migrate(fn func(tx *sql.Tx, migrations []Migration, applied map[int]bool) error) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", MIGRATION_LOCK_ID)
+	if err != nil {
+		return err
+	}
+
+	err = ensureMigrationsTable(tx)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx, migrations, applied)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp applies every pending migration in version order and returns how
+// many were applied.
+func (db *DB) MigrateUp() (int, error) {
+	count := 0
+	err := db.migrate(func(tx *sql.Tx, migrations []Migration, applied map[int]bool) error {
+		for _, migration := range migrations {
+			if applied[migration.Version] {
+				continue
+			}
+
+			slog.Info("applying migration", "version", migration.Version, "name", migration.Name)
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first.
+func (db *DB) MigrateDown(steps int) (int, error) {
+	count := 0
+	err := db.migrate(func(tx *sql.Tx, migrations []Migration, applied map[int]bool) error {
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+
+			slog.Info("reverting migration", "version", migration.Version, "name", migration.Name)
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+	err := db.migrate(func(tx *sql.Tx, migrations []Migration, applied map[int]bool) error {
+		for _, migration := range migrations {
+			statuses = append(statuses, MigrationStatus{Migration: migration, Applied: applied[migration.Version]})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Seed loads the development data. It expects every migration to be applied.
+func (db *DB) Seed() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(seedFile); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
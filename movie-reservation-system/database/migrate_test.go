@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("expected migration %d_%s to have version %d", migration.Version, migration.Name, i+1)
+		}
+	}
+
+	if seedFile == "" {
+		t.Error("expected an embedded seed file")
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS Reservation;
+DROP TABLE IF EXISTS movies_casting;
+DROP TABLE IF EXISTS movies_genres;
+DROP TABLE IF EXISTS casting;
+DROP TABLE IF EXISTS genres;
+DROP TABLE IF EXISTS movies;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	birthdate DATE NOT NULL,
+	email TEXT NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS movies (
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	year INTEGER NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	image_url TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS genres (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS casting (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS movies_genres (
+	movie_id INTEGER NOT NULL REFERENCES movies(id),
+	genre_id INTEGER NOT NULL REFERENCES genres(id)
+);
+
+CREATE TABLE IF NOT EXISTS movies_casting (
+	movie_id INTEGER NOT NULL REFERENCES movies(id),
+	casting_id INTEGER NOT NULL REFERENCES casting(id)
+);
+
+CREATE TABLE IF NOT EXISTS Reservation (
+	id SERIAL PRIMARY KEY,
+	movie_id INTEGER NOT NULL REFERENCES movies(id),
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	date TIMESTAMPTZ NOT NULL,
+	seat TEXT NOT NULL,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS reservation_user_id_idx ON Reservation (user_id);
+CREATE INDEX IF NOT EXISTS reservation_movie_id_idx ON Reservation (movie_id);
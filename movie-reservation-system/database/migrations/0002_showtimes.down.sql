@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS reservation_showtime_seat_idx;
+
+ALTER TABLE Reservation DROP COLUMN IF EXISTS showtime_id;
+
+DROP TABLE IF EXISTS showtimes;
+DROP TABLE IF EXISTS halls;
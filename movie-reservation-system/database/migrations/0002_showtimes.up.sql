@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS halls (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS showtimes (
+	id SERIAL PRIMARY KEY,
+	movie_id INTEGER NOT NULL REFERENCES movies(id),
+	hall_id INTEGER NOT NULL REFERENCES halls(id),
+	starts_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (hall_id, starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS showtimes_movie_id_idx ON showtimes (movie_id, starts_at);
+
+ALTER TABLE Reservation ADD COLUMN IF NOT EXISTS showtime_id INTEGER REFERENCES showtimes(id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reservation_showtime_seat_idx
+	ON Reservation (showtime_id, seat)
+	WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS hall_seat_categories;
+
+ALTER TABLE halls DROP COLUMN IF EXISTS disabled_seats;
+ALTER TABLE halls DROP COLUMN IF EXISTS columns;
+ALTER TABLE halls DROP COLUMN IF EXISTS rows;
@@ -0,0 +1,10 @@
+ALTER TABLE halls ADD COLUMN IF NOT EXISTS rows INTEGER NOT NULL DEFAULT 10 CHECK (rows BETWEEN 1 AND 26);
+ALTER TABLE halls ADD COLUMN IF NOT EXISTS columns INTEGER NOT NULL DEFAULT 10 CHECK (columns BETWEEN 1 AND 99);
+ALTER TABLE halls ADD COLUMN IF NOT EXISTS disabled_seats TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS hall_seat_categories (
+	hall_id INTEGER NOT NULL REFERENCES halls(id) ON DELETE CASCADE,
+	category TEXT NOT NULL,
+	rows TEXT[] NOT NULL,
+	PRIMARY KEY (hall_id, category)
+);
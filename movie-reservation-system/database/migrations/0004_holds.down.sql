@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS hold_seats;
+DROP TABLE IF EXISTS holds;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS holds (
+	id SERIAL PRIMARY KEY,
+	showtime_id INTEGER NOT NULL REFERENCES showtimes(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	expires_at TIMESTAMPTZ NOT NULL,
+	confirmed_at TIMESTAMPTZ,
+	released_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS holds_active_idx
+	ON holds (showtime_id, expires_at)
+	WHERE confirmed_at IS NULL AND released_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS hold_seats (
+	hold_id INTEGER NOT NULL REFERENCES holds(id) ON DELETE CASCADE,
+	seat TEXT NOT NULL,
+	PRIMARY KEY (hold_id, seat)
+);
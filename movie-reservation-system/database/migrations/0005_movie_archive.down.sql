@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS movies_casting_idx;
+DROP INDEX IF EXISTS movies_genres_idx;
+DROP INDEX IF EXISTS genres_name_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS archived_at;
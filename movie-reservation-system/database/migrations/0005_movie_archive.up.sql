@@ -0,0 +1,6 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS genres_name_idx ON genres (LOWER(name));
+
+CREATE UNIQUE INDEX IF NOT EXISTS movies_genres_idx ON movies_genres (movie_id, genre_id);
+CREATE UNIQUE INDEX IF NOT EXISTS movies_casting_idx ON movies_casting (movie_id, casting_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+
+DROP INDEX IF EXISTS users_email_idx;
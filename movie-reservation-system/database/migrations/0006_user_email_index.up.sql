@@ -0,0 +1,3 @@
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (LOWER(email));
+
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS movies_genres_genre_id_idx;
+DROP INDEX IF EXISTS movies_casting_casting_id_idx;
+DROP INDEX IF EXISTS movies_year_idx;
+DROP INDEX IF EXISTS movies_title_idx;
+DROP INDEX IF EXISTS movies_search_idx;
@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS movies_search_idx
+	ON movies USING GIN (to_tsvector('english', title || ' ' || description));
+
+CREATE INDEX IF NOT EXISTS movies_title_idx ON movies (title, id);
+CREATE INDEX IF NOT EXISTS movies_year_idx ON movies (year, id);
+CREATE INDEX IF NOT EXISTS movies_casting_casting_id_idx ON movies_casting (casting_id);
+CREATE INDEX IF NOT EXISTS movies_genres_genre_id_idx ON movies_genres (genre_id);
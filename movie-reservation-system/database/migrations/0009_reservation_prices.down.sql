@@ -0,0 +1 @@
+ALTER TABLE Reservation DROP COLUMN IF EXISTS price_cents;
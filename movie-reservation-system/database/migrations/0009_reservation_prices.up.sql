@@ -0,0 +1,3 @@
+-- Prices are in cents and frozen when the reservation is made, so later rule
+-- changes do not rewrite history.
+ALTER TABLE Reservation ADD COLUMN IF NOT EXISTS price_cents INTEGER NOT NULL DEFAULT 0 CHECK (price_cents >= 0);
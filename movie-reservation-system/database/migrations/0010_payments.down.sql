@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS reservation_payment_id_idx;
+
+ALTER TABLE Reservation DROP COLUMN IF EXISTS payment_id;
+ALTER TABLE Reservation DROP COLUMN IF EXISTS status;
+
+DROP TABLE IF EXISTS payments;
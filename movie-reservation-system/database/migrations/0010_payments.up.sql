@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS payments (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	showtime_id INTEGER NOT NULL REFERENCES showtimes(id),
+	amount_cents INTEGER NOT NULL CHECK (amount_cents >= 0),
+	currency TEXT NOT NULL,
+	status TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	provider_payment_id TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (provider, provider_payment_id)
+);
+
+CREATE INDEX IF NOT EXISTS payments_open_idx
+	ON payments (created_at)
+	WHERE status IN ('pending', 'authorized');
+
+-- Reservations made before payments existed are considered paid.
+ALTER TABLE Reservation ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'paid';
+ALTER TABLE Reservation ADD COLUMN IF NOT EXISTS payment_id INTEGER REFERENCES payments(id);
+
+CREATE INDEX IF NOT EXISTS reservation_payment_id_idx ON Reservation (payment_id);
@@ -0,0 +1,5 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_cents;
+
+DROP INDEX IF EXISTS reservation_booking_id_idx;
+
+ALTER TABLE Reservation DROP COLUMN IF EXISTS booking_id;
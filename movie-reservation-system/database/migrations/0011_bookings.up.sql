@@ -0,0 +1,22 @@
+ALTER TABLE Reservation ADD COLUMN IF NOT EXISTS booking_id TEXT;
+
+-- Older reservations are grouped into one booking per user, movie and date,
+-- which is how they were made.
+UPDATE Reservation r
+SET booking_id = g.booking_id
+FROM (
+	SELECT user_id, movie_id, date, 'legacy-' || MIN(id) AS booking_id
+	FROM Reservation
+	WHERE booking_id IS NULL
+	GROUP BY user_id, movie_id, date
+) g
+WHERE r.booking_id IS NULL
+	AND r.user_id = g.user_id
+	AND r.movie_id = g.movie_id
+	AND r.date = g.date;
+
+ALTER TABLE Reservation ALTER COLUMN booking_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS reservation_booking_id_idx ON Reservation (booking_id);
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_cents INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS reservation_created_at_idx;
+DROP INDEX IF EXISTS reservation_date_idx;
+
+ALTER TABLE Reservation DROP COLUMN IF EXISTS created_at;
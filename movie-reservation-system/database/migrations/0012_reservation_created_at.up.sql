@@ -0,0 +1,5 @@
+-- Older reservations get the time of the migration as their booking time.
+ALTER TABLE Reservation ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS reservation_date_idx ON Reservation (date);
+CREATE INDEX IF NOT EXISTS reservation_created_at_idx ON Reservation (created_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	key TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	-- status_code stays NULL while the first request is being processed.
+	status_code INTEGER,
+	content_type TEXT NOT NULL DEFAULT '',
+	response_body BYTEA,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
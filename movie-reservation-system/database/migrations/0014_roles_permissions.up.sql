@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+	PRIMARY KEY (role, permission)
+);
+
+INSERT INTO permissions (name, description) VALUES
+	('movies:write', 'Manage movies, genres and cast'),
+	('showtimes:write', 'Manage halls and showtimes'),
+	('reservations:read', 'See the reservations of any user'),
+	('reservations:refund', 'Cancel and refund the bookings of any user'),
+	('reports:read', 'Read reservation reports'),
+	('users:manage', 'List users and assign their roles')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO roles (name, description) VALUES
+	('user', 'Customer'),
+	('manager', 'Runs the catalog and the schedule'),
+	('support', 'Helps customers with their bookings'),
+	('admin', 'Everything')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('manager', 'movies:write'),
+	('manager', 'showtimes:write'),
+	('manager', 'reservations:read'),
+	('manager', 'reports:read'),
+	('support', 'reservations:read'),
+	('support', 'reservations:refund')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions
+ON CONFLICT DO NOTHING;
+
+-- Users may carry roles that were never declared.
+INSERT INTO roles (name)
+SELECT DISTINCT role FROM users
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+	id SERIAL PRIMARY KEY,
+	showtime_id INTEGER NOT NULL REFERENCES showtimes(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	seats INTEGER NOT NULL CHECK (seats > 0),
+	-- waiting, offered, claimed, expired or left.
+	status TEXT NOT NULL DEFAULT 'waiting',
+	-- hold_id is the hold offered to the user once seats were freed.
+	hold_id INTEGER REFERENCES holds(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS waitlist_entries_open_idx
+	ON waitlist_entries (showtime_id, user_id)
+	WHERE status IN ('waiting', 'offered');
+
+CREATE INDEX IF NOT EXISTS waitlist_entries_queue_idx
+	ON waitlist_entries (showtime_id, created_at, id)
+	WHERE status = 'waiting';
+
+CREATE INDEX IF NOT EXISTS waitlist_entries_hold_idx ON waitlist_entries (hold_id);
@@ -0,0 +1,26 @@
+-- notifications is the outbox: rows are written in the transaction that
+-- changes the reservations and delivered by the notification worker.
+CREATE TABLE IF NOT EXISTS notifications (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	-- reservation_confirmed, reservation_canceled, showtime_reminder or
+	-- payment_failed.
+	kind TEXT NOT NULL,
+	recipient TEXT NOT NULL,
+	recipient_name TEXT NOT NULL DEFAULT '',
+	-- data is what the template of the kind is rendered with.
+	data JSONB NOT NULL,
+	-- pending, sent or failed.
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	-- dedup_key keeps notifications like reminders from being queued twice.
+	dedup_key TEXT UNIQUE,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS notifications_due_idx
+	ON notifications (next_attempt_at, id)
+	WHERE status = 'pending';
@@ -0,0 +1,3 @@
+UPDATE Reservation SET status = 'refunded' WHERE status = 'refund_pending';
+ALTER TABLE Reservation DROP COLUMN IF EXISTS refund_id;
+DROP TABLE IF EXISTS refunds;
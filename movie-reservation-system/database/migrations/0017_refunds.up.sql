@@ -0,0 +1,21 @@
+-- refunds are recorded when seats are canceled, before the provider is asked
+-- for the money, so a refund that fails half way is retried rather than lost
+-- or sent twice.
+CREATE TABLE IF NOT EXISTS refunds (
+	id SERIAL PRIMARY KEY,
+	payment_id INTEGER NOT NULL REFERENCES payments(id),
+	booking_id TEXT NOT NULL,
+	amount_cents INTEGER NOT NULL CHECK (amount_cents > 0),
+	-- idempotency_key is sent to the provider with every attempt.
+	idempotency_key TEXT NOT NULL UNIQUE,
+	-- pending until the provider accepted it, then refunded.
+	status TEXT NOT NULL DEFAULT 'pending',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_pending_idx ON refunds (created_at) WHERE status = 'pending';
+
+-- refund_id links canceled seats to the refund covering them. They are
+-- refund_pending until it is sent.
+ALTER TABLE Reservation ADD COLUMN IF NOT EXISTS refund_id INTEGER REFERENCES refunds(id);
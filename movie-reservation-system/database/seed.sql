@@ -0,0 +1,61 @@
+-- Development data. Both users log in with "password123". Running the seed
+-- again only adds what is missing.
+INSERT INTO users (name, birthdate, email, password, role) VALUES
+	('Admin', '1990-01-01', 'admin@example.com', '$2a$10$/CMKxlIOMUDgVop9ntTzGuLv.VjDCwpPbZCrMh1E61xDNkdc14oI2', 'admin'),
+	('User', '1995-06-15', 'user@example.com', '$2a$10$/CMKxlIOMUDgVop9ntTzGuLv.VjDCwpPbZCrMh1E61xDNkdc14oI2', 'user')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genres (name) VALUES ('Science Fiction'), ('Horror'), ('Drama'), ('Comedy')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO casting (name)
+SELECT name FROM (VALUES ('Sigourney Weaver'), ('Harrison Ford'), ('Keanu Reeves')) AS c(name)
+WHERE NOT EXISTS (SELECT 1 FROM casting WHERE casting.name = c.name);
+
+INSERT INTO movies (title, year, description, image_url)
+SELECT title, year, description, image_url FROM (VALUES
+	('Alien', 1979, 'The crew of a commercial spacecraft encounters a deadly lifeform.', 'https://example.com/alien.jpg'),
+	('Blade Runner', 1982, 'A blade runner must pursue and terminate four replicants.', 'https://example.com/blade-runner.jpg'),
+	('The Matrix', 1999, 'A hacker learns the true nature of his reality.', 'https://example.com/the-matrix.jpg')
+) AS m(title, year, description, image_url)
+WHERE NOT EXISTS (SELECT 1 FROM movies WHERE movies.title = m.title);
+
+INSERT INTO movies_genres (movie_id, genre_id)
+SELECT m.id, g.id FROM (VALUES
+	('Alien', 'Science Fiction'),
+	('Alien', 'Horror'),
+	('Blade Runner', 'Science Fiction'),
+	('Blade Runner', 'Drama'),
+	('The Matrix', 'Science Fiction')
+) AS v(title, genre)
+JOIN movies m ON m.title = v.title
+JOIN genres g ON g.name = v.genre
+ON CONFLICT DO NOTHING;
+
+INSERT INTO movies_casting (movie_id, casting_id)
+SELECT m.id, c.id FROM (VALUES
+	('Alien', 'Sigourney Weaver'),
+	('Blade Runner', 'Harrison Ford'),
+	('The Matrix', 'Keanu Reeves')
+) AS v(title, name)
+JOIN movies m ON m.title = v.title
+JOIN casting c ON c.name = v.name
+ON CONFLICT DO NOTHING;
+
+INSERT INTO halls (name, rows, columns, disabled_seats) VALUES
+	('Hall 1', 8, 12, '{H1,H12}'),
+	('Hall 2', 5, 10, '{}')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO hall_seat_categories (hall_id, category, rows)
+SELECT id, 'premium', '{G,H}' FROM halls WHERE name = 'Hall 1'
+ON CONFLICT DO NOTHING;
+
+-- One screening of every movie per hall for the next three evenings.
+INSERT INTO showtimes (movie_id, hall_id, starts_at)
+SELECT m.id, h.id, DATE_TRUNC('day', NOW()) + make_interval(days => d, hours => 18 + 3 * (m.id % 2))
+FROM movies m
+JOIN halls h ON (m.id + h.id) % 2 = 0
+CROSS JOIN generate_series(1, 3) AS d
+WHERE m.archived_at IS NULL AND m.title IN ('Alien', 'Blade Runner', 'The Matrix')
+ON CONFLICT DO NOTHING;
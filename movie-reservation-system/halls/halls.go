@@ -0,0 +1,317 @@
+package halls
+
+import (
+	"database/sql"
+	"log/slog"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/database"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type Hall struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Layout
+}
+
+type HallBody struct {
+	Name string `json:"name"`
+	Layout
+}
+
+func loadCategories(hall *Hall) error {
+	rows, err := database.Db.Query(`
+		SELECT category, rows FROM hall_seat_categories WHERE hall_id = $1
+	`, hall.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	hall.Categories = make(map[string][]string)
+	for rows.Next() {
+		var category string
+		var categoryRows []string
+		err := rows.Scan(&category, pq.Array(&categoryRows))
+		if err != nil {
+			return err
+		}
+		hall.Categories[category] = categoryRows
+	}
+
+	return rows.Err()
+}
+
+func FindHallById(id int) *Hall {
+	row := database.Db.QueryRow(`
+		SELECT id, name, rows, columns, disabled_seats FROM halls WHERE id = $1
+	`, id)
+
+	var hall Hall
+	err := row.Scan(&hall.ID, &hall.Name, &hall.Rows, &hall.Columns, pq.Array(&hall.DisabledSeats))
+	if err != nil {
+		return nil
+	}
+
+	if err := loadCategories(&hall); err != nil {
+		slog.Error("loading seat categories", "hall_id", hall.ID, "error", err)
+		return nil
+	}
+
+	return &hall
+}
+
+func normalizeBody(body *HallBody) {
+	body.Name = strings.TrimSpace(body.Name)
+	if body.DisabledSeats == nil {
+		body.DisabledSeats = []string{}
+	}
+	for i, seat := range body.DisabledSeats {
+		body.DisabledSeats[i] = NormalizeSeat(seat)
+	}
+	for category, rows := range body.Categories {
+		for i, row := range rows {
+			rows[i] = NormalizeSeat(row)
+		}
+		body.Categories[category] = rows
+	}
+}
+
+func bindHallBody(c *gin.Context) (*HallBody, bool) {
+	var body HallBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return nil, false
+	}
+
+	normalizeBody(&body)
+
+	if body.Name == "" {
+		apierror.Abort(c, apierror.InvalidField("name", "is required"))
+		return nil, false
+	}
+
+	if err := body.Layout.Validate(); err != nil {
+		apierror.Abort(c, apierror.Invalid(err.Error()))
+		return nil, false
+	}
+
+	return &body, true
+}
+
+func saveCategories(tx *sql.Tx, hallId int, categories map[string][]string) error {
+	_, err := tx.Exec("DELETE FROM hall_seat_categories WHERE hall_id = $1", hallId)
+	if err != nil {
+		return err
+	}
+
+	for category, rows := range categories {
+		_, err = tx.Exec(`
+			INSERT INTO hall_seat_categories (hall_id, category, rows)
+			VALUES ($1, $2, $3)
+		`, hallId, strings.TrimSpace(category), pq.Array(rows))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetHalls(c *gin.Context) {
+	rows, err := database.Db.Query(`
+		SELECT id, name, rows, columns, disabled_seats FROM halls ORDER BY id
+	`)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	defer rows.Close()
+
+	halls := []Hall{}
+	for rows.Next() {
+		var hall Hall
+		err := rows.Scan(&hall.ID, &hall.Name, &hall.Rows, &hall.Columns, pq.Array(&hall.DisabledSeats))
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+		halls = append(halls, hall)
+	}
+
+	if err := rows.Err(); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	for i := range halls {
+		if err := loadCategories(&halls[i]); err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"halls": halls})
+}
+
+func GetHall(c *gin.Context) {
+	hallId, err := apierror.IDParam(c, "id", "hall")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	hall := FindHallById(hallId)
+	if hall == nil {
+		apierror.Abort(c, apierror.NotFound("hall not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hall": hall, "seats": hall.Seats()})
+}
+
+func CreateHall(c *gin.Context) {
+	body, ok := bindHallBody(c)
+	if !ok {
+		return
+	}
+
+	tx, err := database.Db.Begin()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var hallId int
+	err = tx.QueryRow(`
+		INSERT INTO halls (name, rows, columns, disabled_seats)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, body.Name, body.Rows, body.Columns, pq.Array(body.DisabledSeats)).Scan(&hallId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			apierror.Abort(c, apierror.Conflict("hall name already in use"))
+			return
+		}
+		apierror.Abort(c, err)
+		return
+	}
+
+	err = saveCategories(tx, hallId, body.Categories)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, FindHallById(hallId))
+}
+
+func UpdateHall(c *gin.Context) {
+	hallId, err := apierror.IDParam(c, "id", "hall")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	body, ok := bindHallBody(c)
+	if !ok {
+		return
+	}
+
+	tx, err := database.Db.Begin()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	// A layout change must not strand seats that were already sold for
+	// upcoming screenings in this hall.
+	rows, err := tx.Query(`
+		SELECT DISTINCT r.seat
+		FROM Reservation r
+		JOIN showtimes s ON r.showtime_id = s.id
+		WHERE s.hall_id = $1 AND s.starts_at > NOW() AND r.deleted_at IS NULL
+	`, hallId)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	var stranded []string
+	for rows.Next() {
+		var seat string
+		if err := rows.Scan(&seat); err != nil {
+			rows.Close()
+			apierror.Abort(c, err)
+			return
+		}
+		if !body.Layout.SeatExists(seat) {
+			stranded = append(stranded, seat)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if len(stranded) > 0 {
+		apierror.Abort(c, apierror.Conflict("layout removes seats reserved for upcoming showtimes").WithDetails(gin.H{"seats": stranded}))
+		return
+	}
+
+	res, err := tx.Exec(`
+		UPDATE halls
+		SET name = $2, rows = $3, columns = $4, disabled_seats = $5
+		WHERE id = $1
+	`, hallId, body.Name, body.Rows, body.Columns, pq.Array(body.DisabledSeats))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			apierror.Abort(c, apierror.Conflict("hall name already in use"))
+			return
+		}
+		apierror.Abort(c, err)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		apierror.Abort(c, apierror.NotFound("hall not found"))
+		return
+	}
+
+	err = saveCategories(tx, hallId, body.Categories)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, FindHallById(hallId))
+}
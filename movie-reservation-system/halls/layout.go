@@ -0,0 +1,195 @@
+package halls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_ROWS         = 26
+	MAX_COLUMNS      = 99
+	DEFAULT_CATEGORY = "standard"
+)
+
+// Seats are identified by their row letter followed by their column number,
+// e.g. "A1" is the first seat of the first row.
+type Seat struct {
+	ID       string `json:"id"`
+	Row      string `json:"row"`
+	Column   int    `json:"column"`
+	Category string `json:"category"`
+	Disabled bool   `json:"disabled"`
+}
+
+type Layout struct {
+	Rows          int                 `json:"rows"`
+	Columns       int                 `json:"columns"`
+	DisabledSeats []string            `json:"disabled_seats"`
+	Categories    map[string][]string `json:"categories"`
+}
+
+// NormalizeSeat returns the canonical form of a seat, e.g. "A5" for " a05 ",
+// so that the same seat is always stored and compared the same way. Values
+// that are not seats, like row letters, are only trimmed and upper cased.
+func NormalizeSeat(seat string) string {
+	seat = strings.ToUpper(strings.TrimSpace(seat))
+
+	row, column, err := parseSeat(seat)
+	if err != nil {
+		return seat
+	}
+
+	return row + strconv.Itoa(column)
+}
+
+// parseSeat accepts an upper case row letter followed by ASCII digits, with
+// a column of at least 1. Signs are rejected since strconv.Atoi would accept
+// them.
+func parseSeat(seat string) (string, int, error) {
+	if len(seat) < 2 || len(seat) > 4 {
+		return "", 0, fmt.Errorf("invalid seat %q", seat)
+	}
+
+	row := seat[:1]
+	if row[0] < 'A' || row[0] > 'Z' {
+		return "", 0, fmt.Errorf("invalid seat %q", seat)
+	}
+
+	for _, digit := range seat[1:] {
+		if digit < '0' || digit > '9' {
+			return "", 0, fmt.Errorf("invalid seat %q", seat)
+		}
+	}
+
+	column, err := strconv.Atoi(seat[1:])
+	if err != nil || column < 1 {
+		return "", 0, fmt.Errorf("invalid seat %q", seat)
+	}
+
+	return row, column, nil
+}
+
+func rowLetter(row int) string {
+	return string(rune('A' + row))
+}
+
+func (l Layout) Validate() error {
+	if l.Rows < 1 || l.Rows > MAX_ROWS {
+		return fmt.Errorf("rows must be between 1 and %d", MAX_ROWS)
+	}
+
+	if l.Columns < 1 || l.Columns > MAX_COLUMNS {
+		return fmt.Errorf("columns must be between 1 and %d", MAX_COLUMNS)
+	}
+
+	for _, seat := range l.DisabledSeats {
+		if !l.inBounds(NormalizeSeat(seat)) {
+			return fmt.Errorf("disabled seat %q is outside the hall", seat)
+		}
+	}
+
+	assigned := make(map[string]string)
+	for category, rows := range l.Categories {
+		if strings.TrimSpace(category) == "" {
+			return fmt.Errorf("category name is required")
+		}
+
+		for _, row := range rows {
+			row = NormalizeSeat(row)
+			if len(row) != 1 || row[0] < 'A' || int(row[0]-'A') >= l.Rows {
+				return fmt.Errorf("category %q has an invalid row %q", category, row)
+			}
+
+			if other, ok := assigned[row]; ok {
+				return fmt.Errorf("row %s is assigned to both %q and %q", row, other, category)
+			}
+			assigned[row] = category
+		}
+	}
+
+	return nil
+}
+
+func (l Layout) inBounds(seat string) bool {
+	row, column, err := parseSeat(seat)
+	if err != nil {
+		return false
+	}
+
+	return int(row[0]-'A') < l.Rows && column <= l.Columns
+}
+
+func (l Layout) isDisabled(seat string) bool {
+	for _, disabled := range l.DisabledSeats {
+		if NormalizeSeat(disabled) == seat {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l Layout) CategoryOf(seat string) string {
+	row, _, err := parseSeat(NormalizeSeat(seat))
+	if err != nil {
+		return ""
+	}
+
+	for category, rows := range l.Categories {
+		for _, r := range rows {
+			if NormalizeSeat(r) == row {
+				return category
+			}
+		}
+	}
+
+	return DEFAULT_CATEGORY
+}
+
+// SeatExists reports whether seat is part of the layout and can be sold.
+func (l Layout) SeatExists(seat string) bool {
+	seat = NormalizeSeat(seat)
+	return l.inBounds(seat) && !l.isDisabled(seat)
+}
+
+// ValidateSeats rejects seats that are malformed, outside the hall, disabled
+// or requested more than once.
+func (l Layout) ValidateSeats(seats []string) error {
+	seen := make(map[string]bool)
+	for _, seat := range seats {
+		normalized := NormalizeSeat(seat)
+		if seen[normalized] {
+			return fmt.Errorf("seat %s requested more than once", normalized)
+		}
+		seen[normalized] = true
+
+		if !l.inBounds(normalized) {
+			return fmt.Errorf("seat %q does not exist in this hall", seat)
+		}
+
+		if l.isDisabled(normalized) {
+			return fmt.Errorf("seat %s is not available in this hall", normalized)
+		}
+	}
+
+	return nil
+}
+
+func (l Layout) Seats() []Seat {
+	seats := make([]Seat, 0, l.Rows*l.Columns)
+	for row := 0; row < l.Rows; row++ {
+		for column := 1; column <= l.Columns; column++ {
+			id := rowLetter(row) + strconv.Itoa(column)
+			seats = append(seats, Seat{
+				ID:       id,
+				Row:      rowLetter(row),
+				Column:   column,
+				Category: l.CategoryOf(id),
+				Disabled: l.isDisabled(id),
+			})
+		}
+	}
+
+	return seats
+}
@@ -0,0 +1,40 @@
+package halls
+
+import "testing"
+
+func TestNormalizeSeat(t *testing.T) {
+	cases := map[string]string{
+		" a5 ": "A5",
+		"A05":  "A5",
+		"b12":  "B12",
+		"A+5":  "A+5",
+		"A-5":  "A-5",
+		"b":    "B",
+	}
+
+	for seat, expected := range cases {
+		if normalized := NormalizeSeat(seat); normalized != expected {
+			t.Errorf("NormalizeSeat(%q) = %q, expected %q", seat, normalized, expected)
+		}
+	}
+}
+
+func TestValidateSeatsRejectsMalformedSeats(t *testing.T) {
+	layout := Layout{Rows: 2, Columns: 9}
+
+	for _, seat := range []string{"A+5", "A-5", "A0", "A00", "A 5", "A5x", "AA", "A", "A0005"} {
+		if layout.SeatExists(seat) {
+			t.Errorf("expected %q not to exist", seat)
+		}
+		if err := layout.ValidateSeats([]string{seat}); err == nil {
+			t.Errorf("expected %q to be rejected", seat)
+		}
+	}
+
+	if err := layout.ValidateSeats([]string{"A5", "a05"}); err == nil {
+		t.Error("expected A5 and a05 to be the same seat")
+	}
+	if err := layout.ValidateSeats([]string{"a05", "B9"}); err != nil {
+		t.Errorf("expected valid seats, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PING_TIMEOUT bounds the database check so a hung database does not hang
+// the load balancer probe as well.
+const PING_TIMEOUT = 2 * time.Second
+
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Checker answers the liveness and readiness probes.
+type Checker struct {
+	db       Pinger
+	draining atomic.Bool
+}
+
+func NewChecker(db Pinger) *Checker {
+	return &Checker{db: db}
+}
+
+// Drain makes the readiness probe fail so the load balancer stops sending
+// traffic while in-flight requests finish.
+func (h *Checker) Drain() {
+	h.draining.Store(true)
+}
+
+// Healthz reports that the process is up. It does not touch the database so
+// a database outage does not get the API restarted.
+func (h *Checker) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the API can serve requests.
+func (h *Checker) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		apierror.Abort(c, apierror.Unavailable("shutting down", nil))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), PING_TIMEOUT)
+	defer cancel()
+
+	if err := h.db.PingContext(ctx); err != nil {
+		apierror.Abort(c, apierror.Unavailable("database unavailable", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type fakeDB struct {
+	err error
+}
+
+func (f *fakeDB) PingContext(ctx context.Context) error {
+	return f.err
+}
+
+func probe(checker *Checker, path string) int {
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/healthz", checker.Healthz)
+	router.GET("/readyz", checker.Readyz)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+	return res.Code
+}
+
+func TestReadyz(t *testing.T) {
+	db := &fakeDB{}
+	checker := NewChecker(db)
+
+	if code := probe(checker, "/readyz"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	db.err = errors.New("connection refused")
+	if code := probe(checker, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with the database down, got %d", code)
+	}
+	if code := probe(checker, "/healthz"); code != http.StatusOK {
+		t.Fatalf("expected the process to stay healthy, got %d", code)
+	}
+
+	db.err = nil
+	checker.Drain()
+	if code := probe(checker, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", code)
+	}
+}
@@ -0,0 +1,56 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HEADER          = "Idempotency-Key"
+	REPLAYED_HEADER = "Idempotency-Replayed"
+	MAX_KEY_LENGTH  = 255
+	DEFAULT_WINDOW  = 24 * time.Hour
+	// UNCOMMITTED_KEY flags a request that failed without changing anything.
+	UNCOMMITTED_KEY = "idempotency_uncommitted"
+)
+
+// Uncommitted reports that a failing request changed nothing, so that its
+// key is forgotten and a retry runs it again. Other server errors are stored
+// and replayed like any response.
+func Uncommitted(c *gin.Context) {
+	c.Set(UNCOMMITTED_KEY, true)
+}
+
+// HashRequest fingerprints a request so that a key reused for another
+// request can be told apart from a retry.
+func HashRequest(method string, path string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", method, path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// StartSweeper deletes expired keys every interval until the process exits.
+func StartSweeper(keys KeyRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			deleted, err := keys.DeleteExpired()
+			if err != nil {
+				slog.Error("deleting expired idempotency keys", "error", err)
+				continue
+			}
+
+			if deleted > 0 {
+				slog.Info("deleted expired idempotency keys", "count", deleted)
+			}
+		}
+	}()
+}
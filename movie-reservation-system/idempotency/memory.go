@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryKey struct {
+	userId int
+	key    string
+}
+
+// MemoryRepository keeps idempotency keys in memory. It is meant for tests
+// and local experiments, not for production.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	records map[memoryKey]*Record
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{records: make(map[memoryKey]*Record)}
+}
+
+func (r *MemoryRepository) Begin(record Record) (*Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := memoryKey{record.UserID, record.Key}
+	if existing, ok := r.records[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		result := *existing
+		return &result, nil
+	}
+
+	stored := record
+	stored.StatusCode = 0
+	r.records[id] = &stored
+	return nil, nil
+}
+
+func (r *MemoryRepository) Complete(userId int, key string, statusCode int, contentType string, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[memoryKey{userId, key}]
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte{}, body...)
+	return nil
+}
+
+func (r *MemoryRepository) Delete(userId int, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.records, memoryKey{userId, key})
+	return nil
+}
+
+func (r *MemoryRepository) DeleteExpired() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for id, record := range r.records {
+		if !record.ExpiresAt.After(now) {
+			delete(r.records, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
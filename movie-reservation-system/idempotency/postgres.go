@@ -0,0 +1,106 @@
+package idempotency
+
+import (
+	"database/sql"
+	"movie-reservation-system/database"
+)
+
+type PostgresRepository struct {
+	db *database.DB
+}
+
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func (r *PostgresRepository) Begin(record Record) (*Record, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND expires_at <= NOW()",
+		record.UserID, record.Key,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO NOTHING
+	`, record.UserID, record.Key, record.RequestHash, record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if inserted == 1 {
+		return nil, tx.Commit()
+	}
+
+	existing := Record{UserID: record.UserID, Key: record.Key}
+	var statusCode sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT request_hash, status_code, content_type, COALESCE(response_body, ''), expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, record.UserID, record.Key).Scan(
+		&existing.RequestHash,
+		&statusCode,
+		&existing.ContentType,
+		&existing.Body,
+		&existing.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+
+	return &existing, tx.Commit()
+}
+
+func (r *PostgresRepository) Complete(userId int, key string, statusCode int, contentType string, body []byte) error {
+	res, err := r.db.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = $3, content_type = $4, response_body = $5
+		WHERE user_id = $1 AND key = $2
+	`, userId, key, statusCode, contentType, body)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) Delete(userId int, key string) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2", userId, key)
+	return err
+}
+
+func (r *PostgresRepository) DeleteExpired() (int64, error) {
+	res, err := r.db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
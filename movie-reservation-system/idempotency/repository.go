@@ -0,0 +1,38 @@
+package idempotency
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("idempotency key not found")
+
+// Record is the stored outcome of the first request sent with a key.
+// StatusCode is 0 while that request is still being processed.
+type Record struct {
+	UserID      int
+	Key         string
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+func (r *Record) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// KeyRepository is the storage behind the idempotency middleware. Keys are
+// scoped to a user.
+type KeyRepository interface {
+	// Begin stores record as in progress, unless the user already has a
+	// live record for the key, which is returned instead. Expired records
+	// are replaced.
+	Begin(record Record) (*Record, error)
+	// Complete stores the response of an in progress record.
+	Complete(userId int, key string, statusCode int, contentType string, body []byte) error
+	// Delete forgets a key so that it can be retried.
+	Delete(userId int, key string) error
+	DeleteExpired() (int64, error)
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_TEXT = "text"
+)
+
+const (
+	REQUEST_ID_HEADER = "X-Request-ID"
+	// MAX_REQUEST_ID_LENGTH bounds request ids sent by clients, which end up
+	// in every log line of their request.
+	MAX_REQUEST_ID_LENGTH = 128
+)
+
+const REDACTED = "[REDACTED]"
+
+type contextKey struct{}
+
+// sensitiveKeys are attribute keys whose values never reach the logs.
+var sensitiveKeys = map[string]bool{
+	"password":        true,
+	"password_hash":   true,
+	"token":           true,
+	"refresh_token":   true,
+	"payment_token":   true,
+	"authorization":   true,
+	"cookie":          true,
+	"secret":          true,
+	"signature":       true,
+	"idempotency_key": true,
+}
+
+func isSensitive(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// redact hides sensitive attributes, wherever they are nested.
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if isSensitive(attr.Key) {
+		return slog.String(attr.Key, REDACTED)
+	}
+
+	return attr
+}
+
+// ParseLevel accepts debug, info, warn and error.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return level, fmt.Errorf("log level must be debug, info, warn or error, got %q", value)
+	}
+
+	return level, nil
+}
+
+// New builds a logger that redacts sensitive attributes.
+func New(w io.Writer, format string, level slog.Level) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	if format == FORMAT_TEXT {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+// FromContext returns the logger of the request, which carries its id, or
+// the default logger outside of requests.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// WithLogger stores logger in ctx for FromContext.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+func newRequestId() string {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(data)
+}
+
+// validRequestId only lets through ids that are safe to echo and log.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequestID reuses the X-Request-ID of the caller or makes one up, echoes it
+// in the response and stores a logger carrying it in the request context.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(REQUEST_ID_HEADER)
+		if !validRequestId(id) {
+			id = newRequestId()
+		}
+
+		c.Set("request_id", id)
+		c.Header(REQUEST_ID_HEADER, id)
+
+		logger := slog.Default().With("request_id", id)
+		c.Request = c.Request.WithContext(WithLogger(c.Request.Context(), logger))
+
+		c.Next()
+	}
+}
+
+// AccessLog logs one line per request once it has been handled. Query
+// strings are left out since they may carry tokens.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 {
+			level = slog.LevelWarn
+		}
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", c.Writer.Size(),
+			"client_ip", c.ClientIP(),
+		}
+
+		FromContext(c.Request.Context()).Log(c.Request.Context(), level, "request", attrs...)
+	}
+}
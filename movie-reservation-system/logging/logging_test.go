@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRedactsSensitiveFields(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, FORMAT_JSON, slog.LevelInfo)
+
+	logger.Info("login", "email", "ripley@example.com", "Password", "nostromo1", slog.Group("body", "refresh_token", "abc"))
+
+	if strings.Contains(out.String(), "nostromo1") || strings.Contains(out.String(), "abc") {
+		t.Fatalf("expected secrets to be redacted, got %s", out.String())
+	}
+	if !strings.Contains(out.String(), "ripley@example.com") {
+		t.Fatalf("expected other fields to be kept, got %s", out.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var out bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(New(&out, FORMAT_JSON, slog.LevelInfo))
+	defer slog.SetDefault(previous)
+
+	router := gin.New()
+	router.Use(RequestID(), AccessLog())
+	router.GET("/movies/:id", func(c *gin.Context) {
+		FromContext(c.Request.Context()).Info("handling")
+		c.Status(http.StatusNoContent)
+	})
+
+	cases := []struct {
+		sent  string
+		reuse bool
+	}{
+		{"abc-123", true},
+		{"bad id\nwith newline", false},
+		{strings.Repeat("a", MAX_REQUEST_ID_LENGTH+1), false},
+		{"", false},
+	}
+
+	for _, tc := range cases {
+		out.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/movies/1?token=secret", nil)
+		if tc.sent != "" {
+			req.Header.Set(REQUEST_ID_HEADER, tc.sent)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		id := res.Header().Get(REQUEST_ID_HEADER)
+		if id == "" || (id == tc.sent) != tc.reuse {
+			t.Fatalf("sent %q, got request id %q", tc.sent, id)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected a handler line and an access line, got %q", out.String())
+		}
+		for _, line := range lines {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry["request_id"] != id {
+				t.Fatalf("expected request id %s in %s", id, line)
+			}
+		}
+
+		if strings.Contains(out.String(), "secret") {
+			t.Fatalf("expected the query string to stay out of the logs, got %s", out.String())
+		}
+	}
+}
@@ -1,74 +1,555 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"movie-reservation-system/apierror"
 	"movie-reservation-system/auth"
+	"movie-reservation-system/config"
 	"movie-reservation-system/database"
+	"movie-reservation-system/halls"
+	"movie-reservation-system/health"
+	"movie-reservation-system/idempotency"
+	"movie-reservation-system/logging"
+	"movie-reservation-system/metrics"
 	"movie-reservation-system/middlewares"
 	"movie-reservation-system/movies"
+	"movie-reservation-system/notifications"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/pricing"
+	"movie-reservation-system/ratelimit"
 	"movie-reservation-system/reservation"
-	users "movie-reservation-system/users/admin"
+	"movie-reservation-system/showtimes"
+	"movie-reservation-system/users"
+	admin "movie-reservation-system/users/admin"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
-func loadEnvVariables() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+// newRouter builds the router with the middlewares every route goes through.
+// Environments without allowed origins get no CORS middleware, so browsers
+// on other origins are refused; cors.New panics on an empty allowlist.
+func newRouter(cfg *config.Config) (*gin.Engine, error) {
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("setting trusted proxies: %w", err)
+	}
+	router.Use(logging.RequestID(), logging.AccessLog(), metrics.Middleware())
+	router.Use(apierror.Middleware())
+
+	allowed := cfg.CurrentCORS()
+	if len(allowed.AllowOrigins) > 0 {
+		router.Use(cors.New(cors.Config{
+			AllowOrigins:     allowed.AllowOrigins,
+			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", idempotency.HEADER, logging.REQUEST_ID_HEADER},
+			ExposeHeaders:    []string{"Content-Length", idempotency.REPLAYED_HEADER, logging.REQUEST_ID_HEADER},
+			AllowCredentials: allowed.AllowCredentials,
+		}))
 	}
+
+	return router, nil
 }
 
-func startWebServer() {
-	router := gin.New()
+func startWebServer(cfg *config.Config, provider payments.Provider) {
+	userRepo := users.NewPostgresRepository(database.Db)
+	movieRepo := movies.NewPostgresRepository(database.Db)
+	reservationRepo := reservation.NewPostgresRepository(database.Db)
+	idempotencyKeys := idempotency.NewPostgresRepository(database.Db)
+	idempotencyWindow := cfg.IdempotencyWindow.Duration
+
+	limits := ratelimit.NewMemoryStore()
+	loginByIP := ratelimit.NewLimiter(limits, "login-ip:", auth.LOGIN_IP_LIMIT, auth.LOGIN_LIMIT_WINDOW)
+	loginByAccount := ratelimit.NewLimiter(limits, "login-account:", auth.LOGIN_ACCOUNT_LIMIT, auth.LOGIN_LIMIT_WINDOW)
+
+	loginLockout := auth.NewLoginLockout(limits)
+
+	authHandler := auth.NewHandler(userRepo, auth.NewPostgresRepository(database.Db), loginLockout)
+	userHandler := users.NewHandler(userRepo, loginLockout)
+	movieHandler := movies.NewHandler(movieRepo)
+	rules, err := pricing.NewRules(cfg.PricingHolidays)
+	if err != nil {
+		fatal("loading pricing rules", err)
+	}
+	location, err := cfg.Location()
+	if err != nil {
+		fatal("loading the timezone", err)
+	}
+	reservationHandler := reservation.NewHandler(reservationRepo, userRepo, provider, rules, cfg.CancellationCutoff.Duration, location)
+	adminHandler := admin.NewHandler(movieRepo, reservationRepo, location)
+
+	metrics.RegisterDBStats(metrics.Default, database.Db.DB)
 
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
+	router, err := newRouter(cfg)
+	if err != nil {
+		fatal("building the router", err)
+	}
 
-	router.POST("/auth/login", auth.HandleLogin)
-	router.GET("/movies", movies.GetMovies)
+	checker := health.NewChecker(database.Db)
+	router.GET("/healthz", checker.Healthz)
+	router.GET("/readyz", checker.Readyz)
+	// Scrapers cannot log in, so /metrics takes a static token and is not
+	// served at all without one.
+	if cfg.MetricsToken != "" {
+		router.GET("/metrics", metrics.RequireToken(cfg.MetricsToken), metrics.Handler)
+	}
+
+	router.GET("/.well-known/jwks.json", auth.HandleJWKS)
+	router.POST(
+		"/auth/login",
+		ratelimit.Middleware(loginByIP, ratelimit.ClientIP),
+		ratelimit.Middleware(loginByAccount, auth.LoginEmail),
+		authHandler.HandleLogin,
+	)
+	router.POST(
+		"/auth/register",
+		ratelimit.Middleware(loginByIP, ratelimit.ClientIP),
+		authHandler.HandleRegister,
+	)
+	router.POST("/auth/refresh", authHandler.HandleRefresh)
+	router.POST("/auth/logout", authHandler.HandleLogout)
+	router.POST(
+		"/auth/logout/all",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		authHandler.HandleLogoutAll,
+	)
+	router.GET("/movies", movieHandler.GetMovies)
+	router.GET("/movies/:id", movieHandler.GetMovie)
+	router.GET("/genres", movieHandler.GetGenres)
+	router.GET("/cast/:id", movieHandler.GetCastMember)
+	router.GET("/movie/:id/showtimes", showtimes.GetMovieShowtimes)
+	router.GET("/movie/:id/seats", reservationHandler.GetSeatAvailability)
+	router.GET("/showtimes/:id", showtimes.GetShowtime)
+	router.GET("/halls", halls.GetHalls)
+	router.GET("/halls/:id", halls.GetHall)
+	router.POST("/payments/webhook", reservationHandler.HandlePaymentWebhook)
 	router.POST(
 		"/movie/:id/reserve",
 		middlewares.JwtAuth(),
-		middlewares.ValidUser(),
-		reservation.ReserveMovie,
+		middlewares.ValidUser(userRepo),
+		middlewares.Idempotent(idempotencyKeys, idempotencyWindow),
+		reservationHandler.ReserveMovie,
+	)
+	router.POST(
+		"/movie/:id/hold",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.HoldSeats,
+	)
+	router.POST(
+		"/holds/:id/confirm",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		middlewares.Idempotent(idempotencyKeys, idempotencyWindow),
+		reservationHandler.ConfirmHold,
+	)
+	router.DELETE(
+		"/holds/:id",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.ReleaseHold,
+	)
+	router.GET(
+		"/user/me",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		userHandler.GetProfile,
+	)
+	router.PUT(
+		"/user/me",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		userHandler.UpdateProfile,
+	)
+	router.PUT(
+		"/user/me/password",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		userHandler.ChangePassword,
 	)
 	router.GET(
 		"/user/reservations",
 		middlewares.JwtAuth(),
-		middlewares.ValidUser(),
-		reservation.GetReservations,
+		middlewares.ValidUser(userRepo),
+		reservationHandler.GetReservations,
 	)
+	// The legacy path takes a booking id like /user/bookings/:id.
 	router.DELETE(
 		"/user/reservations/:id",
 		middlewares.JwtAuth(),
-		middlewares.ValidUser(),
-		reservation.CancelReservation,
+		middlewares.ValidUser(userRepo),
+		reservationHandler.CancelBooking,
+	)
+	router.GET(
+		"/user/bookings/:id",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.GetBooking,
+	)
+	router.POST(
+		"/movie/:id/waitlist",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.JoinWaitlist,
+	)
+	router.GET(
+		"/user/waitlist",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.GetWaitlist,
+	)
+	router.DELETE(
+		"/user/waitlist/:id",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.LeaveWaitlist,
+	)
+	router.DELETE(
+		"/user/bookings/:id",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.CancelBooking,
+	)
+	router.POST(
+		"/user/bookings/:id/cancel",
+		middlewares.JwtAuth(),
+		middlewares.ValidUser(userRepo),
+		reservationHandler.CancelBookingSeats,
 	)
 
 	router.GET(
 		"/movie/:id/reservations",
 		middlewares.JwtAuth(),
-		middlewares.ValidAdmin(),
-		users.GetAllMovieReservations,
+		middlewares.RequirePermission(userRepo, users.PERMISSION_RESERVATIONS_READ),
+		adminHandler.GetAllMovieReservations,
+	)
+	router.GET(
+		"/reports/reservations",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_REPORTS_READ),
+		adminHandler.GetReservationReport,
+	)
+	router.POST(
+		"/movies",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.CreateMovie,
+	)
+	router.PUT(
+		"/movies/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.UpdateMovie,
+	)
+	router.DELETE(
+		"/movies/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.DeleteMovie,
+	)
+	router.POST(
+		"/movies/:id/archive",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.ArchiveMovie,
+	)
+	router.DELETE(
+		"/movies/:id/archive",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.UnarchiveMovie,
+	)
+	router.PUT(
+		"/movies/:id/genres",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.SetMovieGenres,
+	)
+	router.PUT(
+		"/movies/:id/cast",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.SetMovieCast,
+	)
+	router.POST(
+		"/genres",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.CreateGenre,
+	)
+	router.PUT(
+		"/genres/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.UpdateGenre,
+	)
+	router.DELETE(
+		"/genres/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.DeleteGenre,
+	)
+	router.POST(
+		"/cast",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.CreateCastMember,
+	)
+	router.PUT(
+		"/cast/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.UpdateCastMember,
+	)
+	router.DELETE(
+		"/cast/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_MOVIES_WRITE),
+		adminHandler.DeleteCastMember,
+	)
+	router.POST(
+		"/halls",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_SHOWTIMES_WRITE),
+		halls.CreateHall,
+	)
+	router.PUT(
+		"/halls/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_SHOWTIMES_WRITE),
+		halls.UpdateHall,
+	)
+	router.POST(
+		"/showtimes",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_SHOWTIMES_WRITE),
+		showtimes.CreateShowtime,
+	)
+	router.DELETE(
+		"/showtimes/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_SHOWTIMES_WRITE),
+		showtimes.DeleteShowtime,
 	)
 
-	err := router.Run(":8080")
-	if err != nil {
-		fmt.Println(err)
+	router.GET(
+		"/roles",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_USERS_MANAGE),
+		userHandler.GetRoles,
+	)
+	router.GET(
+		"/users",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_USERS_MANAGE),
+		userHandler.GetUsers,
+	)
+	router.PUT(
+		"/users/:id/role",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_USERS_MANAGE),
+		userHandler.SetUserRole,
+	)
+	router.DELETE(
+		"/bookings/:id",
+		middlewares.JwtAuth(),
+		middlewares.RequirePermission(userRepo, users.PERMISSION_RESERVATIONS_REFUND),
+		reservationHandler.RefundBooking,
+	)
+
+	if err := serve(cfg, router, checker); err != nil {
+		fatal("server failed", err)
+	}
+}
+
+// serve runs the API until SIGINT or SIGTERM. Readiness fails first so the
+// load balancer stops routing, then in-flight requests, and the reservation
+// transactions they hold, get ShutdownTimeout to finish.
+func serve(cfg *config.Config, handler http.Handler, checker *health.Checker) error {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
 	}
+
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout.Duration.String())
+	checker.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+
+	if err := database.Db.Close(); err != nil {
+		return fmt.Errorf("closing the database: %w", err)
+	}
+
+	slog.Info("server stopped")
+	return nil
+}
+
+// runMigrateCommand handles `migrate [up|down [steps]|status|seed]`.
+func runMigrateCommand(args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		count, err := database.Db.MigrateUp()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed < 1 {
+				return fmt.Errorf("steps must be a positive number")
+			}
+			steps = parsed
+		}
+
+		count, err := database.Db.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migrations\n", count)
+	case "status":
+		statuses, err := database.Db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	case "seed":
+		if _, err := database.Db.MigrateUp(); err != nil {
+			return err
+		}
+
+		if err := database.Db.Seed(); err != nil {
+			return err
+		}
+		fmt.Println("Seed data loaded")
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or seed", command)
+	}
+
+	return nil
+}
+
+// newSender picks the notification sender of the configuration.
+func newSender(cfg config.Notifications) (notifications.Sender, error) {
+	if cfg.Sender == config.SENDER_SMTP {
+		return notifications.NewSMTPSender(notifications.SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.From,
+		}), nil
+	}
+
+	return notifications.OpenFileSender(cfg.File, cfg.From)
+}
+
+// fatal logs err and exits.
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
 }
 
 func main() {
-	loadEnvVariables()
-	database.Connect()
-	startWebServer()
+	if err := config.LoadDotEnv(); err != nil {
+		fatal("loading env file", err)
+	}
+
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("loading configuration", err)
+	}
+
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogFormat, level))
+	slog.Info("starting", "environment", cfg.Environment, "port", cfg.Port)
+
+	if err := database.Connect(cfg.Database.URL(), cfg.Database.ConnectAttempts); err != nil {
+		fatal("connecting to the database", err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrateCommand(args[1:]); err != nil {
+			fatal("migration failed", err)
+		}
+		return
+	}
+
+	// Set AUTO_MIGRATE=false to only migrate through the migrate command.
+	if cfg.AutoMigrate {
+		if _, err := database.Db.MigrateUp(); err != nil {
+			fatal("migration failed", err)
+		}
+	}
+
+	err = auth.Configure(auth.Settings{
+		Secret:          cfg.Auth.Secret,
+		KeysDir:         cfg.Auth.KeysDir,
+		SigningKid:      cfg.Auth.SigningKid,
+		Audience:        cfg.Auth.Audience,
+		AccessTokenTTL:  cfg.Auth.AccessTokenTTL.Duration,
+		RefreshTokenTTL: cfg.Auth.RefreshTokenTTL.Duration,
+	})
+	if err != nil {
+		fatal("loading signing keys", err)
+	}
+	provider, err := payments.NewProvider(cfg.Payments.Provider, cfg.Payments.WebhookSecret)
+	if err != nil {
+		fatal("loading payment provider", err)
+	}
+
+	sender, err := newSender(cfg.Notifications)
+	if err != nil {
+		fatal("opening notification sender", err)
+	}
+
+	reservation.StartHoldSweeper(reservation.NewPostgresRepository(database.Db), provider, time.Minute)
+	reservation.StartRefundSweeper(reservation.NewPostgresRepository(database.Db), provider, time.Minute)
+	notifications.StartWorker(notifications.NewWorker(notifications.NewPostgresRepository(database.Db), sender), cfg.Notifications.Interval.Duration)
+	idempotency.StartSweeper(idempotency.NewPostgresRepository(database.Db), time.Hour)
+	startWebServer(cfg, provider)
 }
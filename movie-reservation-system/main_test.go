@@ -0,0 +1,35 @@
+package main
+
+import (
+	"movie-reservation-system/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewRouterForEveryEnvironment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, environment := range []string{config.ENV_DEVELOPMENT, config.ENV_STAGING, config.ENV_PRODUCTION} {
+		cfg := config.Defaults()
+		cfg.Environment = environment
+
+		router, err := newRouter(&cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", environment, err)
+		}
+		router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		allowed := res.Header().Get("Access-Control-Allow-Origin") == "http://localhost:3000"
+		if allowed != (environment == config.ENV_DEVELOPMENT) {
+			t.Errorf("%s: unexpected CORS response %d %v", environment, res.Code, res.Header())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"database/sql"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// Default is the registry served by Handler.
+var Default = NewRegistry()
+
+var (
+	RequestDuration = NewHistogramVec("http_request_duration_seconds", "Time spent handling requests.", DEFAULT_BUCKETS, "method", "route", "status")
+	Conflicts       = NewCounterVec("http_conflicts_total", "Requests answered with 409 Conflict.", "method", "route")
+	Reservations    = NewCounterVec("reservations_total", "Bookings checked out, by the status they ended up in.", "status")
+	ReservedSeats   = NewCounterVec("reserved_seats_total", "Seats taken by checked out bookings.")
+	CanceledSeats   = NewCounterVec("canceled_seats_total", "Seats released by cancellations.")
+)
+
+func init() {
+	Default.Register(RequestDuration)
+	Default.Register(Conflicts)
+	Default.Register(Reservations)
+	Default.Register(ReservedSeats)
+	Default.Register(CanceledSeats)
+}
+
+// route labels requests by their route pattern rather than their path, so
+// ids do not blow up the number of series.
+func route(c *gin.Context) string {
+	if path := c.FullPath(); path != "" {
+		return path
+	}
+
+	return "unmatched"
+}
+
+// Middleware records the latency of every request and counts conflicts.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		RequestDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route(c), strconv.Itoa(status))
+		if status == http.StatusConflict {
+			Conflicts.Inc(c.Request.Method, route(c))
+		}
+	}
+}
+
+// RequireToken lets through the requests bearing token, like
+// "Authorization: Bearer <token>".
+func RequireToken(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+
+	return func(c *gin.Context) {
+		given := []byte(c.GetHeader("Authorization"))
+		if subtle.ConstantTimeCompare(given, expected) != 1 {
+			apierror.Abort(c, apierror.Unauthorized())
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Handler serves the Default registry in the Prometheus text format.
+func Handler(c *gin.Context) {
+	var body bytes.Buffer
+	Default.Write(&body)
+	c.Data(http.StatusOK, CONTENT_TYPE, body.Bytes())
+}
+
+// RegisterDBStats exposes the connection pool statistics of db.
+func RegisterDBStats(registry *Registry, db *sql.DB) {
+	registry.Register(NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	}))
+	registry.Register(NewGaugeFunc("db_open_connections", "Established connections, in use or idle.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	}))
+	registry.Register(NewGaugeFunc("db_in_use_connections", "Connections currently in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	}))
+	registry.Register(NewGaugeFunc("db_idle_connections", "Idle connections.", func() float64 {
+		return float64(db.Stats().Idle)
+	}))
+	registry.Register(NewCounterFunc("db_wait_count_total", "Connections waited for.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	}))
+	registry.Register(NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for connections.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	}))
+}
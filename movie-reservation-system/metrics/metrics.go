@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_BUCKETS are the latency buckets in seconds.
+var DEFAULT_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector is anything that writes metrics in the Prometheus text format.
+type Collector interface {
+	Write(w io.Writer)
+}
+
+// Registry holds the collectors exposed by /metrics.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(collector Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, collector)
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, collector := range collectors {
+		collector.Write(w)
+	}
+}
+
+// labelKey joins label values so they can key a map. Values cannot contain
+// the separator since they come from routes, methods and status codes.
+func labelKey(values []string) string {
+	return strings.Join(values, "\x00")
+}
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CounterVec is a counter split by labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	sets   map[string][]string
+}
+
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64), sets: make(map[string][]string)}
+}
+
+// Add increases the counter of the label values, given in the order of the
+// label names.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	key := labelKey(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] += delta
+	c.sets[key] = values
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value is meant for tests.
+func (c *CounterVec) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[labelKey(values)]
+}
+
+func (c *CounterVec) Write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, c.sets[key]), formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	values  []string
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// HistogramVec is a histogram split by labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	key := labelKey(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogram{values: values, buckets: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// Count is meant for tests.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if series, ok := h.series[labelKey(values)]; ok {
+		return series.count
+	}
+
+	return 0
+}
+
+func (h *HistogramVec) Write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, series.values, "le", formatFloat(bound)), series.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, series.values, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, series.values), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, series.values), series.count)
+	}
+}
+
+// GaugeFunc reads its value when scraped.
+type GaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+func NewGaugeFunc(name string, help string, value func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, value: value}
+}
+
+func (g *GaugeFunc) Write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.value()))
+}
+
+// CounterFunc reads a counter kept elsewhere, like the wait count of the
+// database pool, when scraped.
+type CounterFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+func NewCounterFunc(name string, help string, value func() float64) *CounterFunc {
+	return &CounterFunc{name: name, help: help, value: value}
+}
+
+func (c *CounterFunc) Write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", c.name, c.help, c.name, c.name, formatFloat(c.value()))
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bytes"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestWriteTextFormat(t *testing.T) {
+	registry := NewRegistry()
+	requests := NewCounterVec("requests_total", "Requests.", "route")
+	latency := NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1})
+	registry.Register(requests)
+	registry.Register(latency)
+
+	requests.Inc("/movies")
+	requests.Add(2, "/movies")
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	var out bytes.Buffer
+	registry.Write(&out)
+
+	for _, expected := range []string{
+		"# TYPE requests_total counter",
+		`requests_total{route="/movies"} 3`,
+		"# TYPE latency_seconds histogram",
+		`latency_seconds_bucket{le="0.1"} 0`,
+		`latency_seconds_bucket{le="1"} 1`,
+		`latency_seconds_bucket{le="+Inf"} 2`,
+		"latency_seconds_sum 3.5",
+		"latency_seconds_count 2",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(Middleware())
+	router.POST("/movie/:id/reserve", func(c *gin.Context) {
+		c.Status(http.StatusConflict)
+	})
+	router.GET("/metrics", Handler)
+
+	before := Conflicts.Value(http.MethodPost, "/movie/:id/reserve")
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/movie/7/reserve", nil))
+
+	if Conflicts.Value(http.MethodPost, "/movie/:id/reserve") != before+1 {
+		t.Fatal("expected the conflict to be counted under its route")
+	}
+	if RequestDuration.Count(http.MethodPost, "/movie/:id/reserve", "409") == 0 {
+		t.Fatal("expected the latency to be observed")
+	}
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(res.Body.String(), `http_conflicts_total{method="POST",route="/movie/:id/reserve"}`) {
+		t.Fatalf("expected the conflict counter, got:\n%s", res.Body)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/metrics", RequireToken("scrape-token"), Handler)
+
+	cases := map[string]int{
+		"":                    http.StatusUnauthorized,
+		"Bearer wrong-token":  http.StatusUnauthorized,
+		"scrape-token":        http.StatusUnauthorized,
+		"Bearer scrape-token": http.StatusOK,
+	}
+
+	for header, expected := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		if res.Code != expected {
+			t.Errorf("%q: expected %d, got %d", header, expected, res.Code)
+		}
+	}
+}
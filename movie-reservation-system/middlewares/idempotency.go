@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/idempotency"
+	"movie-reservation-system/logging"
+	"movie-reservation-system/users"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// Idempotent makes a route safe to retry. The first request sent with an
+// Idempotency-Key header is processed and its response stored for window;
+// retries with the same key get that response again without running the
+// handler. Reusing a key for a different request is rejected with 422, and a
+// retry arriving while the first request is still running gets 409. Server
+// errors are stored too, as the request may have taken effect before
+// failing, unless the handler reports it changed nothing with
+// idempotency.Uncommitted or panicked: then the key is forgotten so the
+// request can be retried. Requests without the header are not affected. It
+// must run after JwtAuth.
+func Idempotent(keys idempotency.KeyRepository, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotency.HEADER)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > idempotency.MAX_KEY_LENGTH {
+			apierror.Abort(c, apierror.BadRequest(fmt.Sprintf("%s must be at most %d characters", idempotency.HEADER, idempotency.MAX_KEY_LENGTH)))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierror.Abort(c, apierror.BadRequest("invalid body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		userId := users.ExtractUserIdFromClaims(c)
+		requestHash := idempotency.HashRequest(c.Request.Method, c.Request.URL.Path, body)
+		existing, err := keys.Begin(idempotency.Record{
+			UserID:      userId,
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   time.Now().Add(window),
+		})
+		if err != nil {
+			apierror.Abort(c, fmt.Errorf("storing idempotency key: %w", err))
+			return
+		}
+
+		if existing != nil {
+			replay(c, existing, requestHash)
+			return
+		}
+
+		// A panicking handler stores nothing, so the key is released for the
+		// retry rather than left in progress until it expires.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				forget(c, keys, userId, key)
+				panic(recovered)
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		// Errors are rendered here rather than by Errors so that they are
+		// recorded too.
+		apierror.Render(c)
+
+		if writer.Status() >= http.StatusInternalServerError && c.GetBool(idempotency.UNCOMMITTED_KEY) {
+			forget(c, keys, userId, key)
+			return
+		}
+
+		err = keys.Complete(userId, key, writer.Status(), writer.Header().Get("Content-Type"), writer.body.Bytes())
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("storing idempotent response", "error", err)
+		}
+	}
+}
+
+func forget(c *gin.Context, keys idempotency.KeyRepository, userId int, key string) {
+	if err := keys.Delete(userId, key); err != nil {
+		logging.FromContext(c.Request.Context()).Error("releasing idempotency key", "error", err)
+	}
+}
+
+func replay(c *gin.Context, record *idempotency.Record, requestHash string) {
+	if record.RequestHash != requestHash {
+		apierror.Abort(c, apierror.Unprocessable(fmt.Sprintf("%s was already used for a different request", idempotency.HEADER)))
+		return
+	}
+
+	if !record.Completed() {
+		apierror.Abort(c, apierror.Conflict("a request with this "+idempotency.HEADER+" is still being processed"))
+		return
+	}
+
+	c.Header(idempotency.REPLAYED_HEADER, "true")
+	c.Data(record.StatusCode, record.ContentType, record.Body)
+	c.Abort()
+}
@@ -0,0 +1,158 @@
+package middlewares
+
+import (
+	"fmt"
+	"io"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/idempotency"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func asUser(userId int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user", jwt.MapClaims{"_id": fmt.Sprint(userId), "role": "user"})
+		c.Next()
+	}
+}
+
+// newIdempotentRouter counts the reservations made through it. Bodies asking
+// to fail get a server error, reported as uncommitted when asked to, and
+// bodies asking to panic panic.
+func newIdempotentRouter(keys idempotency.KeyRepository, userId int, calls *int) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.RecoveryWithWriter(io.Discard), apierror.Middleware())
+	router.POST("/movie/:id/reserve", asUser(userId), Idempotent(keys, time.Hour), func(c *gin.Context) {
+		*calls++
+		var body struct {
+			Fail        bool `json:"fail"`
+			Uncommitted bool `json:"uncommitted"`
+			Panic       bool `json:"panic"`
+		}
+		c.ShouldBindJSON(&body)
+		if body.Panic {
+			panic("reservation failed")
+		}
+		if body.Uncommitted {
+			idempotency.Uncommitted(c)
+		}
+		if body.Fail {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "an error ocurred"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"reservation": *calls})
+	})
+	return router
+}
+
+func send(router *gin.Engine, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/movie/1/reserve", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotency.HEADER, key)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestIdempotentReplaysResponse(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(idempotency.NewMemoryRepository(), 1, &calls)
+
+	first := send(router, "abc", `{"seats":["A1"]}`)
+	retry := send(router, "abc", `{"seats":["A1"]}`)
+	if calls != 1 || retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected the first response to be replayed, got %d calls: %s then %s", calls, first.Body, retry.Body)
+	}
+
+	if retry.Header().Get(idempotency.REPLAYED_HEADER) != "true" || first.Header().Get(idempotency.REPLAYED_HEADER) != "" {
+		t.Fatalf("expected only the retry to be marked as replayed")
+	}
+
+	if res := send(router, "abc", `{"seats":["A2"]}`); res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a different body, got %d", res.Code)
+	}
+
+	send(router, "", `{"seats":["A1"]}`)
+	send(router, "", `{"seats":["A1"]}`)
+	if calls != 3 {
+		t.Fatalf("expected requests without a key to run, got %d calls", calls)
+	}
+}
+
+func TestIdempotentKeysAreScopedToUsers(t *testing.T) {
+	keys := idempotency.NewMemoryRepository()
+	calls := 0
+	send(newIdempotentRouter(keys, 1, &calls), "abc", `{}`)
+	send(newIdempotentRouter(keys, 2, &calls), "abc", `{}`)
+	if calls != 2 {
+		t.Fatalf("expected both users to be served, got %d calls", calls)
+	}
+}
+
+func TestIdempotentStoresServerErrors(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(idempotency.NewMemoryRepository(), 1, &calls)
+
+	send(router, "abc", `{"fail":true}`)
+	retry := send(router, "abc", `{"fail":true}`)
+	if calls != 1 || retry.Code != http.StatusInternalServerError || retry.Header().Get(idempotency.REPLAYED_HEADER) != "true" {
+		t.Fatalf("expected the server error to be replayed, got %d calls and %d", calls, retry.Code)
+	}
+}
+
+func TestIdempotentForgetsUncommittedErrors(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(idempotency.NewMemoryRepository(), 1, &calls)
+
+	send(router, "abc", `{"fail":true,"uncommitted":true}`)
+	send(router, "abc", `{"fail":true,"uncommitted":true}`)
+	if calls != 2 {
+		t.Fatalf("expected an uncommitted failure to be retried, got %d calls", calls)
+	}
+}
+
+func TestIdempotentForgetsPanics(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(idempotency.NewMemoryRepository(), 1, &calls)
+
+	if res := send(router, "abc", `{"panic":true}`); res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 for a panic, got %d", res.Code)
+	}
+
+	if res := send(router, "abc", `{"panic":true}`); res.Code != http.StatusInternalServerError || calls != 2 {
+		t.Fatalf("expected the key to be released after a panic, got %d calls and %d", calls, res.Code)
+	}
+}
+
+func TestIdempotentRejectsConcurrentRetries(t *testing.T) {
+	keys := idempotency.NewMemoryRepository()
+	hash := idempotency.HashRequest(http.MethodPost, "/movie/1/reserve", []byte(`{}`))
+	keys.Begin(idempotency.Record{UserID: 1, Key: "abc", RequestHash: hash, ExpiresAt: time.Now().Add(time.Hour)})
+
+	calls := 0
+	if res := send(newIdempotentRouter(keys, 1, &calls), "abc", `{}`); res.Code != http.StatusConflict || calls != 0 {
+		t.Fatalf("expected 409 while the first request runs, got %d", res.Code)
+	}
+}
+
+func TestIdempotentKeysExpire(t *testing.T) {
+	keys := idempotency.NewMemoryRepository()
+	keys.Begin(idempotency.Record{UserID: 1, Key: "abc", RequestHash: "old", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	calls := 0
+	if res := send(newIdempotentRouter(keys, 1, &calls), "abc", `{}`); res.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("expected an expired key to be reused, got %d", res.Code)
+	}
+}
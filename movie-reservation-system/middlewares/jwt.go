@@ -1,8 +1,8 @@
 package middlewares
 
 import (
+	"movie-reservation-system/apierror"
 	"movie-reservation-system/auth"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,8 +11,7 @@ func JwtAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, err := auth.TokenValid(c)
 		if err != nil {
-			c.String(http.StatusUnauthorized, "Unauthorized")
-			c.Abort()
+			apierror.Abort(c, apierror.Unauthorized())
 			return
 		}
 
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/users"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequirePermission(t *testing.T) {
+	repo := users.NewMemoryRepository()
+	repo.Create(&users.User{Name: "Ripley", Email: "ripley@example.com"})
+	repo.Create(&users.User{Name: "Bishop", Email: "bishop@example.com", Role: "manager"})
+
+	cases := []struct {
+		userId     int
+		permission string
+		expected   int
+	}{
+		{1, users.PERMISSION_REPORTS_READ, http.StatusForbidden},
+		{2, users.PERMISSION_REPORTS_READ, http.StatusOK},
+		{2, users.PERMISSION_USERS_MANAGE, http.StatusForbidden},
+		{3, users.PERMISSION_REPORTS_READ, http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		router := gin.New()
+		router.Use(apierror.Middleware())
+		router.GET("/reports", asUser(tc.userId), RequirePermission(repo, tc.permission), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/reports", nil))
+		if res.Code != tc.expected {
+			t.Errorf("user %d with %s: expected %d, got %d", tc.userId, tc.permission, tc.expected, res.Code)
+		}
+	}
+
+	// Role changes apply without a new token.
+	repo.SetRole(1, "admin")
+	router := gin.New()
+	router.GET("/reports", asUser(1), RequirePermission(repo, users.PERMISSION_REPORTS_READ), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/reports", nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200 after promotion, got %d", res.Code)
+	}
+}
@@ -1,40 +1,43 @@
 package middlewares
 
 import (
+	"movie-reservation-system/apierror"
 	"movie-reservation-system/users"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-func ValidUser() gin.HandlerFunc {
+func ValidUser(repo users.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIdInt := users.ExtractUserIdFromClaims(c)
-		user := users.FindUserById(userIdInt)
-		if user == nil {
-			c.String(http.StatusUnauthorized, "Unauthorized")
-			c.Abort()
+		_, err := repo.FindById(userIdInt)
+		if err != nil {
+			apierror.Abort(c, apierror.Unauthorized())
 			return
 		}
 		c.Next()
 	}
 }
 
-func ValidAdmin() gin.HandlerFunc {
+// RequirePermission lets the request through when the role of the caller
+// grants permission. The role is read from the database so changes apply to
+// tokens that were already issued.
+func RequirePermission(repo users.UserRepository, permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userIdInt := users.ExtractUserIdFromClaims(c)
-		error, role := users.ExtractRoleFromClaims(c)
+		user, err := repo.FindById(users.ExtractUserIdFromClaims(c))
+		if err != nil {
+			apierror.Abort(c, apierror.Unauthorized())
+			return
+		}
 
-		if error != nil {
-			c.String(http.StatusUnauthorized, "Unauthorized")
-			c.Abort()
+		role, err := repo.FindRole(user.Role)
+		if err != nil && err != users.ErrRoleNotFound {
+			apierror.Abort(c, err)
 			return
 		}
 
-		user := users.FindUserById(userIdInt)
-		if user == nil || user.Role != "admin" || role != "admin" {
-			c.String(http.StatusUnauthorized, "Unauthorized")
-			c.Abort()
+		if role == nil || !role.Can(permission) {
+			apierror.Abort(c, apierror.Forbidden("missing permission "+permission))
 			return
 		}
 		c.Next()
@@ -0,0 +1,445 @@
+package movies
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryMovie struct {
+	MovieInput
+	ID         int
+	ArchivedAt *time.Time
+	Scheduled  bool
+}
+
+// MemoryRepository keeps the catalog in memory. It is meant for tests and
+// local experiments, not for production.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	movies map[int]*memoryMovie
+	genres map[int]string
+	cast   map[int]string
+	nextId int
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		movies: make(map[int]*memoryMovie),
+		genres: make(map[int]string),
+		cast:   make(map[int]string),
+		nextId: 1,
+	}
+}
+
+// SetScheduled marks a movie as having showtimes or reservations, which the
+// Postgres repository finds out from other tables.
+func (r *MemoryRepository) SetScheduled(id int, scheduled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if movie, ok := r.movies[id]; ok {
+		movie.Scheduled = scheduled
+	}
+}
+
+func (r *MemoryRepository) newId() int {
+	id := r.nextId
+	r.nextId++
+	return id
+}
+
+func namedList(ids []int, names map[int]string) []Named {
+	seen := make(map[int]bool)
+	list := []Named{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			list = append(list, Named{ID: id, Name: names[id]})
+		}
+	}
+	sortNamed(list)
+
+	return list
+}
+
+func sortNamed(list []Named) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+}
+
+// movie must be called with the lock held.
+func (r *MemoryRepository) movie(m *memoryMovie) Movie {
+	return Movie{
+		ID:          m.ID,
+		Title:       m.Title,
+		Year:        m.Year,
+		Description: m.Description,
+		ImageUrl:    m.ImageUrl,
+		Genres:      namedList(m.GenreIDs, r.genres),
+		Cast:        namedList(m.CastIDs, r.cast),
+	}
+}
+
+func containsId(ids []int, id int) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches approximates the Postgres full-text search: every word of the
+// search must appear in the title or description.
+func (m *memoryMovie) matches(query MovieQuery) bool {
+	if m.ArchivedAt != nil {
+		return false
+	}
+
+	document := strings.ToLower(m.Title + " " + m.Description)
+	for _, word := range strings.Fields(strings.ToLower(query.Search)) {
+		if !strings.Contains(document, word) {
+			return false
+		}
+	}
+
+	return (query.GenreID == 0 || containsId(m.GenreIDs, query.GenreID)) &&
+		(query.CastID == 0 || containsId(m.CastIDs, query.CastID)) &&
+		(query.YearFrom == 0 || m.Year >= query.YearFrom) &&
+		(query.YearTo == 0 || m.Year <= query.YearTo)
+}
+
+// compareMovies orders a before b (-1) or after it (1) by the sort field,
+// then by id.
+func compareMovies(field string, a Cursor, b Cursor) int {
+	switch {
+	case field == "title" && a.Title != b.Title:
+		return strings.Compare(a.Title, b.Title)
+	case field == "year" && a.Year != b.Year:
+		if a.Year < b.Year {
+			return -1
+		}
+		return 1
+	case a.ID < b.ID:
+		return -1
+	case a.ID > b.ID:
+		return 1
+	}
+
+	return 0
+}
+
+func (r *MemoryRepository) List(query MovieQuery) ([]Movie, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	field, desc := sortField(query.Sort)
+	before := func(a Movie, b Movie) bool {
+		order := compareMovies(field, *NewCursor(query.Sort, a), *NewCursor(query.Sort, b))
+		if desc {
+			return order > 0
+		}
+		return order < 0
+	}
+
+	movies := []Movie{}
+	for _, movie := range r.movies {
+		if !movie.matches(query) {
+			continue
+		}
+
+		result := r.movie(movie)
+
+		if query.After != nil {
+			after := Movie{ID: query.After.ID, Title: query.After.Title, Year: query.After.Year}
+			if !before(after, result) {
+				continue
+			}
+		}
+
+		movies = append(movies, result)
+	}
+	sort.Slice(movies, func(i, j int) bool { return before(movies[i], movies[j]) })
+
+	if len(movies) > query.Limit {
+		movies = movies[:query.Limit]
+	}
+
+	return movies, nil
+}
+
+func (r *MemoryRepository) FindById(id int) (*Movie, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	movie, ok := r.movies[id]
+	if !ok || movie.ArchivedAt != nil {
+		return nil, ErrMovieNotFound
+	}
+
+	result := r.movie(movie)
+	return &result, nil
+}
+
+func (r *MemoryRepository) ListGenres() ([]Named, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	genres := []Named{}
+	for id, name := range r.genres {
+		genres = append(genres, Named{ID: id, Name: name})
+	}
+	sortNamed(genres)
+
+	return genres, nil
+}
+
+func (r *MemoryRepository) FindCastMember(id int) (*CastMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, ok := r.cast[id]
+	if !ok {
+		return nil, ErrCastMemberNotFound
+	}
+
+	member := CastMember{Named: Named{ID: id, Name: name}, Filmography: []Credit{}}
+	for _, movie := range r.movies {
+		if movie.ArchivedAt == nil && containsId(movie.CastIDs, id) {
+			member.Filmography = append(member.Filmography, Credit{ID: movie.ID, Title: movie.Title, Year: movie.Year})
+		}
+	}
+	sort.Slice(member.Filmography, func(i, j int) bool {
+		a, b := member.Filmography[i], member.Filmography[j]
+		if a.Year != b.Year {
+			return a.Year > b.Year
+		}
+		return a.ID > b.ID
+	})
+
+	return &member, nil
+}
+
+func (r *MemoryRepository) checkReferences(ids []int, names map[int]string) error {
+	for _, id := range ids {
+		if _, ok := names[id]; !ok {
+			return ErrUnknownReference
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) Create(movie MovieInput) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkReferences(movie.GenreIDs, r.genres); err != nil {
+		return 0, err
+	}
+	if err := r.checkReferences(movie.CastIDs, r.cast); err != nil {
+		return 0, err
+	}
+
+	id := r.newId()
+	r.movies[id] = &memoryMovie{MovieInput: movie, ID: id}
+
+	return id, nil
+}
+
+func (r *MemoryRepository) Update(id int, movie MovieInput) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.movies[id]
+	if !ok {
+		return ErrMovieNotFound
+	}
+
+	if err := r.checkReferences(movie.GenreIDs, r.genres); err != nil {
+		return err
+	}
+	if err := r.checkReferences(movie.CastIDs, r.cast); err != nil {
+		return err
+	}
+
+	if movie.GenreIDs == nil {
+		movie.GenreIDs = current.GenreIDs
+	}
+	if movie.CastIDs == nil {
+		movie.CastIDs = current.CastIDs
+	}
+	current.MovieInput = movie
+
+	return nil
+}
+
+func (r *MemoryRepository) SetArchived(id int, archived bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	movie, ok := r.movies[id]
+	if !ok || (movie.ArchivedAt != nil) == archived {
+		return ErrMovieNotFound
+	}
+
+	if archived {
+		now := time.Now()
+		movie.ArchivedAt = &now
+	} else {
+		movie.ArchivedAt = nil
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	movie, ok := r.movies[id]
+	if !ok {
+		return ErrMovieNotFound
+	}
+
+	if movie.Scheduled {
+		return ErrMovieScheduled
+	}
+
+	delete(r.movies, id)
+	return nil
+}
+
+func (r *MemoryRepository) SetGenres(id int, genreIds []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	movie, ok := r.movies[id]
+	if !ok {
+		return ErrMovieNotFound
+	}
+
+	if err := r.checkReferences(genreIds, r.genres); err != nil {
+		return err
+	}
+
+	movie.GenreIDs = genreIds
+	return nil
+}
+
+func (r *MemoryRepository) SetCast(id int, castIds []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	movie, ok := r.movies[id]
+	if !ok {
+		return ErrMovieNotFound
+	}
+
+	if err := r.checkReferences(castIds, r.cast); err != nil {
+		return err
+	}
+
+	movie.CastIDs = castIds
+	return nil
+}
+
+// Like the Postgres schema, only genre names are unique.
+func (r *MemoryRepository) createNamed(names map[int]string, name string, unique bool) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range names {
+		if unique && strings.EqualFold(existing, name) {
+			return 0, ErrNameTaken
+		}
+	}
+
+	id := r.newId()
+	names[id] = name
+	return id, nil
+}
+
+func (r *MemoryRepository) updateNamed(names map[int]string, id int, name string, unique bool, notFound error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := names[id]; !ok {
+		return notFound
+	}
+
+	for otherId, existing := range names {
+		if unique && otherId != id && strings.EqualFold(existing, name) {
+			return ErrNameTaken
+		}
+	}
+
+	names[id] = name
+	return nil
+}
+
+func removeId(ids []int, id int) []int {
+	kept := []int{}
+	for _, existing := range ids {
+		if existing != id {
+			kept = append(kept, existing)
+		}
+	}
+
+	return kept
+}
+
+func (r *MemoryRepository) CreateGenre(name string) (int, error) {
+	return r.createNamed(r.genres, name, true)
+}
+
+func (r *MemoryRepository) UpdateGenre(id int, name string) error {
+	return r.updateNamed(r.genres, id, name, true, ErrGenreNotFound)
+}
+
+func (r *MemoryRepository) DeleteGenre(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.genres[id]; !ok {
+		return ErrGenreNotFound
+	}
+
+	delete(r.genres, id)
+	for _, movie := range r.movies {
+		movie.GenreIDs = removeId(movie.GenreIDs, id)
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) CreateCastMember(name string) (int, error) {
+	return r.createNamed(r.cast, name, false)
+}
+
+func (r *MemoryRepository) UpdateCastMember(id int, name string) error {
+	return r.updateNamed(r.cast, id, name, false, ErrCastMemberNotFound)
+}
+
+func (r *MemoryRepository) DeleteCastMember(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.cast[id]; !ok {
+		return ErrCastMemberNotFound
+	}
+
+	delete(r.cast, id)
+	for _, movie := range r.movies {
+		movie.CastIDs = removeId(movie.CastIDs, id)
+	}
+
+	return nil
+}
@@ -1,68 +1,133 @@
 package movies
 
 import (
-	"movie-reservation-system/database"
+	"movie-reservation-system/apierror"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-const DEFAULT_ID = "0"
+// Named is a genre or a cast member as listed on a movie.
+type Named struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
 
 type Movie struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Year        int    `json:"year"`
-	Description string `json:"description"`
-	ImageUrl    string `json:"image_url"`
-	Genres      string `json:"genres"`
-	Cast        string `json:"cast"`
+	ID          int     `json:"id"`
+	Title       string  `json:"title"`
+	Year        int     `json:"year"`
+	Description string  `json:"description"`
+	ImageUrl    string  `json:"image_url"`
+	Genres      []Named `json:"genres"`
+	Cast        []Named `json:"cast"`
+}
+
+// Credit is a movie in the filmography of a cast member.
+type Credit struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Year  int    `json:"year"`
 }
 
-func GetMovies(c *gin.Context) {
-	lastIdParam := c.Query("last_id")
-	lastId := DEFAULT_ID
+type CastMember struct {
+	Named
+	Filmography []Credit `json:"filmography"`
+}
 
-	if lastIdParam != "" {
-		lastId = lastIdParam
+func orEmpty(list []Named) []Named {
+	if list == nil {
+		return []Named{}
 	}
 
-	query := `
-		SELECT
-			m.id,
-			m.title,
-			m.year,
-			m.description,
-			m.image_url,
-			STRING_AGG(DISTINCT g.name, ', ') AS genres,
-			STRING_AGG(DISTINCT c.name, ', ') AS cast
-			FROM 
-			(SELECT * FROM Movies WHERE id > $1 LIMIT 10) AS m
-			LEFT JOIN 
-			movies_genres mg ON m.id = mg.movie_id
-			LEFT JOIN 
-			genres g ON mg.genre_id = g.id
-			LEFT JOIN 
-			movies_casting ma ON m.id = ma.movie_id
-			LEFT JOIN 
-			casting c ON ma.casting_id = c.id
-			GROUP BY 
-			m.id, m.title, m.year, m.description, m.image_url
-		`
-
-	rows, err := database.Db.Query(query, lastId)
+	return list
+}
+
+type Handler struct {
+	movies MovieRepository
+}
+
+func NewHandler(movies MovieRepository) *Handler {
+	return &Handler{movies: movies}
+}
+
+// GetMovies lists the catalog. See ParseMovieQuery for the parameters. The
+// next_cursor of a page is null on the last page.
+func (h *Handler) GetMovies(c *gin.Context) {
+	query, err := ParseMovieQuery(c)
+	if err != nil {
+		apierror.Abort(c, apierror.Invalid(err.Error()))
+		return
+	}
+
+	// One extra movie tells whether there is a next page.
+	limit := query.Limit
+	query.Limit++
+
+	movies, err := h.movies.List(query)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	var nextCursor *string
+	if len(movies) > limit {
+		movies = movies[:limit]
+		cursor := NewCursor(query.Sort, movies[limit-1]).Encode()
+		nextCursor = &cursor
+	}
+
+	c.JSON(http.StatusOK, gin.H{"movies": movies, "next_cursor": nextCursor})
+}
+
+func (h *Handler) GetMovie(c *gin.Context) {
+	movieId, err := apierror.IDParam(c, "id", "movie")
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		apierror.Abort(c, err)
 		return
 	}
-	defer rows.Close()
 
-	var movies []Movie
-	var movie Movie
-	for rows.Next() {
-		rows.Scan(&movie.ID, &movie.Title, &movie.Year, &movie.Description, &movie.ImageUrl, &movie.Genres, &movie.Cast)
-		movies = append(movies, movie)
+	movie, err := h.movies.FindById(movieId)
+	if err == ErrMovieNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, movie)
+}
+
+func (h *Handler) GetGenres(c *gin.Context) {
+	genres, err := h.movies.ListGenres()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"genres": genres})
+}
+
+// GetCastMember returns a cast member with the movies they appear in, newest
+// first. Archived movies are left out.
+func (h *Handler) GetCastMember(c *gin.Context) {
+	castId, err := apierror.IDParam(c, "id", "cast member")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	member, err := h.movies.FindCastMember(castId)
+	if err == ErrCastMemberNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"movies": movies})
+	c.JSON(http.StatusOK, member)
 }
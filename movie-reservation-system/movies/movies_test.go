@@ -0,0 +1,224 @@
+package movies
+
+import (
+	"encoding/json"
+	"fmt"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func get(repo MovieRepository, path string) *httptest.ResponseRecorder {
+	handler := NewHandler(repo)
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/movies", handler.GetMovies)
+	router.GET("/movies/:id", handler.GetMovie)
+	router.GET("/genres", handler.GetGenres)
+	router.GET("/cast/:id", handler.GetCastMember)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+	return res
+}
+
+func getMovies(repo MovieRepository, query string) *httptest.ResponseRecorder {
+	return get(repo, "/movies"+query)
+}
+
+func TestGetMoviesPaginates(t *testing.T) {
+	repo := NewMemoryRepository()
+	for i := 0; i < PAGE_SIZE+2; i++ {
+		repo.Create(MovieInput{Title: fmt.Sprintf("Movie %d", i), Year: 2000})
+	}
+
+	var page struct {
+		Movies []Movie `json:"movies"`
+	}
+
+	res := getMovies(repo, "")
+	json.Unmarshal(res.Body.Bytes(), &page)
+	if res.Code != http.StatusOK || len(page.Movies) != PAGE_SIZE {
+		t.Fatalf("expected a full first page, got %d: %s", res.Code, res.Body)
+	}
+
+	lastId := page.Movies[len(page.Movies)-1].ID
+	res = getMovies(repo, fmt.Sprintf("?last_id=%d", lastId))
+	json.Unmarshal(res.Body.Bytes(), &page)
+	if len(page.Movies) != 2 || page.Movies[0].ID <= lastId {
+		t.Fatalf("expected the 2 remaining movies, got %s", res.Body)
+	}
+
+	res = getMovies(repo, "?last_id=abc")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid last_id, got %d", res.Code)
+	}
+}
+
+func TestGetMoviesHidesArchived(t *testing.T) {
+	repo := NewMemoryRepository()
+	genreId, _ := repo.CreateGenre("Horror")
+	castId, _ := repo.CreateCastMember("Sigourney Weaver")
+	alien, _ := repo.Create(MovieInput{Title: "Alien", Year: 1979, GenreIDs: []int{genreId}, CastIDs: []int{castId}})
+	aliens, _ := repo.Create(MovieInput{Title: "Aliens", Year: 1986})
+	repo.SetArchived(aliens, true)
+
+	var page struct {
+		Movies []Movie `json:"movies"`
+	}
+	json.Unmarshal(getMovies(repo, "").Body.Bytes(), &page)
+
+	if len(page.Movies) != 1 || page.Movies[0].ID != alien {
+		t.Fatalf("expected only the unarchived movie, got %+v", page.Movies)
+	}
+
+	expectedGenres := []Named{{ID: genreId, Name: "Horror"}}
+	expectedCast := []Named{{ID: castId, Name: "Sigourney Weaver"}}
+	if fmt.Sprint(page.Movies[0].Genres) != fmt.Sprint(expectedGenres) || fmt.Sprint(page.Movies[0].Cast) != fmt.Sprint(expectedCast) {
+		t.Fatalf("expected structured genres and cast, got %+v", page.Movies[0])
+	}
+}
+
+type moviePage struct {
+	Movies     []Movie `json:"movies"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+func newCatalog() *MemoryRepository {
+	repo := NewMemoryRepository()
+	horror, _ := repo.CreateGenre("Horror")
+	scifi, _ := repo.CreateGenre("Science Fiction")
+	weaver, _ := repo.CreateCastMember("Sigourney Weaver")
+	repo.Create(MovieInput{Title: "Alien", Year: 1979, Description: "A deadly creature stalks the crew of a spaceship", GenreIDs: []int{horror, scifi}, CastIDs: []int{weaver}})
+	repo.Create(MovieInput{Title: "Aliens", Year: 1986, Description: "Marines return to the moon", GenreIDs: []int{scifi}, CastIDs: []int{weaver}})
+	repo.Create(MovieInput{Title: "The Thing", Year: 1982, Description: "A creature imitates the crew of an Antarctic station", GenreIDs: []int{horror}})
+	repo.Create(MovieInput{Title: "Blade Runner", Year: 1982, Description: "Replicants on the run", GenreIDs: []int{scifi}})
+	return repo
+}
+
+func titles(page moviePage) string {
+	list := []string{}
+	for _, movie := range page.Movies {
+		list = append(list, movie.Title)
+	}
+	return fmt.Sprint(list)
+}
+
+func TestGetMoviesFilters(t *testing.T) {
+	repo := newCatalog()
+
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"?q=crew+creature", "[Alien The Thing]"},
+		{"?genre=1", "[Alien The Thing]"},
+		{"?cast=3", "[Alien Aliens]"},
+		{"?year_from=1980&year_to=1985", "[The Thing Blade Runner]"},
+		{"?genre=2&year_from=1980", "[Aliens Blade Runner]"},
+		{"?sort=-year", "[Aliens Blade Runner The Thing Alien]"},
+		{"?sort=title", "[Alien Aliens Blade Runner The Thing]"},
+	}
+
+	for _, tc := range cases {
+		var page moviePage
+		res := getMovies(repo, tc.query)
+		json.Unmarshal(res.Body.Bytes(), &page)
+		if res.Code != http.StatusOK || titles(page) != tc.expected {
+			t.Errorf("%s: expected %s, got %d %s", tc.query, tc.expected, res.Code, titles(page))
+		}
+	}
+}
+
+func TestGetMoviesCursor(t *testing.T) {
+	repo := newCatalog()
+
+	seen := []string{}
+	query := "?sort=-year&limit=1"
+	for i := 0; i < 10; i++ {
+		var page moviePage
+		res := getMovies(repo, query)
+		json.Unmarshal(res.Body.Bytes(), &page)
+		if res.Code != http.StatusOK || len(page.Movies) != 1 {
+			t.Fatalf("expected a page of 1, got %d: %s", res.Code, res.Body)
+		}
+
+		seen = append(seen, page.Movies[0].Title)
+		if page.NextCursor == nil {
+			break
+		}
+		query = "?sort=-year&limit=1&cursor=" + *page.NextCursor
+	}
+
+	if fmt.Sprint(seen) != "[Aliens Blade Runner The Thing Alien]" {
+		t.Fatalf("unexpected pages: %v", seen)
+	}
+
+	cursor := NewCursor("-year", Movie{ID: 2, Year: 1986}).Encode()
+	res := getMovies(repo, "?sort=title&cursor="+cursor)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a cursor of another sort, got %d", res.Code)
+	}
+
+	for _, query := range []string{"?cursor=garbage", "?sort=rating", "?limit=0", "?limit=51", "?year_from=2000&year_to=1990"} {
+		if res := getMovies(repo, query); res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, res.Code)
+		}
+	}
+}
+
+func TestGetMovie(t *testing.T) {
+	repo := newCatalog()
+	// Genres, cast and movies share the id sequence of the memory
+	// repository, so Alien is 4 and Aliens is 5.
+	skerritt, _ := repo.CreateCastMember("Tom Skerritt, Jr.")
+	repo.SetCast(4, []int{3, skerritt})
+
+	res := get(repo, "/movies/4")
+	var movie Movie
+	json.Unmarshal(res.Body.Bytes(), &movie)
+	if res.Code != http.StatusOK || movie.Title != "Alien" || len(movie.Genres) != 2 || len(movie.Cast) != 2 {
+		t.Fatalf("unexpected movie: %d %s", res.Code, res.Body)
+	}
+
+	if movie.Cast[1].Name != "Tom Skerritt, Jr." {
+		t.Fatalf("expected names with commas to survive, got %+v", movie.Cast)
+	}
+
+	repo.SetArchived(5, true)
+	for _, path := range []string{"/movies/5", "/movies/99"} {
+		if res := get(repo, path); res.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, res.Code)
+		}
+	}
+}
+
+func TestGetGenres(t *testing.T) {
+	res := get(newCatalog(), "/genres")
+	if res.Body.String() != `{"genres":[{"id":1,"name":"Horror"},{"id":2,"name":"Science Fiction"}]}` {
+		t.Fatalf("unexpected genres: %s", res.Body)
+	}
+}
+
+func TestGetCastMember(t *testing.T) {
+	repo := newCatalog()
+	repo.SetArchived(5, true)
+
+	res := get(repo, "/cast/3")
+	var member CastMember
+	json.Unmarshal(res.Body.Bytes(), &member)
+	if res.Code != http.StatusOK || member.Name != "Sigourney Weaver" || len(member.Filmography) != 1 || member.Filmography[0].Title != "Alien" {
+		t.Fatalf("unexpected cast member: %d %s", res.Code, res.Body)
+	}
+
+	if res := get(repo, "/cast/1"); res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a genre id, got %d", res.Code)
+	}
+}
@@ -0,0 +1,552 @@
+package movies
+
+import (
+	"database/sql"
+	"fmt"
+	"movie-reservation-system/database"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	db *database.DB
+}
+
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func pqErrorName(err error) string {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code.Name()
+	}
+
+	return ""
+}
+
+// SEARCH_DOCUMENT must match the expression of the movies_search_idx index.
+const SEARCH_DOCUMENT = "to_tsvector('english', title || ' ' || description)"
+
+// movieFilter builds the WHERE clause and ORDER BY of a movie query.
+func movieFilter(query MovieQuery) (string, string, []interface{}) {
+	conditions := []string{"archived_at IS NULL"}
+	args := []interface{}{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if query.Search != "" {
+		conditions = append(conditions, SEARCH_DOCUMENT+" @@ plainto_tsquery('english', "+arg(query.Search)+")")
+	}
+	if query.GenreID != 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM movies_genres WHERE movie_id = movies.id AND genre_id = "+arg(query.GenreID)+")")
+	}
+	if query.CastID != 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM movies_casting WHERE movie_id = movies.id AND casting_id = "+arg(query.CastID)+")")
+	}
+	if query.YearFrom != 0 {
+		conditions = append(conditions, "year >= "+arg(query.YearFrom))
+	}
+	if query.YearTo != 0 {
+		conditions = append(conditions, "year <= "+arg(query.YearTo))
+	}
+
+	field, desc := sortField(query.Sort)
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if query.After != nil {
+		switch field {
+		case "title":
+			conditions = append(conditions, fmt.Sprintf("(title, id) %s (%s, %s)", comparison, arg(query.After.Title), arg(query.After.ID)))
+		case "year":
+			conditions = append(conditions, fmt.Sprintf("(year, id) %s (%s, %s)", comparison, arg(query.After.Year), arg(query.After.ID)))
+		default:
+			conditions = append(conditions, fmt.Sprintf("id %s %s", comparison, arg(query.After.ID)))
+		}
+	}
+
+	orderBy := fmt.Sprintf("id %s", direction)
+	if field != "id" {
+		orderBy = fmt.Sprintf("%s %s, id %s", field, direction, direction)
+	}
+
+	return strings.Join(conditions, " AND "), orderBy, args
+}
+
+func (r *PostgresRepository) List(query MovieQuery) ([]Movie, error) {
+	where, orderBy, args := movieFilter(query)
+	args = append(args, query.Limit)
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT id, title, year, description, image_url
+		FROM movies
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d
+	`, where, orderBy, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []Movie{}
+	var movie Movie
+	for rows.Next() {
+		err := rows.Scan(&movie.ID, &movie.Title, &movie.Year, &movie.Description, &movie.ImageUrl)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, r.attachAssociations(movies)
+}
+
+// loadNamed returns the genres or cast members of each movie, by movie id and
+// ordered by name.
+func (r *PostgresRepository) loadNamed(t namedTable, movieIds []int) (map[int][]Named, error) {
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT j.movie_id, n.id, n.name
+		FROM %s j
+		JOIN %s n ON j.%s = n.id
+		WHERE j.movie_id = ANY($1)
+		ORDER BY n.name, n.id
+	`, t.joinTable, t.table, t.column), pq.Array(movieIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byMovie := make(map[int][]Named)
+	for rows.Next() {
+		var movieId int
+		var named Named
+		if err := rows.Scan(&movieId, &named.ID, &named.Name); err != nil {
+			return nil, err
+		}
+		byMovie[movieId] = append(byMovie[movieId], named)
+	}
+
+	return byMovie, rows.Err()
+}
+
+// attachAssociations fills the genres and cast of every movie with one query
+// per join table.
+func (r *PostgresRepository) attachAssociations(movies []Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	movieIds := []int{}
+	for _, movie := range movies {
+		movieIds = append(movieIds, movie.ID)
+	}
+
+	genres, err := r.loadNamed(genresTable, movieIds)
+	if err != nil {
+		return err
+	}
+
+	cast, err := r.loadNamed(castTable, movieIds)
+	if err != nil {
+		return err
+	}
+
+	for i := range movies {
+		movies[i].Genres = orEmpty(genres[movies[i].ID])
+		movies[i].Cast = orEmpty(cast[movies[i].ID])
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) FindById(id int) (*Movie, error) {
+	var movie Movie
+	err := r.db.QueryRow(`
+		SELECT id, title, year, description, image_url
+		FROM movies
+		WHERE id = $1 AND archived_at IS NULL
+	`, id).Scan(&movie.ID, &movie.Title, &movie.Year, &movie.Description, &movie.ImageUrl)
+	if err == sql.ErrNoRows {
+		return nil, ErrMovieNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	movies := []Movie{movie}
+	if err := r.attachAssociations(movies); err != nil {
+		return nil, err
+	}
+
+	return &movies[0], nil
+}
+
+func (r *PostgresRepository) ListGenres() ([]Named, error) {
+	rows, err := r.db.Query("SELECT id, name FROM genres ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []Named{}
+	var genre Named
+	for rows.Next() {
+		if err := rows.Scan(&genre.ID, &genre.Name); err != nil {
+			return nil, err
+		}
+		genres = append(genres, genre)
+	}
+
+	return genres, rows.Err()
+}
+
+func (r *PostgresRepository) FindCastMember(id int) (*CastMember, error) {
+	member := CastMember{Filmography: []Credit{}}
+	err := r.db.QueryRow("SELECT id, name FROM casting WHERE id = $1", id).Scan(&member.ID, &member.Name)
+	if err == sql.ErrNoRows {
+		return nil, ErrCastMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT m.id, m.title, m.year
+		FROM movies_casting mc
+		JOIN movies m ON mc.movie_id = m.id
+		WHERE mc.casting_id = $1 AND m.archived_at IS NULL
+		ORDER BY m.year DESC, m.id DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credit Credit
+	for rows.Next() {
+		if err := rows.Scan(&credit.ID, &credit.Title, &credit.Year); err != nil {
+			return nil, err
+		}
+		member.Filmography = append(member.Filmography, credit)
+	}
+
+	return &member, rows.Err()
+}
+
+// replaceAssociations swaps every row of a movie in a join table (genres or
+// cast) for the given ids.
+func replaceAssociations(tx *sql.Tx, table string, column string, movieId int, ids []int) error {
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE movie_id = $1", table), movieId)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		_, err = tx.Exec(
+			fmt.Sprintf("INSERT INTO %s (movie_id, %s) VALUES ($1, $2)", table, column),
+			movieId,
+			id,
+		)
+		if pqErrorName(err) == "foreign_key_violation" {
+			return ErrUnknownReference
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func affectedOrNotFound(res sql.Result, notFound error) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) Create(movie MovieInput) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var movieId int
+	err = tx.QueryRow(`
+		INSERT INTO movies (title, year, description, image_url)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, movie.Title, movie.Year, movie.Description, movie.ImageUrl).Scan(&movieId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = replaceAssociations(tx, "movies_genres", "genre_id", movieId, movie.GenreIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	err = replaceAssociations(tx, "movies_casting", "casting_id", movieId, movie.CastIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	return movieId, tx.Commit()
+}
+
+func (r *PostgresRepository) Update(id int, movie MovieInput) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE movies
+		SET title = $2, year = $3, description = $4, image_url = $5
+		WHERE id = $1
+	`, id, movie.Title, movie.Year, movie.Description, movie.ImageUrl)
+	if err != nil {
+		return err
+	}
+
+	err = affectedOrNotFound(res, ErrMovieNotFound)
+	if err != nil {
+		return err
+	}
+
+	if movie.GenreIDs != nil {
+		err = replaceAssociations(tx, "movies_genres", "genre_id", id, movie.GenreIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if movie.CastIDs != nil {
+		err = replaceAssociations(tx, "movies_casting", "casting_id", id, movie.CastIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) SetArchived(id int, archived bool) error {
+	query := "UPDATE movies SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL"
+	if !archived {
+		query = "UPDATE movies SET archived_at = NULL WHERE id = $1 AND archived_at IS NOT NULL"
+	}
+
+	res, err := r.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	return affectedOrNotFound(res, ErrMovieNotFound)
+}
+
+func (r *PostgresRepository) Delete(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var scheduled bool
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM showtimes WHERE movie_id = $1)
+			OR EXISTS (SELECT 1 FROM Reservation WHERE movie_id = $1)
+	`, id).Scan(&scheduled)
+	if err != nil {
+		return err
+	}
+
+	if scheduled {
+		return ErrMovieScheduled
+	}
+
+	for _, table := range []string{"movies_genres", "movies_casting"} {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE movie_id = $1", table), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM movies WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	err = affectedOrNotFound(res, ErrMovieNotFound)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) setAssociations(table string, column string, id int, ids []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM movies WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrMovieNotFound
+	}
+
+	err = replaceAssociations(tx, table, column, id, ids)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) SetGenres(id int, genreIds []int) error {
+	return r.setAssociations("movies_genres", "genre_id", id, genreIds)
+}
+
+func (r *PostgresRepository) SetCast(id int, castIds []int) error {
+	return r.setAssociations("movies_casting", "casting_id", id, castIds)
+}
+
+// Genres and cast members are both plain named rows referenced from a movies
+// join table, so they share the queries below.
+type namedTable struct {
+	table     string
+	joinTable string
+	column    string
+	notFound  error
+}
+
+var genresTable = namedTable{
+	table:     "genres",
+	joinTable: "movies_genres",
+	column:    "genre_id",
+	notFound:  ErrGenreNotFound,
+}
+
+var castTable = namedTable{
+	table:     "casting",
+	joinTable: "movies_casting",
+	column:    "casting_id",
+	notFound:  ErrCastMemberNotFound,
+}
+
+func (r *PostgresRepository) createNamed(t namedTable, name string) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		fmt.Sprintf("INSERT INTO %s (name) VALUES ($1) RETURNING id", t.table),
+		name,
+	).Scan(&id)
+	if pqErrorName(err) == "unique_violation" {
+		return 0, ErrNameTaken
+	}
+
+	return id, err
+}
+
+func (r *PostgresRepository) updateNamed(t namedTable, id int, name string) error {
+	res, err := r.db.Exec(fmt.Sprintf("UPDATE %s SET name = $2 WHERE id = $1", t.table), id, name)
+	if pqErrorName(err) == "unique_violation" {
+		return ErrNameTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	return affectedOrNotFound(res, t.notFound)
+}
+
+// deleteNamed removes the row and detaches it from every movie.
+func (r *PostgresRepository) deleteNamed(t namedTable, id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = $1", t.joinTable, t.column), id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1", t.table), id)
+	if err != nil {
+		return err
+	}
+
+	err = affectedOrNotFound(res, t.notFound)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) CreateGenre(name string) (int, error) {
+	return r.createNamed(genresTable, name)
+}
+
+func (r *PostgresRepository) UpdateGenre(id int, name string) error {
+	return r.updateNamed(genresTable, id, name)
+}
+
+func (r *PostgresRepository) DeleteGenre(id int) error {
+	return r.deleteNamed(genresTable, id)
+}
+
+func (r *PostgresRepository) CreateCastMember(name string) (int, error) {
+	return r.createNamed(castTable, name)
+}
+
+func (r *PostgresRepository) UpdateCastMember(id int, name string) error {
+	return r.updateNamed(castTable, id, name)
+}
+
+func (r *PostgresRepository) DeleteCastMember(id int) error {
+	return r.deleteNamed(castTable, id)
+}
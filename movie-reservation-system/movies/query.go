@@ -0,0 +1,158 @@
+package movies
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PAGE_SIZE     = 10
+	MAX_PAGE_SIZE = 50
+	DEFAULT_SORT  = "id"
+)
+
+// Sort orders accepted by GET /movies. A leading "-" sorts descending. Ties
+// are broken by id in the same direction so every order is total.
+var SORT_ORDERS = map[string]bool{
+	"id":     true,
+	"-id":    true,
+	"title":  true,
+	"-title": true,
+	"year":   true,
+	"-year":  true,
+}
+
+// Cursor is the position after the last movie of a page. It carries the sort
+// it was produced for, so it cannot be replayed against another order.
+type Cursor struct {
+	Sort  string `json:"s"`
+	ID    int    `json:"id"`
+	Title string `json:"t,omitempty"`
+	Year  int    `json:"y,omitempty"`
+}
+
+type MovieQuery struct {
+	Search   string
+	GenreID  int
+	CastID   int
+	YearFrom int
+	YearTo   int
+	Sort     string
+	Limit    int
+	After    *Cursor
+}
+
+// sortField returns the column the sort is on and whether it is descending.
+func sortField(sort string) (string, bool) {
+	return strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+}
+
+func NewCursor(sort string, movie Movie) *Cursor {
+	cursor := &Cursor{Sort: sort, ID: movie.ID}
+	switch field, _ := sortField(sort); field {
+	case "title":
+		cursor.Title = movie.Title
+	case "year":
+		cursor.Year = movie.Year
+	}
+
+	return cursor
+}
+
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || !SORT_ORDERS[cursor.Sort] {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &cursor, nil
+}
+
+func intQuery(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+
+	return number, nil
+}
+
+// ParseMovieQuery reads the search, filter, sort and paging parameters of
+// GET /movies. The legacy last_id parameter is still accepted for the default
+// sort.
+func ParseMovieQuery(c *gin.Context) (MovieQuery, error) {
+	query := MovieQuery{
+		Search: strings.TrimSpace(c.Query("q")),
+		Sort:   c.DefaultQuery("sort", DEFAULT_SORT),
+		Limit:  PAGE_SIZE,
+	}
+
+	if !SORT_ORDERS[query.Sort] {
+		return query, fmt.Errorf("sort must be one of id, title or year, optionally prefixed with -")
+	}
+
+	var err error
+	for name, target := range map[string]*int{
+		"genre":     &query.GenreID,
+		"cast":      &query.CastID,
+		"year_from": &query.YearFrom,
+		"year_to":   &query.YearTo,
+		"limit":     &query.Limit,
+	} {
+		if c.Query(name) == "" {
+			continue
+		}
+
+		*target, err = intQuery(c, name)
+		if err != nil {
+			return query, err
+		}
+	}
+
+	if query.Limit < 1 || query.Limit > MAX_PAGE_SIZE {
+		return query, fmt.Errorf("limit must be between 1 and %d", MAX_PAGE_SIZE)
+	}
+
+	if query.YearFrom != 0 && query.YearTo != 0 && query.YearFrom > query.YearTo {
+		return query, fmt.Errorf("year_from must not be after year_to")
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		query.After, err = DecodeCursor(value)
+		if err != nil {
+			return query, err
+		}
+
+		if query.After.Sort != query.Sort {
+			return query, fmt.Errorf("cursor was issued for sort %s", query.After.Sort)
+		}
+	} else if c.Query("last_id") != "" && query.Sort == DEFAULT_SORT {
+		lastId, err := intQuery(c, "last_id")
+		if err != nil {
+			return query, err
+		}
+		query.After = &Cursor{Sort: DEFAULT_SORT, ID: lastId}
+	}
+
+	return query, nil
+}
@@ -0,0 +1,52 @@
+package movies
+
+import "errors"
+
+var (
+	ErrMovieNotFound      = errors.New("movie not found")
+	ErrMovieScheduled     = errors.New("movie has showtimes or reservations, archive it instead")
+	ErrUnknownReference   = errors.New("unknown genre or cast member")
+	ErrGenreNotFound      = errors.New("genre not found")
+	ErrCastMemberNotFound = errors.New("cast member not found")
+	ErrNameTaken          = errors.New("name already exists")
+)
+
+// MovieInput holds the editable fields of a movie. A nil GenreIDs or CastIDs
+// leaves the current associations untouched on update.
+type MovieInput struct {
+	Title       string
+	Year        int
+	Description string
+	ImageUrl    string
+	GenreIDs    []int
+	CastIDs     []int
+}
+
+// MovieRepository is the storage behind the public catalog and the admin
+// movie, genre and cast endpoints.
+type MovieRepository interface {
+	// List returns up to query.Limit movies that are not archived and match
+	// the query, in the query sort order and after query.After.
+	List(query MovieQuery) ([]Movie, error)
+	// FindById returns ErrMovieNotFound for archived movies too.
+	FindById(id int) (*Movie, error)
+	ListGenres() ([]Named, error)
+	FindCastMember(id int) (*CastMember, error)
+
+	Create(movie MovieInput) (int, error)
+	Update(id int, movie MovieInput) error
+	SetArchived(id int, archived bool) error
+	// Delete returns ErrMovieScheduled when the movie has showtimes or
+	// reservations.
+	Delete(id int) error
+	SetGenres(id int, genreIds []int) error
+	SetCast(id int, castIds []int) error
+
+	CreateGenre(name string) (int, error)
+	UpdateGenre(id int, name string) error
+	DeleteGenre(id int) error
+
+	CreateCastMember(name string) (int, error)
+	UpdateCastMember(id int, name string) error
+	DeleteCastMember(id int) error
+}
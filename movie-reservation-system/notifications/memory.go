@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryNotification struct {
+	Notification
+	NextAttemptAt time.Time
+}
+
+// MemoryRepository keeps the outbox in memory. It is meant for tests and
+// local experiments, not for production.
+type MemoryRepository struct {
+	mu            sync.Mutex
+	notifications map[int]*memoryNotification
+	nextId        int
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{notifications: make(map[int]*memoryNotification), nextId: 1}
+}
+
+// Queue stores a pending notification and sets its ID, unless one with the
+// same DedupKey was queued before. It reports whether it was stored.
+func (r *MemoryRepository) Queue(notification *Notification) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if notification.DedupKey != "" {
+		for _, existing := range r.notifications {
+			if existing.DedupKey == notification.DedupKey {
+				return false
+			}
+		}
+	}
+
+	notification.ID = r.nextId
+	notification.Status = STATUS_PENDING
+	notification.CreatedAt = time.Now()
+	r.nextId++
+
+	r.notifications[notification.ID] = &memoryNotification{Notification: *notification, NextAttemptAt: notification.CreatedAt}
+	return true
+}
+
+// List returns every notification in the order they were queued.
+func (r *MemoryRepository) List() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := []Notification{}
+	for _, notification := range r.notifications {
+		list = append(list, notification.Notification)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list
+}
+
+func (r *MemoryRepository) Claim(limit int, lease time.Duration) ([]Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	due := []*memoryNotification{}
+	for _, notification := range r.notifications {
+		if notification.Status == STATUS_PENDING && !notification.NextAttemptAt.After(now) {
+			due = append(due, notification)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	claimed := []Notification{}
+	for _, notification := range due {
+		if len(claimed) == limit {
+			break
+		}
+
+		notification.Attempts++
+		notification.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, notification.Notification)
+	}
+
+	return claimed, nil
+}
+
+func (r *MemoryRepository) MarkSent(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if notification, ok := r.notifications[id]; ok {
+		notification.Status = STATUS_SENT
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) MarkFailed(id int, reason string, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	notification, ok := r.notifications[id]
+	if !ok {
+		return nil
+	}
+
+	notification.LastError = reason
+	if retryAt.IsZero() {
+		notification.Status = STATUS_FAILED
+	} else {
+		notification.NextAttemptAt = retryAt
+	}
+
+	return nil
+}
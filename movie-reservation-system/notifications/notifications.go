@@ -0,0 +1,124 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	KIND_RESERVATION_CONFIRMED = "reservation_confirmed"
+	KIND_RESERVATION_CANCELED  = "reservation_canceled"
+	KIND_SHOWTIME_REMINDER     = "showtime_reminder"
+	KIND_PAYMENT_FAILED        = "payment_failed"
+)
+
+const (
+	STATUS_PENDING = "pending"
+	STATUS_SENT    = "sent"
+	STATUS_FAILED  = "failed"
+)
+
+// DATE_LAYOUT is how showtimes are written in messages.
+const DATE_LAYOUT = "Monday 2 January 2006 at 15:04 MST"
+
+var ErrUnknownKind = errors.New("unknown notification kind")
+
+// Data is what the templates are rendered with. It is stored with the
+// notification, so a message describes the booking as it was when the
+// notification was queued.
+type Data struct {
+	// Name is the name of the recipient, filled in when rendering.
+	Name      string    `json:"-"`
+	BookingID string    `json:"booking_id"`
+	Title     string    `json:"title"`
+	StartsAt  time.Time `json:"starts_at"`
+	Seats     []string  `json:"seats"`
+	// Total and Refund are in cents.
+	Total  int `json:"total_cents,omitempty"`
+	Refund int `json:"refund_cents,omitempty"`
+}
+
+// Notification is an outbox entry, addressed to the email the user had when
+// it was queued.
+type Notification struct {
+	ID            int
+	UserID        int
+	Kind          string
+	Recipient     string
+	RecipientName string
+	Data          Data
+	Status        string
+	Attempts      int
+	LastError     string
+	// DedupKey, when set, keeps the notification from being queued twice.
+	DedupKey  string
+	CreatedAt time.Time
+}
+
+// Message is a rendered notification, ready to be sent.
+type Message struct {
+	To      string
+	ToName  string
+	Subject string
+	Body    string
+}
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.UTC().Format(DATE_LAYOUT)
+	},
+	"seats": func(seats []string) string {
+		return strings.Join(seats, ", ")
+	},
+	"money": func(cents int) string {
+		return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+	},
+}).ParseFS(templateFiles, "templates/*.tmpl"))
+
+func execute(name string, data Data) (string, error) {
+	var out bytes.Buffer
+	if err := templates.ExecuteTemplate(&out, name, data); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// Render builds the message of a notification from the templates of its
+// kind.
+func Render(notification Notification) (Message, error) {
+	if templates.Lookup(notification.Kind+".subject") == nil {
+		return Message{}, fmt.Errorf("%w: %q", ErrUnknownKind, notification.Kind)
+	}
+
+	data := notification.Data
+	data.Name = notification.RecipientName
+	if data.Name == "" {
+		data.Name = "there"
+	}
+
+	subject, err := execute(notification.Kind+".subject", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	body, err := execute(notification.Kind+".body", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      notification.Recipient,
+		ToName:  notification.RecipientName,
+		Subject: strings.TrimSpace(subject),
+		Body:    strings.TrimLeft(body, "\n"),
+	}, nil
+}
@@ -0,0 +1,191 @@
+package notifications
+
+import (
+	"bytes"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeSender struct {
+	sent []Message
+	err  error
+}
+
+func (s *fakeSender) Send(message Message) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.sent = append(s.sent, message)
+	return nil
+}
+
+func testNotification(kind string) *Notification {
+	return &Notification{
+		UserID:        1,
+		Kind:          kind,
+		Recipient:     "ripley@example.com",
+		RecipientName: "Ripley",
+		Data: Data{
+			BookingID: "b-1",
+			Title:     "Alien",
+			StartsAt:  time.Date(2030, 5, 25, 20, 30, 0, 0, time.UTC),
+			Seats:     []string{"A1", "A2"},
+			Total:     2450,
+			Refund:    1200,
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		kind    string
+		subject string
+		body    []string
+	}{
+		{KIND_RESERVATION_CONFIRMED, "Your tickets for Alien", []string{"Hi Ripley,", "A1, A2", "24.50", "b-1", "Saturday 25 May 2030 at 20:30 UTC"}},
+		{KIND_RESERVATION_CANCELED, "Seats canceled for Alien", []string{"A1, A2", "12.00 will be refunded"}},
+		{KIND_PAYMENT_FAILED, "Your payment for Alien did not go through", []string{"seats were released", "A1, A2"}},
+		{KIND_SHOWTIME_REMINDER, "Reminder: Alien starts Saturday 25 May 2030 at 20:30 UTC", []string{"coming up", "A1, A2"}},
+	}
+
+	for _, tc := range cases {
+		message, err := Render(*testNotification(tc.kind))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.kind, err)
+		}
+
+		if message.To != "ripley@example.com" || message.Subject != tc.subject {
+			t.Fatalf("%s: unexpected message %+v", tc.kind, message)
+		}
+		for _, part := range tc.body {
+			if !strings.Contains(message.Body, part) {
+				t.Fatalf("%s: expected %q in the body:\n%s", tc.kind, part, message.Body)
+			}
+		}
+	}
+
+	if _, err := Render(*testNotification("party_invitation")); !errors.Is(err, ErrUnknownKind) {
+		t.Fatalf("expected ErrUnknownKind, got %v", err)
+	}
+}
+
+func TestFormatMessageEncodesHeaders(t *testing.T) {
+	message := Message{To: "ripley@example.com", ToName: "Ripley\r\nBcc: burke@example.com", Subject: "Hi\r\nBcc: burke@example.com", Body: "one\ntwo\n"}
+
+	data, err := formatMessage("Cinema <no-reply@example.com>", message, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(data, []byte("\r\nBcc:")) {
+		t.Fatalf("expected the headers to be encoded, got:\n%s", data)
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n\r\none\r\ntwo\r\n")) {
+		t.Fatalf("expected CRLF line endings, got %q", data)
+	}
+
+	if _, err := formatMessage("Cinema <no-reply@example.com>", Message{To: "not an address"}, time.Now()); err == nil {
+		t.Fatal("expected an invalid recipient to be rejected")
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	sender := NewSMTPSender(SMTPConfig{Host: "smtp.example.com", Port: 587, Username: "app", Password: "secret", From: "Cinema <no-reply@example.com>"})
+
+	var addr, from string
+	var to []string
+	var auth smtp.Auth
+	sender.send = func(a string, au smtp.Auth, f string, t []string, msg []byte) error {
+		addr, auth, from, to = a, au, f, t
+		return nil
+	}
+
+	message, _ := Render(*testNotification(KIND_RESERVATION_CONFIRMED))
+	if err := sender.Send(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if addr != "smtp.example.com:587" || from != "no-reply@example.com" || len(to) != 1 || to[0] != "ripley@example.com" || auth == nil {
+		t.Fatalf("unexpected delivery to %s from %s to %v", addr, from, to)
+	}
+}
+
+func TestWriterSender(t *testing.T) {
+	var out bytes.Buffer
+	sender := NewWriterSender(&out, "no-reply@example.com")
+
+	message, _ := Render(*testNotification(KIND_SHOWTIME_REMINDER))
+	if err := sender.Send(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "To: \"Ripley\" <ripley@example.com>\n") || !strings.Contains(out.String(), "coming up") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestWorkerDelivers(t *testing.T) {
+	outbox := NewMemoryRepository()
+	outbox.Queue(testNotification(KIND_RESERVATION_CONFIRMED))
+	outbox.Queue(testNotification("party_invitation"))
+
+	sender := &fakeSender{}
+	sent, err := NewWorker(outbox, sender).RunOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent != 1 || len(sender.sent) != 1 {
+		t.Fatalf("expected one message sent, got %d", sent)
+	}
+
+	list := outbox.List()
+	if list[0].Status != STATUS_SENT || list[1].Status != STATUS_FAILED {
+		t.Fatalf("expected the unknown kind to fail for good, got %+v", list)
+	}
+
+	if sent, _ := NewWorker(outbox, sender).RunOnce(); sent != 0 {
+		t.Fatalf("expected nothing left to send, got %d", sent)
+	}
+}
+
+func TestWorkerRetries(t *testing.T) {
+	outbox := NewMemoryRepository()
+	notification := testNotification(KIND_RESERVATION_CANCELED)
+	outbox.Queue(notification)
+
+	worker := NewWorker(outbox, &fakeSender{err: errors.New("connection refused")})
+	for attempt := 1; attempt <= MAX_ATTEMPTS; attempt++ {
+		if _, err := worker.RunOnce(); err != nil {
+			t.Fatal(err)
+		}
+
+		stored := outbox.List()[0]
+		if stored.Attempts != attempt || stored.LastError != "connection refused" {
+			t.Fatalf("attempt %d: unexpected notification %+v", attempt, stored)
+		}
+
+		if attempt < MAX_ATTEMPTS {
+			if stored.Status != STATUS_PENDING {
+				t.Fatalf("attempt %d: expected a retry, got %s", attempt, stored.Status)
+			}
+
+			if sent, _ := worker.RunOnce(); sent != 0 || outbox.List()[0].Attempts != attempt {
+				t.Fatalf("attempt %d: expected the retry to wait for its backoff", attempt)
+			}
+
+			// Skip the backoff.
+			outbox.mu.Lock()
+			outbox.notifications[notification.ID].NextAttemptAt = time.Now()
+			outbox.mu.Unlock()
+		}
+	}
+
+	if stored := outbox.List()[0]; stored.Status != STATUS_FAILED {
+		t.Fatalf("expected the notification to fail after %d attempts, got %s", MAX_ATTEMPTS, stored.Status)
+	}
+}
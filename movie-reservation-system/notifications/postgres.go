@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"movie-reservation-system/database"
+	"time"
+)
+
+type PostgresRepository struct {
+	db *database.DB
+}
+
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Queue writes a notification for userId to the outbox as part of tx, so it
+// is only sent if the change it reports commits. It is addressed to the
+// current email of the user. A dedupKey that was queued before is ignored.
+func Queue(tx *sql.Tx, userId int, kind string, data Data, dedupKey string) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, kind, recipient, recipient_name, data, dedup_key)
+		SELECT id, $2, email, name, $3, NULLIF($4, '')
+		FROM users
+		WHERE id = $1
+		ON CONFLICT (dedup_key) DO NOTHING
+	`, userId, kind, payload, dedupKey)
+
+	return err
+}
+
+func (r *PostgresRepository) Claim(limit int, lease time.Duration) ([]Notification, error) {
+	// SKIP LOCKED lets several workers claim batches side by side.
+	rows, err := r.db.Query(`
+		UPDATE notifications
+		SET attempts = attempts + 1,
+			next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, kind, recipient, recipient_name, data, status, attempts, last_error, COALESCE(dedup_key, ''), created_at
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claimed := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		var payload []byte
+		err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.Kind,
+			&notification.Recipient,
+			&notification.RecipientName,
+			&payload,
+			&notification.Status,
+			&notification.Attempts,
+			&notification.LastError,
+			&notification.DedupKey,
+			&notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(payload, &notification.Data); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, notification)
+	}
+
+	return claimed, rows.Err()
+}
+
+func (r *PostgresRepository) MarkSent(id int) error {
+	_, err := r.db.Exec(`
+		UPDATE notifications SET status = 'sent', sent_at = NOW(), last_error = ''
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+func (r *PostgresRepository) MarkFailed(id int, reason string, retryAt time.Time) error {
+	if retryAt.IsZero() {
+		_, err := r.db.Exec(`
+			UPDATE notifications SET status = 'failed', last_error = $2
+			WHERE id = $1
+		`, id, reason)
+		return err
+	}
+
+	_, err := r.db.Exec(`
+		UPDATE notifications SET last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`, id, reason, retryAt)
+	return err
+}
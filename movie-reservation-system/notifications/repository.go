@@ -0,0 +1,16 @@
+package notifications
+
+import "time"
+
+// Repository is the outbox as seen by the worker. Notifications are queued by
+// the repositories whose changes they report, in the same transaction.
+type Repository interface {
+	// Claim returns up to limit pending notifications that are due, oldest
+	// first, and counts the attempt. Claimed notifications are hidden from
+	// other workers for lease, so one that is never marked is retried.
+	Claim(limit int, lease time.Duration) ([]Notification, error)
+	MarkSent(id int) error
+	// MarkFailed records why an attempt failed. The notification is retried
+	// at retryAt, or given up on when retryAt is zero.
+	MarkFailed(id int, reason string, retryAt time.Time) error
+}
@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sender delivers rendered messages.
+type Sender interface {
+	Send(message Message) error
+}
+
+// formatMessage writes message as a plain text email. Addresses and the
+// subject are encoded, so they cannot add headers of their own.
+func formatMessage(from string, message Message, date time.Time) ([]byte, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+
+	recipient, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", message.To, err)
+	}
+	recipient.Name = message.ToName
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From: %s\r\n", sender)
+	fmt.Fprintf(&out, "To: %s\r\n", recipient)
+	fmt.Fprintf(&out, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&out, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	out.WriteString("MIME-Version: 1.0\r\n")
+	out.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	out.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	out.WriteString("\r\n")
+
+	body := strings.ReplaceAll(message.Body, "\r\n", "\n")
+	out.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return out.Bytes(), nil
+}
+
+// WriterSender writes messages to a file or stdout instead of sending them,
+// for local development.
+type WriterSender struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriterSender(w io.Writer, from string) *WriterSender {
+	return &WriterSender{w: w, from: from}
+}
+
+// OpenFileSender appends messages to the file at path, or writes them to
+// stdout when path is empty or "-".
+func OpenFileSender(path string, from string) (*WriterSender, error) {
+	if path == "" || path == "-" {
+		return NewWriterSender(os.Stdout, from), nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterSender(file, from), nil
+}
+
+func (s *WriterSender) Send(message Message) error {
+	data, err := formatMessage(s.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	_, err = fmt.Fprintf(s.w, "%s\n---\n", data)
+	return err
+}
+
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password are optional. net/smtp only sends them over TLS
+	// or to localhost.
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPSender sends messages through an SMTP relay.
+type SMTPSender struct {
+	config SMTPConfig
+	send   func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPSender(config SMTPConfig) *SMTPSender {
+	return &SMTPSender{config: config, send: smtp.SendMail}
+}
+
+func (s *SMTPSender) Send(message Message) error {
+	data, err := formatMessage(s.config.From, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// formatMessage validated both addresses.
+	from, _ := mail.ParseAddress(s.config.From)
+	to, _ := mail.ParseAddress(message.To)
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	return s.send(addr, auth, from.Address, []string{to.Address}, data)
+}
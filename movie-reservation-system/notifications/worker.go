@@ -0,0 +1,102 @@
+package notifications
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	BATCH_SIZE   = 20
+	MAX_ATTEMPTS = 5
+	// RETRY_BACKOFF is the wait after the first failed attempt, doubled after
+	// each of the next ones.
+	RETRY_BACKOFF = time.Minute
+	// CLAIM_LEASE is how long a worker has to deliver a claimed notification
+	// before another worker may retry it.
+	CLAIM_LEASE = 5 * time.Minute
+)
+
+// Worker delivers the notifications of the outbox. Delivery is at least
+// once: a notification sent by a worker that dies before marking it is sent
+// again once its lease runs out.
+type Worker struct {
+	outbox Repository
+	sender Sender
+}
+
+func NewWorker(outbox Repository, sender Sender) *Worker {
+	return &Worker{outbox: outbox, sender: sender}
+}
+
+func retryAt(attempts int) time.Time {
+	if attempts >= MAX_ATTEMPTS {
+		return time.Time{}
+	}
+
+	return time.Now().Add(RETRY_BACKOFF << (attempts - 1))
+}
+
+// RunOnce delivers the notifications that are due and returns how many were
+// sent. Failed deliveries are scheduled for a retry.
+func (w *Worker) RunOnce() (int, error) {
+	claimed, err := w.outbox.Claim(BATCH_SIZE, CLAIM_LEASE)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, notification := range claimed {
+		message, err := Render(notification)
+		if err != nil {
+			// Rendering again would fail the same way.
+			slog.Error("rendering notification", "notification_id", notification.ID, "kind", notification.Kind, "error", err)
+			if err := w.outbox.MarkFailed(notification.ID, err.Error(), time.Time{}); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if err := w.sender.Send(message); err != nil {
+			next := retryAt(notification.Attempts)
+			slog.Warn("sending notification", "notification_id", notification.ID, "kind", notification.Kind, "attempts", notification.Attempts, "retry", !next.IsZero(), "error", err)
+			if err := w.outbox.MarkFailed(notification.ID, err.Error(), next); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if err := w.outbox.MarkSent(notification.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// StartWorker delivers notifications every interval until the process
+// exits. A full batch is followed by the next one right away.
+func StartWorker(worker *Worker, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for {
+				sent, err := worker.RunOnce()
+				if err != nil {
+					slog.Error("delivering notifications", "error", err)
+					break
+				}
+
+				if sent > 0 {
+					slog.Info("sent notifications", "count", sent)
+				}
+
+				if sent < BATCH_SIZE {
+					break
+				}
+			}
+		}
+	}()
+}
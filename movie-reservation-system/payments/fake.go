@@ -0,0 +1,197 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const FAKE_PROVIDER = "fake"
+
+// Test tokens understood by the fake provider. Any other token is approved
+// and captured right away.
+const (
+	FAKE_TOKEN_DECLINE       = "tok_decline"
+	FAKE_TOKEN_ASYNC         = "tok_async"
+	FAKE_TOKEN_CAPTURE_ERROR = "tok_capture_error"
+)
+
+// errFakeGateway is what the fake provider fails captures of
+// tok_capture_error with, like a gateway that timed out.
+var errFakeGateway = errors.New("fake gateway unavailable")
+
+// FakeProvider is a deterministic in-process provider for local development
+// and tests. Ids are sequential, tok_decline is declined, tok_async is only
+// captured once a webhook says so and tok_capture_error is authorized but
+// fails to capture.
+type FakeProvider struct {
+	secret string
+
+	mu       sync.Mutex
+	nextId   int
+	payments map[string]*fakePayment
+	refunds  map[string]bool
+}
+
+type fakePayment struct {
+	Amount       int
+	Async        bool
+	CaptureError bool
+	Status       string
+	Refunded     int
+}
+
+func NewFakeProvider(secret string) *FakeProvider {
+	return &FakeProvider{secret: secret, nextId: 1, payments: make(map[string]*fakePayment), refunds: make(map[string]bool)}
+}
+
+func (p *FakeProvider) Name() string {
+	return FAKE_PROVIDER
+}
+
+func (p *FakeProvider) Authorize(charge Charge) (string, error) {
+	if charge.Token == FAKE_TOKEN_DECLINE {
+		return "", ErrDeclined
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := fmt.Sprintf("fake_%d", p.nextId)
+	p.nextId++
+	p.payments[id] = &fakePayment{
+		Amount:       charge.Amount,
+		Async:        charge.Token == FAKE_TOKEN_ASYNC,
+		CaptureError: charge.Token == FAKE_TOKEN_CAPTURE_ERROR,
+		Status:       PAYMENT_AUTHORIZED,
+	}
+
+	return id, nil
+}
+
+func (p *FakeProvider) Capture(providerId string, amount int) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[providerId]
+	if !ok {
+		return "", ErrPaymentNotFound
+	}
+
+	if amount != payment.Amount || payment.Status != PAYMENT_AUTHORIZED {
+		return "", ErrInvalidTransition
+	}
+
+	if payment.CaptureError {
+		return "", errFakeGateway
+	}
+
+	if payment.Async {
+		return PAYMENT_AUTHORIZED, nil
+	}
+
+	payment.Status = PAYMENT_CAPTURED
+	return PAYMENT_CAPTURED, nil
+}
+
+func (p *FakeProvider) Refund(providerId string, amount int, idempotencyKey string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[providerId]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+
+	if p.refunds[idempotencyKey] {
+		return nil
+	}
+
+	if payment.Status != PAYMENT_CAPTURED || payment.Refunded+amount > payment.Amount {
+		return ErrInvalidTransition
+	}
+
+	payment.Refunded += amount
+	p.refunds[idempotencyKey] = true
+	return nil
+}
+
+func (p *FakeProvider) Void(providerId string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[providerId]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+
+	switch payment.Status {
+	case PAYMENT_AUTHORIZED:
+		payment.Status = PAYMENT_FAILED
+		return nil
+	case PAYMENT_FAILED:
+		return nil
+	default:
+		return ErrInvalidTransition
+	}
+}
+
+func (p *FakeProvider) mac(body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Sign returns the signature the fake provider puts on a webhook body.
+func (p *FakeProvider) Sign(body []byte) string {
+	return hex.EncodeToString(p.mac(body))
+}
+
+// Complete settles an async payment like the real gateway eventually would,
+// and returns the signed webhook body announcing it.
+func (p *FakeProvider) Complete(providerId string, captured bool) ([]byte, string, error) {
+	p.mu.Lock()
+	payment, ok := p.payments[providerId]
+	if !ok {
+		p.mu.Unlock()
+		return nil, "", ErrPaymentNotFound
+	}
+
+	if payment.Status != PAYMENT_AUTHORIZED {
+		p.mu.Unlock()
+		return nil, "", ErrInvalidTransition
+	}
+
+	event := Event{ID: "evt_" + providerId, ProviderID: providerId, Amount: payment.Amount, Type: EVENT_FAILED}
+	payment.Status = PAYMENT_FAILED
+	if captured {
+		event.Type = EVENT_CAPTURED
+		payment.Status = PAYMENT_CAPTURED
+	}
+	p.mu.Unlock()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, p.Sign(body), nil
+}
+
+func (p *FakeProvider) ParseWebhook(body []byte, signature string) (*Event, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, p.mac(body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,116 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const CURRENCY = "USD"
+
+const (
+	PAYMENT_PENDING    = "pending"
+	PAYMENT_AUTHORIZED = "authorized"
+	PAYMENT_CAPTURED   = "captured"
+	PAYMENT_FAILED     = "failed"
+	PAYMENT_REFUNDED   = "refunded"
+)
+
+const (
+	EVENT_CAPTURED = "payment.captured"
+	EVENT_FAILED   = "payment.failed"
+	EVENT_REFUNDED = "payment.refunded"
+)
+
+var (
+	ErrDeclined          = errors.New("payment declined")
+	ErrPaymentNotFound   = errors.New("payment not found")
+	ErrInvalidTransition = errors.New("invalid payment transition")
+	ErrInvalidSignature  = errors.New("invalid webhook signature")
+	ErrMissingSecret     = errors.New("payment webhook secret is required")
+)
+
+// transitions lists the states a payment may move to from each state. A
+// capture reported after the payment failed locally is refunded, hence
+// failed -> refunded.
+var transitions = map[string][]string{
+	PAYMENT_PENDING:    {PAYMENT_AUTHORIZED, PAYMENT_FAILED},
+	PAYMENT_AUTHORIZED: {PAYMENT_CAPTURED, PAYMENT_FAILED},
+	PAYMENT_CAPTURED:   {PAYMENT_REFUNDED},
+	PAYMENT_FAILED:     {PAYMENT_REFUNDED},
+}
+
+func CanTransition(from string, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Payment is one charge covering every seat of a checkout. ProviderID is the
+// id the provider gave to the authorization.
+type Payment struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"-"`
+	ShowtimeID int       `json:"showtime_id"`
+	Amount     int       `json:"amount"`
+	Refunded   int       `json:"refunded"`
+	Currency   string    `json:"currency"`
+	Status     string    `json:"status"`
+	Provider   string    `json:"provider"`
+	ProviderID string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Charge struct {
+	Amount    int
+	Currency  string
+	Token     string
+	Reference string
+}
+
+// Event is a provider callback about a payment, already verified.
+type Event struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	ProviderID string `json:"payment_id"`
+	Amount     int    `json:"amount"`
+}
+
+// Provider is a payment gateway. Capture reports PAYMENT_CAPTURED when the
+// money moved right away, or PAYMENT_AUTHORIZED when the outcome will arrive
+// later through a webhook.
+type Provider interface {
+	Name() string
+	Authorize(charge Charge) (string, error)
+	Capture(providerId string, amount int) (string, error)
+	// Refund gives back amount of a captured payment. Retrying with the same
+	// idempotency key refunds only once.
+	Refund(providerId string, amount int, idempotencyKey string) error
+	// Void releases the hold an uncaptured authorization puts on the money.
+	// Voiding again is a no-op; a payment captured already returns
+	// ErrInvalidTransition.
+	Void(providerId string) error
+	// ParseWebhook verifies the signature of a callback and decodes it.
+	ParseWebhook(body []byte, signature string) (*Event, error)
+}
+
+// NewProvider returns the provider called name. Only the fake provider is
+// built in for now.
+func NewProvider(name string, webhookSecret string) (Provider, error) {
+	// Webhooks are trusted only through their signature, so a provider
+	// without a secret would accept forged ones.
+	if webhookSecret == "" {
+		return nil, ErrMissingSecret
+	}
+
+	switch name {
+	case FAKE_PROVIDER:
+		return NewFakeProvider(webhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
@@ -0,0 +1,147 @@
+package payments
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from    string
+		to      string
+		allowed bool
+	}{
+		{PAYMENT_PENDING, PAYMENT_AUTHORIZED, true},
+		{PAYMENT_PENDING, PAYMENT_FAILED, true},
+		{PAYMENT_PENDING, PAYMENT_CAPTURED, false},
+		{PAYMENT_AUTHORIZED, PAYMENT_CAPTURED, true},
+		{PAYMENT_AUTHORIZED, PAYMENT_FAILED, true},
+		{PAYMENT_AUTHORIZED, PAYMENT_REFUNDED, false},
+		{PAYMENT_CAPTURED, PAYMENT_REFUNDED, true},
+		{PAYMENT_CAPTURED, PAYMENT_FAILED, false},
+		{PAYMENT_FAILED, PAYMENT_REFUNDED, true},
+		{PAYMENT_FAILED, PAYMENT_CAPTURED, false},
+		{PAYMENT_REFUNDED, PAYMENT_CAPTURED, false},
+	}
+
+	for _, tc := range cases {
+		if CanTransition(tc.from, tc.to) != tc.allowed {
+			t.Errorf("%s -> %s: expected allowed to be %v", tc.from, tc.to, tc.allowed)
+		}
+	}
+}
+
+func authorize(t *testing.T, provider *FakeProvider, token string, amount int) string {
+	id, err := provider.Authorize(Charge{Amount: amount, Currency: CURRENCY, Token: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestFakeProviderCaptureAndRefund(t *testing.T) {
+	provider := NewFakeProvider("secret")
+
+	if _, err := provider.Authorize(Charge{Amount: 1000, Token: FAKE_TOKEN_DECLINE}); err != ErrDeclined {
+		t.Fatalf("expected ErrDeclined, got %v", err)
+	}
+
+	id := authorize(t, provider, "tok_visa", 1000)
+	if err := provider.Refund(id, 100, "early"); err != ErrInvalidTransition {
+		t.Fatalf("expected an uncaptured payment not to be refunded, got %v", err)
+	}
+	if _, err := provider.Capture(id, 900); err != ErrInvalidTransition {
+		t.Fatalf("expected a capture of another amount to be rejected, got %v", err)
+	}
+
+	status, err := provider.Capture(id, 1000)
+	if err != nil || status != PAYMENT_CAPTURED {
+		t.Fatalf("expected a capture, got %s %v", status, err)
+	}
+	if _, err := provider.Capture(id, 1000); err != ErrInvalidTransition {
+		t.Fatalf("expected a second capture to be rejected, got %v", err)
+	}
+
+	if err := provider.Refund(id, 600, "refund-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Refund(id, 600, "refund-1"); err != nil {
+		t.Fatalf("expected a retried refund to succeed, got %v", err)
+	}
+	if err := provider.Refund(id, 600, "refund-2"); err != ErrInvalidTransition {
+		t.Fatalf("expected refunds past the amount to be rejected, got %v", err)
+	}
+	if err := provider.Refund(id, 400, "refund-3"); err != nil {
+		t.Fatalf("expected the rest to be refunded, got %v", err)
+	}
+
+	if err := provider.Void(id); err != ErrInvalidTransition {
+		t.Fatalf("expected a captured payment not to be voided, got %v", err)
+	}
+	if err := provider.Refund("fake_404", 100, "missing"); err != ErrPaymentNotFound {
+		t.Fatalf("expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+func TestFakeProviderVoid(t *testing.T) {
+	provider := NewFakeProvider("secret")
+	id := authorize(t, provider, FAKE_TOKEN_ASYNC, 1000)
+
+	status, err := provider.Capture(id, 1000)
+	if err != nil || status != PAYMENT_AUTHORIZED {
+		t.Fatalf("expected an async payment to stay authorized, got %s %v", status, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := provider.Void(id); err != nil {
+			t.Fatalf("void %d: %v", i+1, err)
+		}
+	}
+
+	if _, _, err := provider.Complete(id, true); err != ErrInvalidTransition {
+		t.Fatalf("expected a voided payment not to be captured, got %v", err)
+	}
+	if err := provider.Void("fake_404"); err != ErrPaymentNotFound {
+		t.Fatalf("expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+func TestFakeProviderWebhook(t *testing.T) {
+	provider := NewFakeProvider("secret")
+	id := authorize(t, provider, FAKE_TOKEN_ASYNC, 1000)
+
+	body, signature, err := provider.Complete(id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := provider.ParseWebhook(body, signature)
+	if err != nil || event.Type != EVENT_FAILED || event.ProviderID != id || event.Amount != 1000 {
+		t.Fatalf("unexpected event %+v: %v", event, err)
+	}
+
+	if _, err := provider.ParseWebhook(body, "deadbeef"); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	if _, err := NewFakeProvider("other").ParseWebhook(body, signature); err != ErrInvalidSignature {
+		t.Fatalf("expected another secret to be rejected, got %v", err)
+	}
+}
+
+func TestNewProviderRequiresSecret(t *testing.T) {
+	if _, err := NewProvider(FAKE_PROVIDER, ""); err != ErrMissingSecret {
+		t.Fatalf("expected ErrMissingSecret, got %v", err)
+	}
+	if _, err := NewProvider(FAKE_PROVIDER, "secret"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeProviderCaptureError(t *testing.T) {
+	provider := NewFakeProvider("secret")
+	id := authorize(t, provider, FAKE_TOKEN_CAPTURE_ERROR, 1000)
+
+	if _, err := provider.Capture(id, 1000); err == nil {
+		t.Fatal("expected the capture to fail")
+	}
+	if err := provider.Void(id); err != nil {
+		t.Fatalf("expected the authorization to be voided, got %v", err)
+	}
+}
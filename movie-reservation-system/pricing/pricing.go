@@ -0,0 +1,132 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	HOLIDAY_LAYOUT = "2006-01-02"
+
+	RULE_MATINEE = "matinee"
+	RULE_WEEKEND = "weekend"
+	RULE_HOLIDAY = "holiday"
+	RULE_CHILD   = "child"
+	RULE_SENIOR  = "senior"
+)
+
+// Rules turn a seat category, a showtime and the age of the customer into a
+// ticket price. Amounts are in cents and adjustments are percentages applied
+// one after the other on top of the base price.
+type Rules struct {
+	// BasePrices by seat category. Categories without a price use the
+	// "standard" one.
+	BasePrices map[string]int
+
+	// Showtimes starting before MatineeBeforeHour get MatineePercent.
+	MatineeBeforeHour int
+	MatineePercent    int
+	// Holidays take precedence over weekends, they never stack.
+	WeekendPercent int
+	HolidayPercent int
+	Holidays       map[string]bool
+
+	ChildMaxAge   int
+	ChildPercent  int
+	SeniorMinAge  int
+	SeniorPercent int
+}
+
+type Adjustment struct {
+	Rule    string `json:"rule"`
+	Percent int    `json:"percent"`
+}
+
+type Price struct {
+	Category    string       `json:"category"`
+	Base        int          `json:"base"`
+	Amount      int          `json:"amount"`
+	Adjustments []Adjustment `json:"adjustments"`
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		BasePrices: map[string]int{
+			"standard": 1000,
+			"premium":  1500,
+			"vip":      2200,
+		},
+		MatineeBeforeHour: 17,
+		MatineePercent:    -20,
+		WeekendPercent:    15,
+		HolidayPercent:    25,
+		Holidays:          map[string]bool{},
+		ChildMaxAge:       11,
+		ChildPercent:      -40,
+		SeniorMinAge:      65,
+		SeniorPercent:     -30,
+	}
+}
+
+// NewRules returns the default rules with holidays, given as YYYY-MM-DD
+// dates.
+func NewRules(holidays []string) (Rules, error) {
+	rules := DefaultRules()
+	for _, date := range holidays {
+		if _, err := time.Parse(HOLIDAY_LAYOUT, date); err != nil {
+			return rules, fmt.Errorf("holiday %q must be a YYYY-MM-DD date", date)
+		}
+		rules.Holidays[date] = true
+	}
+
+	return rules, nil
+}
+
+// Quote prices one seat of the given category for a showtime starting at
+// startsAt. age is negative when the age of the customer is unknown.
+func (r Rules) Quote(category string, startsAt time.Time, age int) Price {
+	base, ok := r.BasePrices[category]
+	if !ok {
+		base = r.BasePrices["standard"]
+	}
+
+	adjustments := []Adjustment{}
+	add := func(rule string, percent int) {
+		if percent != 0 {
+			adjustments = append(adjustments, Adjustment{Rule: rule, Percent: percent})
+		}
+	}
+
+	local := startsAt.In(time.Local)
+	if local.Hour() < r.MatineeBeforeHour {
+		add(RULE_MATINEE, r.MatineePercent)
+	}
+
+	switch {
+	case r.Holidays[local.Format(HOLIDAY_LAYOUT)]:
+		add(RULE_HOLIDAY, r.HolidayPercent)
+	case local.Weekday() == time.Saturday || local.Weekday() == time.Sunday:
+		add(RULE_WEEKEND, r.WeekendPercent)
+	}
+
+	switch {
+	case age < 0:
+	case age <= r.ChildMaxAge:
+		add(RULE_CHILD, r.ChildPercent)
+	case age >= r.SeniorMinAge:
+		add(RULE_SENIOR, r.SeniorPercent)
+	}
+
+	amount := float64(base)
+	for _, adjustment := range adjustments {
+		amount = amount * float64(100+adjustment.Percent) / 100
+	}
+
+	return Price{
+		Category:    category,
+		Base:        base,
+		Amount:      int(math.Round(amount)),
+		Adjustments: adjustments,
+	}
+}
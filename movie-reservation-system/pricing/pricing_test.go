@@ -0,0 +1,47 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuote(t *testing.T) {
+	rules := DefaultRules()
+	rules.Holidays["2026-12-25"] = true
+
+	// 2026-10-14 is a Wednesday and 2026-10-17 a Saturday.
+	cases := []struct {
+		name     string
+		category string
+		startsAt time.Time
+		age      int
+		amount   int
+	}{
+		{"evening", "standard", time.Date(2026, 10, 14, 20, 0, 0, 0, time.Local), 30, 1000},
+		{"unknown category", "balcony", time.Date(2026, 10, 14, 20, 0, 0, 0, time.Local), 30, 1000},
+		{"premium matinee", "premium", time.Date(2026, 10, 14, 14, 0, 0, 0, time.Local), 30, 1200},
+		{"weekend", "standard", time.Date(2026, 10, 17, 20, 0, 0, 0, time.Local), 30, 1150},
+		{"holiday on a weekday", "standard", time.Date(2026, 12, 25, 20, 0, 0, 0, time.Local), 30, 1250},
+		{"child on a weekend matinee", "standard", time.Date(2026, 10, 17, 14, 0, 0, 0, time.Local), 8, 552},
+		{"senior", "vip", time.Date(2026, 10, 14, 20, 0, 0, 0, time.Local), 70, 1540},
+		{"unknown age", "standard", time.Date(2026, 10, 14, 20, 0, 0, 0, time.Local), -1, 1000},
+	}
+
+	for _, tc := range cases {
+		price := rules.Quote(tc.category, tc.startsAt, tc.age)
+		if price.Amount != tc.amount {
+			t.Errorf("%s: expected %d, got %d (%+v)", tc.name, tc.amount, price.Amount, price.Adjustments)
+		}
+	}
+}
+
+func TestNewRules(t *testing.T) {
+	rules, err := NewRules([]string{"2030-12-25"})
+	if err != nil || !rules.Holidays["2030-12-25"] {
+		t.Fatalf("expected the holiday to be loaded, got %v, %v", rules.Holidays, err)
+	}
+
+	if _, err := NewRules([]string{"25/12/2030"}); err == nil {
+		t.Fatal("expected an invalid holiday to be rejected")
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// SWEEP_EVERY is how many calls the memory store serves between two passes
+// that drop expired entries.
+const SWEEP_EVERY = 1000
+
+type entry struct {
+	count        int
+	resetAt      time.Time
+	blockedUntil time.Time
+}
+
+// MemoryStore keeps counters in the memory of the process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	calls   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry)}
+}
+
+// sweep drops entries whose window and block are both over. Callers hold
+// the lock.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.calls++
+	if s.calls%SWEEP_EVERY != 0 {
+		return
+	}
+
+	for key, e := range s.entries {
+		if !now.Before(e.resetAt) && !now.Before(e.blockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *MemoryStore) entry(key string, now time.Time) *entry {
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{}
+		s.entries[key] = e
+	}
+
+	return e
+}
+
+func (s *MemoryStore) Hit(key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.entry(key, now)
+	if !now.Before(e.resetAt) {
+		e.count = 0
+		e.resetAt = now.Add(window)
+	}
+	e.count++
+
+	return e.count, e.resetAt, nil
+}
+
+func (s *MemoryStore) Block(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entry(key, time.Now()).blockedUntil = until
+	return nil
+}
+
+func (s *MemoryStore) BlockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !time.Now().Before(e.blockedUntil) {
+		return time.Time{}, nil
+	}
+
+	return e.blockedUntil, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
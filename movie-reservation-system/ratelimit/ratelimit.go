@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"math"
+	"movie-reservation-system/apierror"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limiter allows Limit events per key in every Window.
+type Limiter struct {
+	store  Store
+	prefix string
+	Limit  int
+	Window time.Duration
+}
+
+// NewLimiter keeps its counters under prefix so limiters can share a store.
+func NewLimiter(store Store, prefix string, limit int, window time.Duration) *Limiter {
+	return &Limiter{store: store, prefix: prefix, Limit: limit, Window: window}
+}
+
+// Allow counts an event for key. When the limit is exceeded it returns false
+// and how long until the window ends.
+func (l *Limiter) Allow(key string) (bool, time.Duration, error) {
+	count, resetAt, err := l.store.Hit(l.prefix+key, l.Window)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if count > l.Limit {
+		return false, time.Until(resetAt), nil
+	}
+
+	return true, 0, nil
+}
+
+// Lockout blocks a key after Threshold failures within Window. Every failure
+// past the threshold doubles the block, starting at BaseDelay and up to
+// MaxDelay. A success clears the failures.
+type Lockout struct {
+	store     Store
+	prefix    string
+	Threshold int
+	Window    time.Duration
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func NewLockout(store Store, prefix string, threshold int, window time.Duration, baseDelay time.Duration, maxDelay time.Duration) *Lockout {
+	return &Lockout{store: store, prefix: prefix, Threshold: threshold, Window: window, BaseDelay: baseDelay, MaxDelay: maxDelay}
+}
+
+// Delay is how long the failure number count blocks for.
+func (l *Lockout) Delay(count int) time.Duration {
+	if count < l.Threshold {
+		return 0
+	}
+
+	delay := l.BaseDelay
+	for i := l.Threshold; i < count && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, l.MaxDelay)
+}
+
+// Locked returns how long key stays blocked, or 0.
+func (l *Lockout) Locked(key string) (time.Duration, error) {
+	until, err := l.store.BlockedUntil(l.prefix + key)
+	if err != nil || until.IsZero() {
+		return 0, err
+	}
+
+	return time.Until(until), nil
+}
+
+// Fail records a failure for key and blocks it once the threshold is
+// reached. It returns the delay applied, if any.
+func (l *Lockout) Fail(key string) (time.Duration, error) {
+	count, _, err := l.store.Hit(l.prefix+key, l.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := l.Delay(count)
+	if delay > 0 {
+		if err := l.store.Block(l.prefix+key, time.Now().Add(delay)); err != nil {
+			return 0, err
+		}
+	}
+
+	return delay, nil
+}
+
+func (l *Lockout) Succeed(key string) error {
+	return l.store.Reset(l.prefix + key)
+}
+
+// Abort answers 429 with a Retry-After header.
+func Abort(c *gin.Context, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	apierror.Abort(c, apierror.TooManyRequests(message).WithDetails(gin.H{"retry_after_seconds": seconds}))
+}
+
+// Middleware answers 429 once the key of the request is over the limit.
+// Requests without a key, like a login without an email, are let through
+// for the handler to reject.
+func Middleware(limiter *Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter, err := limiter.Allow(k)
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+
+		if !allowed {
+			Abort(c, "too many requests", retryAfter)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ClientIP keys rate limits by the address of the caller.
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), "ip:", 2, 50*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := limiter.Allow("10.0.0.1"); !allowed {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter, _ := limiter.Allow("10.0.0.1")
+	if allowed || retryAfter <= 0 {
+		t.Fatalf("expected the third request to wait, got %v, %s", allowed, retryAfter)
+	}
+
+	if allowed, _, _ := limiter.Allow("10.0.0.2"); !allowed {
+		t.Fatal("expected other keys to have their own count")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if allowed, _, _ := limiter.Allow("10.0.0.1"); !allowed {
+		t.Fatal("expected a new window to allow requests again")
+	}
+}
+
+func TestLockoutDelay(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), "", 3, time.Hour, time.Minute, 10*time.Minute)
+
+	expected := map[int]time.Duration{1: 0, 2: 0, 3: time.Minute, 4: 2 * time.Minute, 5: 4 * time.Minute, 6: 8 * time.Minute, 7: 10 * time.Minute, 50: 10 * time.Minute}
+	for count, delay := range expected {
+		if got := lockout.Delay(count); got != delay {
+			t.Errorf("failure %d: expected %s, got %s", count, delay, got)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), "", 2, time.Hour, time.Minute, time.Hour)
+
+	lockout.Fail("ripley@example.com")
+	if locked, _ := lockout.Locked("ripley@example.com"); locked != 0 {
+		t.Fatalf("expected no lock below the threshold, got %s", locked)
+	}
+
+	lockout.Fail("ripley@example.com")
+	if locked, _ := lockout.Locked("ripley@example.com"); locked <= 0 {
+		t.Fatal("expected a lock at the threshold")
+	}
+
+	lockout.Succeed("ripley@example.com")
+	if locked, _ := lockout.Locked("ripley@example.com"); locked != 0 {
+		t.Fatalf("expected a success to clear the lock, got %s", locked)
+	}
+}
@@ -0,0 +1,18 @@
+package ratelimit
+
+import "time"
+
+// Store keeps the counters behind limiters and lockouts. The in-memory store
+// only limits a single instance; run several behind a load balancer with a
+// shared store instead.
+type Store interface {
+	// Hit counts one event for key in a fixed window that starts with the
+	// first event, and returns the count so far and when the window ends.
+	Hit(key string, window time.Duration) (int, time.Time, error)
+	// Block marks key as blocked until the given time.
+	Block(key string, until time.Time) error
+	// BlockedUntil returns the zero time when key is not blocked.
+	BlockedUntil(key string) (time.Time, error)
+	// Reset forgets the count and the block of key.
+	Reset(key string) error
+}
@@ -0,0 +1,126 @@
+package reservation
+
+import (
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/halls"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SEAT_FREE     = "free"
+	SEAT_RESERVED = "reserved"
+	SEAT_HELD     = "held"
+	SEAT_DISABLED = "disabled"
+)
+
+type SeatState struct {
+	halls.Seat
+	State string `json:"state"`
+}
+
+type SeatCounts struct {
+	Total    int `json:"total"`
+	Free     int `json:"free"`
+	Reserved int `json:"reserved"`
+	Held     int `json:"held"`
+	Disabled int `json:"disabled"`
+}
+
+type ShowtimeSeats struct {
+	ShowtimeID int         `json:"showtime_id"`
+	StartsAt   time.Time   `json:"starts_at"`
+	HallID     int         `json:"hall_id"`
+	HallName   string      `json:"hall_name"`
+	Counts     SeatCounts  `json:"counts"`
+	Seats      []SeatState `json:"seats"`
+}
+
+func seatMap(layout halls.Layout, reserved map[string]bool, held map[string]bool) ([]SeatState, SeatCounts) {
+	var counts SeatCounts
+	seats := []SeatState{}
+
+	for _, seat := range layout.Seats() {
+		state := SEAT_FREE
+		switch {
+		case seat.Disabled:
+			state = SEAT_DISABLED
+			counts.Disabled++
+		case reserved[seat.ID]:
+			state = SEAT_RESERVED
+			counts.Reserved++
+		case held[seat.ID]:
+			state = SEAT_HELD
+			counts.Held++
+		default:
+			counts.Free++
+		}
+
+		counts.Total++
+		seats = append(seats, SeatState{Seat: seat, State: state})
+	}
+
+	return seats, counts
+}
+
+// GetSeatAvailability returns the seat map of every screening of a movie on
+// the given date. Only seat states and totals are exposed, never who holds a
+// reservation.
+func (h *Handler) GetSeatAvailability(c *gin.Context) {
+	movieId, err := apierror.IDParam(c, "id", "movie")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	dateParam := c.Query("date")
+	if dateParam == "" {
+		apierror.Abort(c, apierror.InvalidField("date", "is required"))
+		return
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", dateParam, h.location)
+	if err != nil {
+		apierror.Abort(c, apierror.InvalidField("date", "must be formatted as YYYY-MM-DD"))
+		return
+	}
+
+	list, err := h.reservations.ListShowtimes(movieId, date, date.AddDate(0, 0, 1))
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	screenings := []ShowtimeSeats{}
+	for _, showtime := range list {
+		hall, err := h.reservations.FindHall(showtime.HallID)
+		if err != nil {
+			apierror.Abort(c, fmt.Errorf("hall %d of showtime %d: %w", showtime.HallID, showtime.ID, err))
+			return
+		}
+
+		reserved, held, err := h.reservations.TakenSeats(showtime.ID)
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+
+		screening := ShowtimeSeats{
+			ShowtimeID: showtime.ID,
+			StartsAt:   showtime.StartsAt,
+			HallID:     showtime.HallID,
+			HallName:   showtime.HallName,
+		}
+		screening.Seats, screening.Counts = seatMap(hall.Layout, reserved, held)
+		screenings = append(screenings, screening)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movie_id":  movieId,
+		"date":      dateParam,
+		"showtimes": screenings,
+	})
+}
@@ -0,0 +1,210 @@
+package reservation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/halls"
+	"movie-reservation-system/users"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DEFAULT_CANCELLATION_CUTOFF is how long before the screening bookings stop
+// being cancellable, unless CANCELLATION_CUTOFF says otherwise.
+const DEFAULT_CANCELLATION_CUTOFF = 2 * time.Hour
+
+// Booking is the seats reserved together by one checkout.
+type Booking struct {
+	ID         string       `json:"id"`
+	UserID     int          `json:"-"`
+	MovieID    int          `json:"movie_id"`
+	ShowtimeID int          `json:"showtime_id"`
+	Date       time.Time    `json:"date"`
+	PaymentID  int          `json:"payment_id,omitempty"`
+	Seats      []BookedSeat `json:"seats"`
+}
+
+type BookedSeat struct {
+	Seat   string `json:"seat"`
+	Price  int    `json:"price"`
+	Status string `json:"status"`
+}
+
+type CancelSeatsBody struct {
+	Seats []string `json:"seats"`
+}
+
+func newBookingId() (string, error) {
+	data := make([]byte, 12)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+// findOwnBooking loads the booking in the URL. Bookings of other users are
+// reported as not found. On failure the response has already been written.
+func (h *Handler) findOwnBooking(c *gin.Context) (*Booking, bool) {
+	booking, err := h.reservations.FindBooking(c.Param("id"))
+	if err == ErrBookingNotFound || (err == nil && booking.UserID != users.ExtractUserIdFromClaims(c)) {
+		apierror.Abort(c, apierror.NotFound(ErrBookingNotFound.Error()))
+		return nil, false
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return nil, false
+	}
+
+	return booking, true
+}
+
+// bookingConflict explains why seats of a booking cannot be canceled, or
+// returns nil when they can.
+func (h *Handler) bookingConflict(booking *Booking, seats []string) error {
+	if time.Until(booking.Date) < h.cutoff {
+		return fmt.Errorf("bookings can only be canceled up to %s before the screening", h.cutoff)
+	}
+
+	return pendingConflict(booking, seats)
+}
+
+// pendingConflict refuses to cancel seats whose payment is still pending.
+func pendingConflict(booking *Booking, seats []string) error {
+	cancel := make(map[string]bool)
+	for _, seat := range seats {
+		cancel[seat] = true
+	}
+
+	for _, seat := range booking.Seats {
+		if cancel[seat.Seat] && seat.Status == STATUS_PENDING_PAYMENT {
+			return fmt.Errorf("the payment of the booking is still pending")
+		}
+	}
+
+	return nil
+}
+
+func bookingSeats(booking *Booking) []string {
+	seats := []string{}
+	for _, seat := range booking.Seats {
+		seats = append(seats, seat.Seat)
+	}
+
+	return seats
+}
+
+func (h *Handler) GetBooking(c *gin.Context) {
+	booking, ok := h.findOwnBooking(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, booking)
+}
+
+// CancelBooking cancels every seat left in a booking.
+func (h *Handler) CancelBooking(c *gin.Context) {
+	booking, ok := h.findOwnBooking(c)
+	if !ok {
+		return
+	}
+
+	h.respondCancel(c, booking, bookingSeats(booking))
+}
+
+// CancelBookingSeats cancels some seats of a booking and refunds their price.
+// An empty list cancels the whole booking.
+func (h *Handler) CancelBookingSeats(c *gin.Context) {
+	var body CancelSeatsBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	booking, ok := h.findOwnBooking(c)
+	if !ok {
+		return
+	}
+
+	if len(body.Seats) == 0 {
+		h.respondCancel(c, booking, bookingSeats(booking))
+		return
+	}
+
+	booked := make(map[string]bool)
+	for _, seat := range booking.Seats {
+		booked[seat.Seat] = true
+	}
+
+	seats := []string{}
+	for _, seat := range body.Seats {
+		seat = halls.NormalizeSeat(seat)
+		if !booked[seat] {
+			apierror.Abort(c, apierror.InvalidField("seats", fmt.Sprintf("seat %s is not part of the booking", seat)))
+			return
+		}
+		seats = append(seats, seat)
+	}
+
+	h.respondCancel(c, booking, seats)
+}
+
+func (h *Handler) respondCancel(c *gin.Context, booking *Booking, seats []string) {
+	if err := h.bookingConflict(booking, seats); err != nil {
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+		return
+	}
+
+	refunded, pending, err := h.cancel([]Cancellation{{BookingID: booking.ID, Seats: seats}})
+	if err == ErrBookingNotFound {
+		apierror.Abort(c, apierror.Conflict("the seats were canceled already"))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	h.offerFreedSeats(c, booking.ShowtimeID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "seats canceled", "booking_id": booking.ID, "seats": seats, "refunded": refunded, "refund_pending": pending})
+}
+
+// RefundBooking cancels and refunds every seat left in the booking of any
+// user. Staff may do so past the cancellation cutoff.
+func (h *Handler) RefundBooking(c *gin.Context) {
+	booking, err := h.reservations.FindBooking(c.Param("id"))
+	if err == ErrBookingNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	seats := bookingSeats(booking)
+	if err := pendingConflict(booking, seats); err != nil {
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+		return
+	}
+
+	refunded, pending, err := h.cancel([]Cancellation{{BookingID: booking.ID, Seats: seats}})
+	if err == ErrBookingNotFound {
+		apierror.Abort(c, apierror.Conflict("the seats were canceled already"))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	h.offerFreedSeats(c, booking.ShowtimeID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "booking refunded", "booking_id": booking.ID, "seats": seats, "refunded": refunded, "refund_pending": pending})
+}
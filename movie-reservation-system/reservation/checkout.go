@@ -0,0 +1,309 @@
+package reservation
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/idempotency"
+	"movie-reservation-system/metrics"
+	"movie-reservation-system/notifications"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/showtimes"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	STATUS_PENDING_PAYMENT = "pending_payment"
+	STATUS_PAID            = "paid"
+	STATUS_REFUNDED        = "refunded"
+)
+
+// PAYMENT_TIMEOUT is how long seats stay taken by a payment that was neither
+// captured nor failed.
+const PAYMENT_TIMEOUT = 30 * time.Minute
+
+const SIGNATURE_HEADER = "X-Payment-Signature"
+
+// reservationStatus is the status the reservations of a payment end up in.
+func reservationStatus(payment *payments.Payment) string {
+	switch payment.Status {
+	case payments.PAYMENT_CAPTURED:
+		return STATUS_PAID
+	case payments.PAYMENT_REFUNDED:
+		return STATUS_REFUNDED
+	}
+
+	return STATUS_PENDING_PAYMENT
+}
+
+// paymentNotifications are the notifications a payment status sends about the
+// bookings of the payment. Bookings are only confirmed once paid.
+var paymentNotifications = map[string]string{
+	payments.PAYMENT_CAPTURED: notifications.KIND_RESERVATION_CONFIRMED,
+	payments.PAYMENT_FAILED:   notifications.KIND_PAYMENT_FAILED,
+}
+
+// failPayment marks a payment failed, which releases its seats. Errors are
+// only logged since the request already failed for another reason.
+func (h *Handler) failPayment(payment *payments.Payment) {
+	err := h.reservations.SetPaymentStatus(payment.ID, payments.PAYMENT_FAILED, "")
+	if err != nil {
+		slog.Error("failing payment", "payment_id", payment.ID, "error", err)
+	}
+}
+
+// voidPayment releases an authorization that will not be captured and fails
+// its payment. A payment the provider captured after all is left to its
+// webhook.
+func (h *Handler) voidPayment(payment *payments.Payment, providerId string) {
+	err := h.payments.Void(providerId)
+	if err == payments.ErrInvalidTransition {
+		slog.Warn("payment captured before it could be voided", "payment_id", payment.ID)
+		return
+	}
+	if err != nil {
+		slog.Error("voiding payment", "payment_id", payment.ID, "error", err)
+	}
+
+	h.failPayment(payment)
+}
+
+// FailStalePayments fails the pending and authorized payments older than
+// olderThan, releasing their seats. Authorizations are voided at the
+// provider first so the money of the customer is not held any longer. A
+// payment the provider captured in the meantime is left to its webhook, and
+// one that could not be voided is tried again on the next run.
+func FailStalePayments(reservations ReservationRepository, provider payments.Provider, olderThan time.Duration) (int64, error) {
+	stale, err := reservations.StalePayments(olderThan)
+	if err != nil {
+		return 0, err
+	}
+
+	var failed int64
+	for _, payment := range stale {
+		if payment.Status == payments.PAYMENT_AUTHORIZED && payment.ProviderID != "" {
+			err := provider.Void(payment.ProviderID)
+			if err == payments.ErrInvalidTransition {
+				continue
+			}
+			if err != nil {
+				slog.Error("voiding stale payment", "payment_id", payment.ID, "error", err)
+				continue
+			}
+		}
+
+		err := reservations.SetPaymentStatus(payment.ID, payments.PAYMENT_FAILED, "")
+		// The payment may have been captured in the meantime.
+		if err == payments.ErrInvalidTransition {
+			continue
+		}
+		if err != nil {
+			return failed, err
+		}
+		failed++
+	}
+
+	return failed, nil
+}
+
+// abortUncommitted fails a request that changed nothing, so that it may be
+// retried under the same idempotency key.
+func abortUncommitted(c *gin.Context, err error) {
+	idempotency.Uncommitted(c)
+	apierror.Abort(c, err)
+}
+
+// checkout prices the seats, takes them pending payment under a new booking
+// through take and charges the customer. Seats are released again when the
+// charge fails. The reservations are paid right away when the provider
+// captures synchronously, otherwise they stay pending until the webhook
+// arrives.
+func (h *Handler) checkout(c *gin.Context, showtime *showtimes.Showtime, userId int, seats []string, token string, take func(checkout Checkout) error) {
+	if token == "" {
+		apierror.Abort(c, apierror.InvalidField("payment_token", "is required"))
+		return
+	}
+
+	tickets, prices, total, err := h.priceSeats(showtime, userId, seats)
+	if err != nil {
+		abortUncommitted(c, err)
+		return
+	}
+
+	payment := &payments.Payment{
+		UserID:     userId,
+		ShowtimeID: showtime.ID,
+		Amount:     total,
+		Currency:   payments.CURRENCY,
+		Status:     payments.PAYMENT_PENDING,
+		Provider:   h.payments.Name(),
+	}
+	if err := h.reservations.CreatePayment(payment); err != nil {
+		abortUncommitted(c, err)
+		return
+	}
+
+	bookingId, err := newBookingId()
+	if err != nil {
+		h.failPayment(payment)
+		abortUncommitted(c, err)
+		return
+	}
+
+	err = take(Checkout{BookingID: bookingId, PaymentID: payment.ID, Prices: prices})
+	if err != nil {
+		h.failPayment(payment)
+	}
+
+	switch err {
+	case nil:
+	case ErrSeatTaken:
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+		return
+	case ErrHoldNotFound:
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	case ErrHoldInactive:
+		apierror.Abort(c, apierror.Gone(err.Error()))
+		return
+	default:
+		abortUncommitted(c, err)
+		return
+	}
+
+	providerId, err := h.payments.Authorize(payments.Charge{
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+		Token:     token,
+		Reference: fmt.Sprintf("payment-%d", payment.ID),
+	})
+	if err == payments.ErrDeclined {
+		h.failPayment(payment)
+		apierror.Abort(c, apierror.PaymentRequired(err.Error()))
+		return
+	}
+	if err != nil {
+		h.failPayment(payment)
+		abortUncommitted(c, apierror.BadGateway("payment provider unavailable", fmt.Errorf("authorizing payment %d: %w", payment.ID, err)))
+		return
+	}
+
+	err = h.reservations.SetPaymentStatus(payment.ID, payments.PAYMENT_AUTHORIZED, providerId)
+	if err != nil {
+		// The provider id was not saved, so the sweeper could not void the
+		// authorization later.
+		h.voidPayment(payment, providerId)
+		apierror.Abort(c, err)
+		return
+	}
+
+	status, err := h.payments.Capture(providerId, payment.Amount)
+	if err != nil {
+		h.voidPayment(payment, providerId)
+		apierror.Abort(c, apierror.BadGateway("payment provider unavailable", fmt.Errorf("capturing payment %d: %w", payment.ID, err)))
+		return
+	}
+
+	if status == payments.PAYMENT_CAPTURED {
+		err = h.reservations.SetPaymentStatus(payment.ID, payments.PAYMENT_CAPTURED, "")
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+	}
+
+	payment, err = h.reservations.FindPayment(payment.ID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	metrics.Reservations.Inc(reservationStatus(payment))
+	metrics.ReservedSeats.Add(float64(len(seats)))
+
+	code := http.StatusOK
+	if payment.Status != payments.PAYMENT_CAPTURED {
+		code = http.StatusAccepted
+	}
+
+	c.JSON(code, gin.H{
+		"booking_id":  bookingId,
+		"showtime_id": showtime.ID,
+		"date":        showtime.StartsAt,
+		"seats":       seats,
+		"tickets":     tickets,
+		"total":       total,
+		"status":      reservationStatus(payment),
+		"payment":     payment,
+	})
+}
+
+// eventStatuses maps webhook events to payment statuses.
+var eventStatuses = map[string]string{
+	payments.EVENT_CAPTURED: payments.PAYMENT_CAPTURED,
+	payments.EVENT_FAILED:   payments.PAYMENT_FAILED,
+	payments.EVENT_REFUNDED: payments.PAYMENT_REFUNDED,
+}
+
+// HandlePaymentWebhook applies provider callbacks to payments. Replayed and
+// out of order events are acknowledged without changes so the provider stops
+// retrying them.
+func (h *Handler) HandlePaymentWebhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest("invalid body"))
+		return
+	}
+
+	event, err := h.payments.ParseWebhook(body, c.GetHeader(SIGNATURE_HEADER))
+	if err == payments.ErrInvalidSignature {
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CODE_UNAUTHORIZED, err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest("invalid event"))
+		return
+	}
+
+	status, ok := eventStatuses[event.Type]
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"message": "event ignored"})
+		return
+	}
+
+	payment, err := h.reservations.FindPaymentByProviderId(h.payments.Name(), event.ProviderID)
+	if err == payments.ErrPaymentNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	// The seats of a failed payment may be gone already, so money captured
+	// afterwards is given back.
+	if status == payments.PAYMENT_CAPTURED && payment.Status == payments.PAYMENT_FAILED {
+		if err := h.payments.Refund(payment.ProviderID, payment.Amount, fmt.Sprintf("late-capture-%d", payment.ID)); err != nil {
+			apierror.Abort(c, fmt.Errorf("refunding late capture of payment %d: %w", payment.ID, err))
+			return
+		}
+		status = payments.PAYMENT_REFUNDED
+	}
+
+	err = h.reservations.SetPaymentStatus(payment.ID, status, "")
+	if err == payments.ErrInvalidTransition {
+		c.JSON(http.StatusOK, gin.H{"message": "event ignored"})
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "event processed"})
+}
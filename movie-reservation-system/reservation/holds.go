@@ -0,0 +1,229 @@
+package reservation
+
+import (
+	"fmt"
+	"log/slog"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/users"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DEFAULT_HOLD_MINUTES = 10
+	MAX_HOLD_MINUTES     = 15
+)
+
+type HoldBody struct {
+	Seats      []string `json:"seats"`
+	ShowtimeID int      `json:"showtime_id"`
+	Minutes    int      `json:"minutes"`
+}
+
+type Hold struct {
+	ID          int        `json:"id"`
+	ShowtimeID  int        `json:"showtime_id"`
+	UserID      int        `json:"-"`
+	Seats       []string   `json:"seats"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
+}
+
+func (h *Hold) active() bool {
+	return h.ConfirmedAt == nil && h.ReleasedAt == nil && h.ExpiresAt.After(time.Now())
+}
+
+// HoldSeats locks seats of a showtime for the caller while they pay. The seats
+// show as held to everyone else until the hold is confirmed, released or
+// expires. A new hold replaces the caller's previous one for the showtime, so
+// retrying checkout does not leave stale holds behind.
+func (h *Handler) HoldSeats(c *gin.Context) {
+	var body HoldBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if body.Minutes == 0 {
+		body.Minutes = DEFAULT_HOLD_MINUTES
+	}
+
+	if body.Minutes < 1 || body.Minutes > MAX_HOLD_MINUTES {
+		apierror.Abort(c, apierror.InvalidField("minutes", fmt.Sprintf("must be between 1 and %d", MAX_HOLD_MINUTES)))
+		return
+	}
+
+	showtime, ok := h.validateSeatRequest(c, body.ShowtimeID, body.Seats)
+	if !ok {
+		return
+	}
+
+	userId := users.ExtractUserIdFromClaims(c)
+
+	hold, err := h.reservations.CreateHold(showtime, userId, body.Seats, time.Duration(body.Minutes)*time.Minute)
+	if err == ErrSeatTaken {
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+type ConfirmHoldBody struct {
+	PaymentToken string `json:"payment_token"`
+}
+
+// ConfirmHold pays for an active hold and converts it into reservations.
+func (h *Handler) ConfirmHold(c *gin.Context) {
+	holdId, err := apierror.IDParam(c, "id", "hold")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	var body ConfirmHoldBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	userId := users.ExtractUserIdFromClaims(c)
+
+	hold, err := h.reservations.FindHold(holdId)
+	if err == ErrHoldNotFound || (err == nil && hold.UserID != userId) {
+		apierror.Abort(c, apierror.NotFound(ErrHoldNotFound.Error()))
+		return
+	}
+	if err != nil {
+		abortUncommitted(c, err)
+		return
+	}
+
+	if !hold.active() {
+		apierror.Abort(c, apierror.Gone(ErrHoldInactive.Error()))
+		return
+	}
+
+	showtime, err := h.reservations.FindShowtime(hold.ShowtimeID)
+	if err == ErrShowtimeNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		abortUncommitted(c, err)
+		return
+	}
+
+	if showtime.StartsAt.Before(time.Now()) {
+		apierror.Abort(c, apierror.Invalid("showtime already started"))
+		return
+	}
+
+	h.checkout(c, showtime, userId, hold.Seats, body.PaymentToken, func(checkout Checkout) error {
+		_, err := h.reservations.ConfirmHold(holdId, userId, checkout)
+		return err
+	})
+}
+
+// ReleaseHold lets a user give up a hold before it expires.
+func (h *Handler) ReleaseHold(c *gin.Context) {
+	holdId, err := apierror.IDParam(c, "id", "hold")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	err = h.reservations.ReleaseHold(holdId, users.ExtractUserIdFromClaims(c))
+	if err == ErrHoldNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if hold, err := h.reservations.FindHold(holdId); err == nil {
+		h.offerFreedSeats(c, hold.ShowtimeID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "hold released"})
+}
+
+// REMINDER_LEAD is how long before a showtime its bookings are reminded of
+// it.
+const REMINDER_LEAD = 24 * time.Hour
+
+// StartHoldSweeper releases expired holds, and the seats of payments that
+// timed out, offers them to the waitlists and queues showtime reminders every
+// interval until the process exits.
+func StartHoldSweeper(reservations ReservationRepository, provider payments.Provider, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			released, err := reservations.ReleaseExpiredHolds()
+			if err != nil {
+				slog.Error("releasing expired holds", "error", err)
+				continue
+			}
+
+			if released > 0 {
+				slog.Info("released expired holds", "count", released)
+			}
+
+			failed, err := FailStalePayments(reservations, provider, PAYMENT_TIMEOUT)
+			if err != nil {
+				slog.Error("failing stale payments", "error", err)
+				continue
+			}
+
+			if failed > 0 {
+				slog.Info("failed stale payments", "count", failed)
+			}
+
+			offerWaitlist(reservations)
+
+			reminded, err := reservations.QueueReminders(REMINDER_LEAD)
+			if err != nil {
+				slog.Error("queueing showtime reminders", "error", err)
+				continue
+			}
+
+			if reminded > 0 {
+				slog.Info("queued showtime reminders", "count", reminded)
+			}
+		}
+	}()
+}
+
+// offerWaitlist expires offers that were not claimed in time and offers the
+// seats freed since the last run to the waitlists.
+func offerWaitlist(reservations ReservationRepository) {
+	showtimeIds, err := reservations.ExpireOffers()
+	if err != nil {
+		slog.Error("expiring waitlist offers", "error", err)
+		return
+	}
+
+	for _, showtimeId := range showtimeIds {
+		offers, err := OfferFreedSeats(reservations, showtimeId)
+		if err != nil {
+			slog.Error("offering freed seats", "showtime_id", showtimeId, "error", err)
+			continue
+		}
+
+		if len(offers) > 0 {
+			slog.Info("offered seats to waitlist", "showtime_id", showtimeId, "count", len(offers))
+		}
+	}
+}
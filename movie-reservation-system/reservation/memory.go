@@ -0,0 +1,975 @@
+package reservation
+
+import (
+	"fmt"
+	"movie-reservation-system/halls"
+	"movie-reservation-system/movies"
+	"movie-reservation-system/notifications"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/showtimes"
+	"movie-reservation-system/users"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryReservation struct {
+	MovieID    int
+	UserID     int
+	ShowtimeID int
+	Date       time.Time
+	Seat       string
+	Price      int
+	Status     string
+	PaymentID  int
+	BookingID  string
+	RefundID   int
+	CreatedAt  time.Time
+	DeletedAt  *time.Time
+}
+
+// MemoryRepository keeps reservations and holds in memory, together with
+// the showtimes, halls, movies and users they refer to. It is meant for tests
+// and local experiments, not for production.
+type MemoryRepository struct {
+	mu            sync.Mutex
+	showtimes     map[int]showtimes.Showtime
+	halls         map[int]halls.Hall
+	movies        map[int]movies.Movie
+	users         map[int]users.User
+	reservations  []*memoryReservation
+	holds         map[int]*Hold
+	nextHoldId    int
+	payments      map[int]*payments.Payment
+	nextPaymentId int
+	waitlist      map[int]*memoryWaitlistEntry
+	nextEntryId   int
+	refunds       map[int]*memoryRefund
+	nextRefundId  int
+	outbox        *notifications.MemoryRepository
+}
+
+type memoryWaitlistEntry struct {
+	WaitlistEntry
+	HoldID int
+}
+
+type memoryRefund struct {
+	Refund
+	CreatedAt time.Time
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		showtimes:     make(map[int]showtimes.Showtime),
+		halls:         make(map[int]halls.Hall),
+		movies:        make(map[int]movies.Movie),
+		users:         make(map[int]users.User),
+		holds:         make(map[int]*Hold),
+		nextHoldId:    1,
+		payments:      make(map[int]*payments.Payment),
+		nextPaymentId: 1,
+		waitlist:      make(map[int]*memoryWaitlistEntry),
+		nextEntryId:   1,
+		refunds:       make(map[int]*memoryRefund),
+		nextRefundId:  1,
+		outbox:        notifications.NewMemoryRepository(),
+	}
+}
+
+// Outbox holds the notifications queued by the repository.
+func (r *MemoryRepository) Outbox() *notifications.MemoryRepository {
+	return r.outbox
+}
+
+// queueNotification addresses a notification to userId, who is skipped when
+// unknown like the users join of the Postgres outbox.
+func (r *MemoryRepository) queueNotification(userId int, kind string, data notifications.Data, dedupKey string) bool {
+	user, ok := r.users[userId]
+	if !ok {
+		return false
+	}
+
+	return r.outbox.Queue(&notifications.Notification{
+		UserID:        userId,
+		Kind:          kind,
+		Recipient:     user.Email,
+		RecipientName: user.Name,
+		Data:          data,
+		DedupKey:      dedupKey,
+	})
+}
+
+func (r *MemoryRepository) AddShowtime(showtime showtimes.Showtime) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.showtimes[showtime.ID] = showtime
+}
+
+func (r *MemoryRepository) AddHall(hall halls.Hall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.halls[hall.ID] = hall
+}
+
+func (r *MemoryRepository) AddMovie(movie movies.Movie) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.movies[movie.ID] = movie
+}
+
+func (r *MemoryRepository) AddUser(user users.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.ID] = user
+}
+
+func (r *MemoryRepository) FindShowtime(id int) (*showtimes.Showtime, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	showtime, ok := r.showtimes[id]
+	if !ok {
+		return nil, ErrShowtimeNotFound
+	}
+
+	return &showtime, nil
+}
+
+func (r *MemoryRepository) FindHall(id int) (*halls.Hall, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hall, ok := r.halls[id]
+	if !ok {
+		return nil, ErrHallNotFound
+	}
+
+	return &hall, nil
+}
+
+func (r *MemoryRepository) ListShowtimes(movieId int, from time.Time, to time.Time) ([]showtimes.Showtime, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := []showtimes.Showtime{}
+	for _, showtime := range r.showtimes {
+		if showtime.MovieID == movieId && !showtime.StartsAt.Before(from) && showtime.StartsAt.Before(to) {
+			list = append(list, showtime)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartsAt.Before(list[j].StartsAt) })
+
+	return list, nil
+}
+
+// takenSeats must be called with the lock held. Holds of exceptUserId are
+// left out.
+func (r *MemoryRepository) takenSeats(showtimeId int, exceptUserId int) (map[string]bool, map[string]bool) {
+	reserved := make(map[string]bool)
+	for _, reservation := range r.reservations {
+		if reservation.ShowtimeID == showtimeId && reservation.DeletedAt == nil {
+			reserved[reservation.Seat] = true
+		}
+	}
+
+	held := make(map[string]bool)
+	for _, hold := range r.holds {
+		if hold.ShowtimeID == showtimeId && hold.UserID != exceptUserId && hold.active() {
+			for _, seat := range hold.Seats {
+				held[seat] = true
+			}
+		}
+	}
+
+	return reserved, held
+}
+
+func (r *MemoryRepository) TakenSeats(showtimeId int) (map[string]bool, map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reserved, held := r.takenSeats(showtimeId, 0)
+	return reserved, held, nil
+}
+
+func (r *MemoryRepository) seatsTaken(showtimeId int, seats []string, userId int) bool {
+	reserved, held := r.takenSeats(showtimeId, userId)
+	for _, seat := range seats {
+		if reserved[seat] || held[seat] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *MemoryRepository) insertReservations(showtime *showtimes.Showtime, userId int, seats []string, checkout Checkout) {
+	for _, seat := range seats {
+		r.reservations = append(r.reservations, &memoryReservation{
+			MovieID:    showtime.MovieID,
+			UserID:     userId,
+			ShowtimeID: showtime.ID,
+			Date:       showtime.StartsAt,
+			Seat:       seat,
+			Price:      checkout.Prices[seat],
+			Status:     STATUS_PENDING_PAYMENT,
+			PaymentID:  checkout.PaymentID,
+			BookingID:  checkout.BookingID,
+			CreatedAt:  time.Now(),
+		})
+	}
+}
+
+func (r *MemoryRepository) Reserve(showtime *showtimes.Showtime, userId int, seats []string, checkout Checkout) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.seatsTaken(showtime.ID, seats, userId) {
+		return ErrSeatTaken
+	}
+
+	r.insertReservations(showtime, userId, seats, checkout)
+	return nil
+}
+
+func (r *MemoryRepository) ListByUser(userId int) ([]Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := []Reservation{}
+	for _, reservation := range r.reservations {
+		if reservation.UserID != userId || reservation.DeletedAt != nil {
+			continue
+		}
+
+		movie := r.movies[reservation.MovieID]
+		list = append(list, Reservation{
+			ShowtimeID: reservation.ShowtimeID,
+			Date:       reservation.Date.Format(time.RFC3339),
+			Seat:       reservation.Seat,
+			Price:      reservation.Price,
+			Status:     reservation.Status,
+			BookingID:  reservation.BookingID,
+			Title:      movie.Title,
+			ImageUrl:   movie.ImageUrl,
+		})
+	}
+
+	return list, nil
+}
+
+// findBooking must be called with the lock held.
+func (r *MemoryRepository) findBooking(id string) (*Booking, error) {
+	var booking *Booking
+	for _, reservation := range r.reservations {
+		if reservation.BookingID != id || reservation.DeletedAt != nil {
+			continue
+		}
+
+		if booking == nil {
+			booking = &Booking{
+				ID:         id,
+				UserID:     reservation.UserID,
+				MovieID:    reservation.MovieID,
+				ShowtimeID: reservation.ShowtimeID,
+				Date:       reservation.Date,
+				PaymentID:  reservation.PaymentID,
+				Seats:      []BookedSeat{},
+			}
+		}
+		booking.Seats = append(booking.Seats, BookedSeat{
+			Seat:   reservation.Seat,
+			Price:  reservation.Price,
+			Status: reservation.Status,
+		})
+	}
+
+	if booking == nil {
+		return nil, ErrBookingNotFound
+	}
+	sort.Slice(booking.Seats, func(i, j int) bool { return booking.Seats[i].Seat < booking.Seats[j].Seat })
+
+	return booking, nil
+}
+
+func (r *MemoryRepository) FindBooking(id string) (*Booking, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.findBooking(id)
+}
+
+func (r *MemoryRepository) CancelSeats(cancellations []Cancellation) ([]Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Check every cancellation first, so none is applied when one fails.
+	canceled := make([][]*memoryReservation, len(cancellations))
+	for i, cancellation := range cancellations {
+		seats := uniqueSeats(cancellation.Seats)
+		cancel := make(map[string]bool)
+		for _, seat := range seats {
+			cancel[seat] = true
+		}
+
+		for _, reservation := range r.reservations {
+			if reservation.BookingID == cancellation.BookingID && reservation.DeletedAt == nil && cancel[reservation.Seat] {
+				canceled[i] = append(canceled[i], reservation)
+			}
+		}
+
+		if len(canceled[i]) == 0 || len(canceled[i]) != len(seats) {
+			return nil, ErrBookingNotFound
+		}
+	}
+
+	now := time.Now()
+	refunds := []Refund{}
+	for i, cancellation := range cancellations {
+		seats := uniqueSeats(cancellation.Seats)
+		refund := Refund{BookingID: cancellation.BookingID, IdempotencyKey: refundKey(cancellation.BookingID, seats), Status: REFUND_PENDING}
+		for _, reservation := range canceled[i] {
+			// Reservations made before payments existed have nothing to refund.
+			if payment, ok := r.payments[reservation.PaymentID]; ok && reservation.Status == STATUS_PAID {
+				refund.Amount += reservation.Price
+				refund.PaymentID = payment.ID
+				refund.ProviderPaymentID = payment.ProviderID
+			}
+		}
+
+		if refund.Amount > 0 {
+			refund.ID = r.nextRefundId
+			r.nextRefundId++
+			r.refunds[refund.ID] = &memoryRefund{Refund: refund, CreatedAt: now}
+			refunds = append(refunds, refund)
+		}
+
+		for _, reservation := range canceled[i] {
+			reservation.DeletedAt = &now
+			if reservation.Status != STATUS_PAID {
+				continue
+			}
+
+			if _, ok := r.payments[reservation.PaymentID]; ok && refund.Amount > 0 {
+				reservation.Status = STATUS_REFUND_PENDING
+				reservation.RefundID = refund.ID
+			} else {
+				reservation.Status = STATUS_REFUNDED
+			}
+		}
+
+		first := canceled[i][0]
+		r.queueNotification(first.UserID, notifications.KIND_RESERVATION_CANCELED, notifications.Data{
+			BookingID: cancellation.BookingID,
+			Title:     r.movies[first.MovieID].Title,
+			StartsAt:  first.Date,
+			Seats:     seats,
+			Refund:    refund.Amount,
+		}, "")
+	}
+
+	return refunds, nil
+}
+
+func (r *MemoryRepository) CompleteRefund(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	refund, ok := r.refunds[id]
+	// Already completed by another attempt.
+	if !ok || refund.Status != REFUND_PENDING {
+		return nil
+	}
+	refund.Status = REFUND_REFUNDED
+
+	for _, reservation := range r.reservations {
+		if reservation.RefundID == id {
+			reservation.Status = STATUS_REFUNDED
+		}
+	}
+
+	if payment, ok := r.payments[refund.PaymentID]; ok {
+		payment.Refunded += refund.Amount
+		if payment.Refunded >= payment.Amount {
+			payment.Status = payments.PAYMENT_REFUNDED
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) PendingRefunds(olderThan time.Duration) ([]Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	list := []*memoryRefund{}
+	for _, refund := range r.refunds {
+		if refund.Status == REFUND_PENDING && !refund.CreatedAt.After(cutoff) {
+			list = append(list, refund)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	refunds := []Refund{}
+	for _, refund := range list {
+		refunds = append(refunds, refund.Refund)
+	}
+
+	return refunds, nil
+}
+
+func (r *MemoryRepository) ListForMovie(movieId int) ([]MovieReservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := []MovieReservation{}
+	for _, reservation := range r.reservations {
+		if reservation.MovieID != movieId {
+			continue
+		}
+
+		user := r.users[reservation.UserID]
+		movie := r.movies[reservation.MovieID]
+		list = append(list, MovieReservation{
+			Name:        user.Name,
+			Email:       user.Email,
+			Title:       movie.Title,
+			Description: movie.Description,
+			ImageUrl:    movie.ImageUrl,
+			Date:        reservation.Date,
+			Seat:        reservation.Seat,
+			Price:       reservation.Price,
+			Status:      reservation.Status,
+		})
+	}
+
+	return list, nil
+}
+
+func (r *MemoryRepository) Report(query ReportQuery) ([]ReportRow, error) {
+	if !REPORT_GROUPS[query.GroupBy] {
+		return nil, fmt.Errorf("unknown report grouping %s", query.GroupBy)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rows := make(map[string]*ReportRow)
+	customers := make(map[string]map[int]bool)
+	for _, reservation := range r.reservations {
+		canceled := reservation.DeletedAt != nil
+		if canceled && reservation.Status == STATUS_PENDING_PAYMENT {
+			continue
+		}
+
+		date := reservation.Date
+		if query.GroupBy == REPORT_BY_BOOKING_DAY {
+			date = reservation.CreatedAt
+		}
+		if date.Before(query.From) || !date.Before(query.To) {
+			continue
+		}
+		if query.MovieID != 0 && reservation.MovieID != query.MovieID {
+			continue
+		}
+
+		key := date.In(query.Location).Format(REPORT_DAY_LAYOUT)
+		if query.GroupBy == REPORT_BY_MOVIE {
+			key = fmt.Sprint(reservation.MovieID)
+		}
+
+		row, ok := rows[key]
+		if !ok {
+			row = &ReportRow{}
+			if query.GroupBy == REPORT_BY_MOVIE {
+				row.MovieID = reservation.MovieID
+				row.Title = r.movies[reservation.MovieID].Title
+			} else {
+				row.Day = key
+			}
+			rows[key] = row
+			customers[key] = make(map[int]bool)
+		}
+
+		customers[key][reservation.UserID] = true
+		switch {
+		case canceled:
+			row.Canceled++
+		case reservation.Status == STATUS_PAID:
+			row.Seats++
+			row.Revenue += reservation.Price
+		default:
+			row.Seats++
+		}
+		if reservation.Status == STATUS_REFUNDED || reservation.Status == STATUS_REFUND_PENDING {
+			row.Refunded += reservation.Price
+		}
+	}
+
+	report := []ReportRow{}
+	for key, row := range rows {
+		row.Customers = len(customers[key])
+		row.computeRate()
+		report = append(report, *row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Title != report[j].Title {
+			return report[i].Title < report[j].Title
+		}
+		if report[i].MovieID != report[j].MovieID {
+			return report[i].MovieID < report[j].MovieID
+		}
+		return report[i].Day < report[j].Day
+	})
+
+	return report, nil
+}
+
+func (r *MemoryRepository) CreateHold(showtime *showtimes.Showtime, userId int, seats []string, duration time.Duration) (*Hold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.seatsTaken(showtime.ID, seats, userId) {
+		return nil, ErrSeatTaken
+	}
+
+	now := time.Now()
+	for _, hold := range r.holds {
+		if hold.ShowtimeID == showtime.ID && hold.UserID == userId && hold.ConfirmedAt == nil && hold.ReleasedAt == nil {
+			hold.ReleasedAt = &now
+		}
+	}
+
+	hold := &Hold{
+		ID:         r.nextHoldId,
+		ShowtimeID: showtime.ID,
+		UserID:     userId,
+		Seats:      append([]string{}, seats...),
+		ExpiresAt:  now.Add(duration),
+	}
+	r.nextHoldId++
+	r.holds[hold.ID] = hold
+
+	result := *hold
+	return &result, nil
+}
+
+func (r *MemoryRepository) FindHold(id int) (*Hold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hold, ok := r.holds[id]
+	if !ok {
+		return nil, ErrHoldNotFound
+	}
+
+	result := *hold
+	return &result, nil
+}
+
+func (r *MemoryRepository) ConfirmHold(id int, userId int, checkout Checkout) (*Hold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hold, ok := r.holds[id]
+	if !ok || hold.UserID != userId {
+		return nil, ErrHoldNotFound
+	}
+
+	if !hold.active() {
+		return nil, ErrHoldInactive
+	}
+
+	showtime, ok := r.showtimes[hold.ShowtimeID]
+	if !ok {
+		return nil, ErrShowtimeNotFound
+	}
+
+	reserved, _ := r.takenSeats(hold.ShowtimeID, userId)
+	for _, seat := range hold.Seats {
+		if reserved[seat] {
+			return nil, ErrSeatTaken
+		}
+	}
+
+	r.insertReservations(&showtime, userId, hold.Seats, checkout)
+	now := time.Now()
+	hold.ConfirmedAt = &now
+
+	for _, entry := range r.waitlist {
+		if entry.HoldID == hold.ID && entry.Status == WAITLIST_OFFERED {
+			entry.Status = WAITLIST_CLAIMED
+		}
+	}
+
+	result := *hold
+	return &result, nil
+}
+
+func (r *MemoryRepository) ReleaseHold(id int, userId int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hold, ok := r.holds[id]
+	if !ok || hold.UserID != userId || hold.ConfirmedAt != nil || hold.ReleasedAt != nil {
+		return ErrHoldNotFound
+	}
+
+	now := time.Now()
+	hold.ReleasedAt = &now
+	return nil
+}
+
+func (r *MemoryRepository) ReleaseExpiredHolds() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var released int64
+	now := time.Now()
+	for _, hold := range r.holds {
+		if hold.ConfirmedAt == nil && hold.ReleasedAt == nil && !hold.ExpiresAt.After(now) {
+			expiresAt := hold.ExpiresAt
+			hold.ReleasedAt = &expiresAt
+			released++
+		}
+	}
+
+	return released, nil
+}
+
+func (r *MemoryRepository) QueueReminders(lead time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	bookings := make(map[string][]*memoryReservation)
+	order := []string{}
+	for _, reservation := range r.reservations {
+		if reservation.Status != STATUS_PAID || reservation.DeletedAt != nil {
+			continue
+		}
+		if !reservation.Date.After(now) || reservation.Date.After(now.Add(lead)) || reservation.CreatedAt.After(reservation.Date.Add(-lead)) {
+			continue
+		}
+
+		if _, ok := bookings[reservation.BookingID]; !ok {
+			order = append(order, reservation.BookingID)
+		}
+		bookings[reservation.BookingID] = append(bookings[reservation.BookingID], reservation)
+	}
+
+	var queued int64
+	for _, bookingId := range order {
+		reservations := bookings[bookingId]
+		data := notifications.Data{
+			BookingID: bookingId,
+			Title:     r.movies[reservations[0].MovieID].Title,
+			StartsAt:  reservations[0].Date,
+			Seats:     []string{},
+		}
+		for _, reservation := range reservations {
+			data.Seats = append(data.Seats, reservation.Seat)
+		}
+		sort.Strings(data.Seats)
+
+		if r.queueNotification(reservations[0].UserID, notifications.KIND_SHOWTIME_REMINDER, data, "reminder:"+bookingId) {
+			queued++
+		}
+	}
+
+	return queued, nil
+}
+
+func (r *MemoryRepository) CreatePayment(payment *payments.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment.ID = r.nextPaymentId
+	payment.CreatedAt = time.Now()
+	r.nextPaymentId++
+
+	stored := *payment
+	r.payments[payment.ID] = &stored
+	return nil
+}
+
+func (r *MemoryRepository) FindPayment(id int) (*payments.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment, ok := r.payments[id]
+	if !ok {
+		return nil, payments.ErrPaymentNotFound
+	}
+
+	result := *payment
+	return &result, nil
+}
+
+func (r *MemoryRepository) FindPaymentByProviderId(provider string, providerId string) (*payments.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, payment := range r.payments {
+		if payment.Provider == provider && payment.ProviderID == providerId {
+			result := *payment
+			return &result, nil
+		}
+	}
+
+	return nil, payments.ErrPaymentNotFound
+}
+
+// setPaymentStatus must be called with the lock held.
+// queuePaymentNotifications queues a notification of kind about each booking
+// of a payment that still has seats.
+func (r *MemoryRepository) queuePaymentNotifications(paymentId int, kind string) {
+	bookings := make(map[string]*notifications.Data)
+	owners := make(map[string]int)
+	order := []string{}
+	for _, reservation := range r.reservations {
+		if reservation.PaymentID != paymentId || reservation.DeletedAt != nil {
+			continue
+		}
+
+		data, ok := bookings[reservation.BookingID]
+		if !ok {
+			data = &notifications.Data{
+				BookingID: reservation.BookingID,
+				Title:     r.movies[reservation.MovieID].Title,
+				StartsAt:  reservation.Date,
+				Seats:     []string{},
+			}
+			bookings[reservation.BookingID] = data
+			owners[reservation.BookingID] = reservation.UserID
+			order = append(order, reservation.BookingID)
+		}
+		data.Seats = append(data.Seats, reservation.Seat)
+		data.Total += reservation.Price
+	}
+
+	for _, bookingId := range order {
+		sort.Strings(bookings[bookingId].Seats)
+		r.queueNotification(owners[bookingId], kind, *bookings[bookingId], "")
+	}
+}
+
+func (r *MemoryRepository) setPaymentStatus(id int, status string, providerId string) error {
+	payment, ok := r.payments[id]
+	if !ok {
+		return payments.ErrPaymentNotFound
+	}
+
+	if payment.Status == status {
+		return nil
+	}
+
+	if !payments.CanTransition(payment.Status, status) {
+		return payments.ErrInvalidTransition
+	}
+
+	if kind, ok := paymentNotifications[status]; ok {
+		r.queuePaymentNotifications(id, kind)
+	}
+
+	payment.Status = status
+	if status == payments.PAYMENT_REFUNDED {
+		payment.Refunded = payment.Amount
+	}
+	if providerId != "" {
+		payment.ProviderID = providerId
+	}
+
+	now := time.Now()
+	for _, reservation := range r.reservations {
+		if reservation.PaymentID != id {
+			continue
+		}
+
+		switch status {
+		case payments.PAYMENT_CAPTURED:
+			if reservation.DeletedAt == nil {
+				reservation.Status = STATUS_PAID
+			}
+		case payments.PAYMENT_FAILED:
+			if reservation.DeletedAt == nil {
+				reservation.DeletedAt = &now
+			}
+		case payments.PAYMENT_REFUNDED:
+			reservation.Status = STATUS_REFUNDED
+			if reservation.DeletedAt == nil {
+				reservation.DeletedAt = &now
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) SetPaymentStatus(id int, status string, providerId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.setPaymentStatus(id, status, providerId)
+}
+
+func (r *MemoryRepository) StalePayments(olderThan time.Duration) ([]payments.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	stale := []payments.Payment{}
+	for _, payment := range r.payments {
+		open := payment.Status == payments.PAYMENT_PENDING || payment.Status == payments.PAYMENT_AUTHORIZED
+		if open && !payment.CreatedAt.After(cutoff) {
+			stale = append(stale, *payment)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].ID < stale[j].ID
+	})
+
+	return stale, nil
+}
+
+func (r *MemoryRepository) JoinWaitlist(entry *WaitlistEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.waitlist {
+		if other.ShowtimeID == entry.ShowtimeID && other.UserID == entry.UserID &&
+			(other.Status == WAITLIST_WAITING || other.Status == WAITLIST_OFFERED) {
+			return ErrAlreadyWaitlisted
+		}
+	}
+
+	entry.ID = r.nextEntryId
+	entry.Status = WAITLIST_WAITING
+	entry.CreatedAt = time.Now()
+	r.nextEntryId++
+	r.waitlist[entry.ID] = &memoryWaitlistEntry{WaitlistEntry: *entry}
+
+	return nil
+}
+
+// waitlistEntry copies entry with its offer. Callers hold the lock.
+func (r *MemoryRepository) waitlistEntry(entry *memoryWaitlistEntry) WaitlistEntry {
+	result := entry.WaitlistEntry
+	if hold, ok := r.holds[entry.HoldID]; ok {
+		copied := *hold
+		result.Hold = &copied
+	}
+
+	return result
+}
+
+func (r *MemoryRepository) ListWaitlist(userId int) ([]WaitlistEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := []WaitlistEntry{}
+	for _, entry := range r.waitlist {
+		if entry.UserID == userId {
+			entries = append(entries, r.waitlistEntry(entry))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+
+	return entries, nil
+}
+
+func (r *MemoryRepository) LeaveWaitlist(id int, userId int) (*WaitlistEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.waitlist[id]
+	if !ok || entry.UserID != userId || (entry.Status != WAITLIST_WAITING && entry.Status != WAITLIST_OFFERED) {
+		return nil, ErrWaitlistEntryNotFound
+	}
+
+	entry.Status = WAITLIST_LEFT
+	if hold, ok := r.holds[entry.HoldID]; ok && hold.ConfirmedAt == nil && hold.ReleasedAt == nil {
+		now := time.Now()
+		hold.ReleasedAt = &now
+	}
+
+	result := r.waitlistEntry(entry)
+	return &result, nil
+}
+
+func (r *MemoryRepository) WaitingEntries(showtimeId int) ([]WaitlistEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := []WaitlistEntry{}
+	for _, entry := range r.waitlist {
+		if entry.ShowtimeID == showtimeId && entry.Status == WAITLIST_WAITING {
+			entries = append(entries, entry.WaitlistEntry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	return entries, nil
+}
+
+func (r *MemoryRepository) OfferSeats(entryId int, showtime *showtimes.Showtime, seats []string, duration time.Duration) (*Hold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.waitlist[entryId]
+	if !ok || entry.Status != WAITLIST_WAITING {
+		return nil, ErrWaitlistEntryNotFound
+	}
+
+	if r.seatsTaken(showtime.ID, seats, 0) {
+		return nil, ErrSeatTaken
+	}
+
+	hold := &Hold{
+		ID:         r.nextHoldId,
+		ShowtimeID: showtime.ID,
+		UserID:     entry.UserID,
+		Seats:      append([]string{}, seats...),
+		ExpiresAt:  time.Now().Add(duration),
+	}
+	r.nextHoldId++
+	r.holds[hold.ID] = hold
+
+	entry.Status = WAITLIST_OFFERED
+	entry.HoldID = hold.ID
+
+	result := *hold
+	return &result, nil
+}
+
+func (r *MemoryRepository) ExpireOffers() ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.waitlist {
+		hold, ok := r.holds[entry.HoldID]
+		if entry.Status == WAITLIST_OFFERED && ok && hold.ConfirmedAt == nil && !hold.active() {
+			entry.Status = WAITLIST_EXPIRED
+		}
+	}
+
+	waiting := make(map[int]bool)
+	for _, entry := range r.waitlist {
+		showtime, ok := r.showtimes[entry.ShowtimeID]
+		if entry.Status == WAITLIST_WAITING && ok && showtime.StartsAt.After(time.Now()) {
+			waiting[entry.ShowtimeID] = true
+		}
+	}
+
+	showtimeIds := []int{}
+	for id := range waiting {
+		showtimeIds = append(showtimeIds, id)
+	}
+	sort.Ints(showtimeIds)
+
+	return showtimeIds, nil
+}
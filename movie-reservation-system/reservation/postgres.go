@@ -0,0 +1,1273 @@
+package reservation
+
+import (
+	"database/sql"
+	"fmt"
+	"movie-reservation-system/database"
+	"movie-reservation-system/halls"
+	"movie-reservation-system/notifications"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/showtimes"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	db *database.DB
+}
+
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func (r *PostgresRepository) FindShowtime(id int) (*showtimes.Showtime, error) {
+	var showtime showtimes.Showtime
+	err := r.db.QueryRow(`
+		SELECT s.id, s.movie_id, s.hall_id, h.name, s.starts_at
+		FROM showtimes s
+		JOIN halls h ON s.hall_id = h.id
+		WHERE s.id = $1
+	`, id).Scan(&showtime.ID, &showtime.MovieID, &showtime.HallID, &showtime.HallName, &showtime.StartsAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrShowtimeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &showtime, nil
+}
+
+func (r *PostgresRepository) FindHall(id int) (*halls.Hall, error) {
+	var hall halls.Hall
+	err := r.db.QueryRow(`
+		SELECT id, name, rows, columns, disabled_seats FROM halls WHERE id = $1
+	`, id).Scan(&hall.ID, &hall.Name, &hall.Rows, &hall.Columns, pq.Array(&hall.DisabledSeats))
+	if err == sql.ErrNoRows {
+		return nil, ErrHallNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT category, rows FROM hall_seat_categories WHERE hall_id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hall.Categories = make(map[string][]string)
+	for rows.Next() {
+		var category string
+		var categoryRows []string
+		if err := rows.Scan(&category, pq.Array(&categoryRows)); err != nil {
+			return nil, err
+		}
+		hall.Categories[category] = categoryRows
+	}
+
+	return &hall, rows.Err()
+}
+
+func (r *PostgresRepository) ListShowtimes(movieId int, from time.Time, to time.Time) ([]showtimes.Showtime, error) {
+	rows, err := r.db.Query(`
+		SELECT s.id, s.movie_id, s.hall_id, h.name, s.starts_at
+		FROM showtimes s
+		JOIN halls h ON s.hall_id = h.id
+		WHERE s.movie_id = $1 AND s.starts_at >= $2 AND s.starts_at < $3
+		ORDER BY s.starts_at
+	`, movieId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []showtimes.Showtime{}
+	var showtime showtimes.Showtime
+	for rows.Next() {
+		err := rows.Scan(&showtime.ID, &showtime.MovieID, &showtime.HallID, &showtime.HallName, &showtime.StartsAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, showtime)
+	}
+
+	return list, rows.Err()
+}
+
+func (r *PostgresRepository) TakenSeats(showtimeId int) (map[string]bool, map[string]bool, error) {
+	rows, err := r.db.Query(`
+		SELECT seat, 'reserved' FROM Reservation
+		WHERE showtime_id = $1 AND deleted_at IS NULL
+		UNION ALL
+		SELECT hs.seat, 'held' FROM hold_seats hs
+		JOIN holds h ON hs.hold_id = h.id
+		WHERE h.showtime_id = $1
+			AND h.confirmed_at IS NULL
+			AND h.released_at IS NULL
+			AND h.expires_at > NOW()
+	`, showtimeId)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	reserved := make(map[string]bool)
+	held := make(map[string]bool)
+	for rows.Next() {
+		var seat, state string
+		err := rows.Scan(&seat, &state)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if state == SEAT_HELD {
+			held[halls.NormalizeSeat(seat)] = true
+		} else {
+			reserved[halls.NormalizeSeat(seat)] = true
+		}
+	}
+
+	return reserved, held, rows.Err()
+}
+
+// lockShowtime serializes every seat-taking transaction of a showtime so two
+// requests cannot both see a seat as free and take it.
+func lockShowtime(tx *sql.Tx, showtimeId int) error {
+	_, err := tx.Exec("SELECT id FROM showtimes WHERE id = $1 FOR UPDATE", showtimeId)
+	return err
+}
+
+// seatsTaken reports whether any of the seats is reserved, or held by a user
+// other than userId. Must be called after lockShowtime.
+func seatsTaken(tx *sql.Tx, showtimeId int, seats []string, userId int) (bool, error) {
+	exists := false
+	err := tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM Reservation
+			WHERE showtime_id = $1
+				AND seat = ANY($2)
+				AND deleted_at IS NULL
+		) OR EXISTS (
+			SELECT 1 FROM hold_seats hs
+			JOIN holds h ON hs.hold_id = h.id
+			WHERE h.showtime_id = $1
+				AND hs.seat = ANY($2)
+				AND h.user_id <> $3
+				AND h.confirmed_at IS NULL
+				AND h.released_at IS NULL
+				AND h.expires_at > NOW()
+		)
+	`, showtimeId, pq.Array(seats), userId).Scan(&exists)
+
+	return exists, err
+}
+
+func insertReservations(tx *sql.Tx, showtime *showtimes.Showtime, userId int, seats []string, checkout Checkout) error {
+	for _, seat := range seats {
+		_, err := tx.Exec(`
+			INSERT INTO Reservation (movie_id, user_id, showtime_id, date, seat, price_cents, status, payment_id, booking_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, showtime.MovieID, userId, showtime.ID, showtime.StartsAt, seat, checkout.Prices[seat], STATUS_PENDING_PAYMENT, checkout.PaymentID, checkout.BookingID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+				return ErrSeatTaken
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) Reserve(showtime *showtimes.Showtime, userId int, seats []string, checkout Checkout) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	err = lockShowtime(tx, showtime.ID)
+	if err != nil {
+		return err
+	}
+
+	taken, err := seatsTaken(tx, showtime.ID, seats, userId)
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return ErrSeatTaken
+	}
+
+	err = insertReservations(tx, showtime, userId, seats, checkout)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) ListByUser(userId int) ([]Reservation, error) {
+	query := `
+		SELECT
+			COALESCE(r.showtime_id, 0),
+			r.date,
+			r.seat,
+			r.price_cents,
+			r.status,
+			r.booking_id,
+			m.title,
+			m.image_url
+		FROM
+			Reservation r
+		JOIN
+			Movies m ON r.movie_id = m.id
+		WHERE
+			r.user_id = $1 AND r.deleted_at IS NULL
+		`
+
+	rows, err := r.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reservations := []Reservation{}
+	var reservation Reservation
+
+	for rows.Next() {
+		err := rows.Scan(&reservation.ShowtimeID, &reservation.Date, &reservation.Seat, &reservation.Price, &reservation.Status, &reservation.BookingID, &reservation.Title, &reservation.ImageUrl)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	return reservations, rows.Err()
+}
+
+func (r *PostgresRepository) FindBooking(id string) (*Booking, error) {
+	rows, err := r.db.Query(`
+		SELECT user_id, movie_id, COALESCE(showtime_id, 0), date, COALESCE(payment_id, 0), seat, price_cents, status
+		FROM Reservation
+		WHERE booking_id = $1 AND deleted_at IS NULL
+		ORDER BY seat
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	booking := Booking{ID: id, Seats: []BookedSeat{}}
+	for rows.Next() {
+		var seat BookedSeat
+		err := rows.Scan(
+			&booking.UserID,
+			&booking.MovieID,
+			&booking.ShowtimeID,
+			&booking.Date,
+			&booking.PaymentID,
+			&seat.Seat,
+			&seat.Price,
+			&seat.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		booking.Seats = append(booking.Seats, seat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(booking.Seats) == 0 {
+		return nil, ErrBookingNotFound
+	}
+
+	return &booking, nil
+}
+
+func (r *PostgresRepository) CancelSeats(cancellations []Cancellation) ([]Refund, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	refunds := []Refund{}
+	for _, cancellation := range cancellations {
+		refund, err := cancelSeats(tx, cancellation)
+		if err != nil {
+			return nil, err
+		}
+
+		if refund != nil {
+			refunds = append(refunds, *refund)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+// cancelSeats locks the seats of a cancellation, records the refund of the
+// paid ones and releases them.
+func cancelSeats(tx *sql.Tx, cancellation Cancellation) (*Refund, error) {
+	seats := uniqueSeats(cancellation.Seats)
+
+	rows, err := tx.Query(`
+		SELECT r.status, r.price_cents, r.user_id, r.date, m.title,
+			COALESCE(p.id, 0), COALESCE(p.provider_payment_id, '')
+		FROM Reservation r
+		JOIN Movies m ON r.movie_id = m.id
+		LEFT JOIN payments p ON r.payment_id = p.id
+		WHERE r.booking_id = $1 AND r.seat = ANY($2) AND r.deleted_at IS NULL
+		FOR UPDATE OF r
+	`, cancellation.BookingID, pq.Array(seats))
+	if err != nil {
+		return nil, err
+	}
+
+	found, userId := 0, 0
+	data := notifications.Data{BookingID: cancellation.BookingID, Seats: seats}
+	refund := Refund{BookingID: cancellation.BookingID, IdempotencyKey: refundKey(cancellation.BookingID, seats), Status: REFUND_PENDING}
+	for rows.Next() {
+		var status string
+		var price, paymentId int
+		var providerId string
+		err := rows.Scan(&status, &price, &userId, &data.StartsAt, &data.Title, &paymentId, &providerId)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		found++
+		// Reservations made before payments existed have nothing to refund.
+		if status == STATUS_PAID && paymentId != 0 {
+			refund.Amount += price
+			refund.PaymentID = paymentId
+			refund.ProviderPaymentID = providerId
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A seat canceled by a concurrent request is no longer there.
+	if found == 0 || found != len(seats) {
+		return nil, ErrBookingNotFound
+	}
+
+	var refundId sql.NullInt64
+	if refund.Amount > 0 {
+		err = tx.QueryRow(`
+			INSERT INTO refunds (payment_id, booking_id, amount_cents, idempotency_key)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, refund.PaymentID, refund.BookingID, refund.Amount, refund.IdempotencyKey).Scan(&refund.ID)
+		if err != nil {
+			return nil, err
+		}
+		refundId = sql.NullInt64{Int64: int64(refund.ID), Valid: true}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Reservation
+		SET deleted_at = NOW(),
+			status = CASE
+				WHEN status <> 'paid' THEN status
+				WHEN $3::INTEGER IS NULL OR payment_id IS NULL THEN 'refunded'
+				ELSE 'refund_pending'
+			END,
+			refund_id = CASE WHEN status = 'paid' AND payment_id IS NOT NULL THEN $3::INTEGER END
+		WHERE booking_id = $1 AND seat = ANY($2) AND deleted_at IS NULL
+	`, cancellation.BookingID, pq.Array(seats), refundId)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Refund = refund.Amount
+	err = notifications.Queue(tx, userId, notifications.KIND_RESERVATION_CANCELED, data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if refund.Amount == 0 {
+		return nil, nil
+	}
+
+	return &refund, nil
+}
+
+func (r *PostgresRepository) CompleteRefund(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var paymentId, amount int
+	err = tx.QueryRow(`
+		UPDATE refunds SET status = 'refunded', updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING payment_id, amount_cents
+	`, id).Scan(&paymentId, &amount)
+	// Already completed by another attempt.
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Reservation SET status = 'refunded' WHERE refund_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE payments
+		SET refunded_cents = refunded_cents + $2,
+			status = CASE WHEN refunded_cents + $2 >= amount_cents THEN 'refunded' ELSE status END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, paymentId, amount)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) PendingRefunds(olderThan time.Duration) ([]Refund, error) {
+	rows, err := r.db.Query(`
+		SELECT f.id, f.payment_id, COALESCE(p.provider_payment_id, ''), f.booking_id,
+			f.amount_cents, f.idempotency_key, f.status
+		FROM refunds f
+		JOIN payments p ON f.payment_id = p.id
+		WHERE f.status = 'pending' AND f.created_at <= NOW() - make_interval(secs => $1)
+		ORDER BY f.created_at
+	`, olderThan.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	refunds := []Refund{}
+	for rows.Next() {
+		var refund Refund
+		err := rows.Scan(
+			&refund.ID,
+			&refund.PaymentID,
+			&refund.ProviderPaymentID,
+			&refund.BookingID,
+			&refund.Amount,
+			&refund.IdempotencyKey,
+			&refund.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, rows.Err()
+}
+
+func (r *PostgresRepository) ListForMovie(movieId int) ([]MovieReservation, error) {
+	query := `
+    SELECT
+      u.name,
+      u.email,
+      m.title,
+      m.description,
+      m.image_url,
+      r.date,
+      r.seat,
+      r.price_cents,
+      r.status
+    FROM reservation r
+    JOIN users u ON r.user_id = u.id
+    JOIN movies m ON r.movie_id = m.id
+    WHERE movie_id = $1
+  `
+
+	rows, err := r.db.Query(query, movieId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reservations := []MovieReservation{}
+	var reservation MovieReservation
+	for rows.Next() {
+		err := rows.Scan(
+			&reservation.Name,
+			&reservation.Email,
+			&reservation.Title,
+			&reservation.Description,
+			&reservation.ImageUrl,
+			&reservation.Date,
+			&reservation.Seat,
+			&reservation.Price,
+			&reservation.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	return reservations, rows.Err()
+}
+
+// reportGroups are the key columns, range column and order of each report.
+// Day keys take the time zone as $4, which only they are passed.
+var reportGroups = map[string]struct {
+	key, dateColumn, order string
+	byDay                  bool
+}{
+	REPORT_BY_MOVIE:       {"r.movie_id, m.title, ''", "r.date", "m.title, r.movie_id", false},
+	REPORT_BY_DATE:        {"0, '', to_char(r.date AT TIME ZONE $4, 'YYYY-MM-DD')", "r.date", "3", true},
+	REPORT_BY_BOOKING_DAY: {"0, '', to_char(r.created_at AT TIME ZONE $4, 'YYYY-MM-DD')", "r.created_at", "3", true},
+}
+
+func (r *PostgresRepository) Report(query ReportQuery) ([]ReportRow, error) {
+	group, ok := reportGroups[query.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown report grouping %s", query.GroupBy)
+	}
+
+	args := []interface{}{query.From, query.To, query.MovieID}
+	if group.byDay {
+		args = append(args, query.Location.String())
+	}
+
+	rows, err := r.db.Query(`
+		SELECT
+			`+group.key+`,
+			COUNT(*) FILTER (WHERE r.deleted_at IS NULL),
+			COUNT(*) FILTER (WHERE r.deleted_at IS NOT NULL),
+			COUNT(DISTINCT r.user_id),
+			COALESCE(SUM(r.price_cents) FILTER (WHERE r.deleted_at IS NULL AND r.status = 'paid'), 0),
+			COALESCE(SUM(r.price_cents) FILTER (WHERE r.status IN ('refunded', 'refund_pending')), 0)
+		FROM Reservation r
+		JOIN movies m ON m.id = r.movie_id
+		WHERE NOT (r.deleted_at IS NOT NULL AND r.status = 'pending_payment')
+			AND `+group.dateColumn+` >= $1 AND `+group.dateColumn+` < $2
+			AND ($3 = 0 OR r.movie_id = $3)
+		GROUP BY 1, 2, 3
+		ORDER BY `+group.order+`
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []ReportRow{}
+	for rows.Next() {
+		var row ReportRow
+		err := rows.Scan(
+			&row.MovieID,
+			&row.Title,
+			&row.Day,
+			&row.Seats,
+			&row.Canceled,
+			&row.Customers,
+			&row.Revenue,
+			&row.Refunded,
+		)
+		if err != nil {
+			return nil, err
+		}
+		row.computeRate()
+		report = append(report, row)
+	}
+
+	return report, rows.Err()
+}
+
+func (r *PostgresRepository) CreateHold(showtime *showtimes.Showtime, userId int, seats []string, duration time.Duration) (*Hold, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	err = lockShowtime(tx, showtime.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE holds SET released_at = NOW()
+		WHERE showtime_id = $1 AND user_id = $2
+			AND confirmed_at IS NULL AND released_at IS NULL
+	`, showtime.ID, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := seatsTaken(tx, showtime.ID, seats, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if taken {
+		return nil, ErrSeatTaken
+	}
+
+	hold, err := insertHold(tx, showtime, userId, seats, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, tx.Commit()
+}
+
+func insertHold(tx *sql.Tx, showtime *showtimes.Showtime, userId int, seats []string, duration time.Duration) (*Hold, error) {
+	hold := Hold{ShowtimeID: showtime.ID, UserID: userId, Seats: seats}
+	err := tx.QueryRow(`
+		INSERT INTO holds (showtime_id, user_id, expires_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3))
+		RETURNING id, expires_at
+	`, showtime.ID, userId, duration.Seconds()).Scan(&hold.ID, &hold.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seat := range seats {
+		_, err = tx.Exec(`
+			INSERT INTO hold_seats (hold_id, seat) VALUES ($1, $2)
+		`, hold.ID, seat)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &hold, nil
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func findHold(db queryRower, id int, forUpdate bool) (*Hold, error) {
+	query := `
+		SELECT h.id, h.showtime_id, h.user_id, h.expires_at, h.confirmed_at, h.released_at,
+			ARRAY(SELECT seat FROM hold_seats WHERE hold_id = h.id ORDER BY seat)
+		FROM holds h
+		WHERE h.id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var hold Hold
+	err := db.QueryRow(query, id).Scan(
+		&hold.ID,
+		&hold.ShowtimeID,
+		&hold.UserID,
+		&hold.ExpiresAt,
+		&hold.ConfirmedAt,
+		&hold.ReleasedAt,
+		pq.Array(&hold.Seats),
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+func (r *PostgresRepository) FindHold(id int) (*Hold, error) {
+	return findHold(r.db, id, false)
+}
+
+func (r *PostgresRepository) ConfirmHold(id int, userId int, checkout Checkout) (*Hold, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	hold, err := findHold(tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.UserID != userId {
+		return nil, ErrHoldNotFound
+	}
+
+	if !hold.active() {
+		return nil, ErrHoldInactive
+	}
+
+	showtime, err := r.FindShowtime(hold.ShowtimeID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockShowtime(tx, showtime.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertReservations(tx, showtime, userId, hold.Seats, checkout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE holds SET confirmed_at = NOW() WHERE id = $1 RETURNING confirmed_at
+	`, hold.ID).Scan(&hold.ConfirmedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE waitlist_entries SET status = 'claimed', updated_at = NOW()
+		WHERE hold_id = $1 AND status = 'offered'
+	`, hold.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, tx.Commit()
+}
+
+func (r *PostgresRepository) ReleaseHold(id int, userId int) error {
+	res, err := r.db.Exec(`
+		UPDATE holds SET released_at = NOW()
+		WHERE id = $1 AND user_id = $2
+			AND confirmed_at IS NULL AND released_at IS NULL
+	`, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrHoldNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) ReleaseExpiredHolds() (int64, error) {
+	res, err := r.db.Exec(`
+		UPDATE holds SET released_at = expires_at
+		WHERE expires_at <= NOW() AND confirmed_at IS NULL AND released_at IS NULL
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "unique_violation"
+}
+
+func (r *PostgresRepository) JoinWaitlist(entry *WaitlistEntry) error {
+	entry.Status = WAITLIST_WAITING
+	err := r.db.QueryRow(`
+		INSERT INTO waitlist_entries (showtime_id, user_id, seats, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, entry.ShowtimeID, entry.UserID, entry.Seats, entry.Status).Scan(&entry.ID, &entry.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrAlreadyWaitlisted
+	}
+
+	return err
+}
+
+const waitlistColumns = `
+	w.id, w.showtime_id, w.user_id, w.seats, w.status, w.created_at,
+	h.id, h.expires_at, h.confirmed_at, h.released_at,
+	ARRAY(SELECT seat FROM hold_seats WHERE hold_id = h.id ORDER BY seat)
+`
+
+func scanWaitlistEntry(row interface{ Scan(...interface{}) error }) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	var holdId sql.NullInt64
+	var expiresAt sql.NullTime
+	var hold Hold
+	err := row.Scan(
+		&entry.ID,
+		&entry.ShowtimeID,
+		&entry.UserID,
+		&entry.Seats,
+		&entry.Status,
+		&entry.CreatedAt,
+		&holdId,
+		&expiresAt,
+		&hold.ConfirmedAt,
+		&hold.ReleasedAt,
+		pq.Array(&hold.Seats),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if holdId.Valid {
+		hold.ID = int(holdId.Int64)
+		hold.ShowtimeID = entry.ShowtimeID
+		hold.UserID = entry.UserID
+		hold.ExpiresAt = expiresAt.Time
+		entry.Hold = &hold
+	}
+
+	return &entry, nil
+}
+
+func (r *PostgresRepository) ListWaitlist(userId int) ([]WaitlistEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries w
+		LEFT JOIN holds h ON w.hold_id = h.id
+		WHERE w.user_id = $1
+		ORDER BY w.id DESC
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *PostgresRepository) LeaveWaitlist(id int, userId int) (*WaitlistEntry, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	entry, err := scanWaitlistEntry(tx.QueryRow(`
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries w
+		LEFT JOIN holds h ON w.hold_id = h.id
+		WHERE w.id = $1 AND w.user_id = $2 AND w.status IN ('waiting', 'offered')
+		FOR UPDATE OF w
+	`, id, userId))
+	if err == sql.ErrNoRows {
+		return nil, ErrWaitlistEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE waitlist_entries SET status = 'left', updated_at = NOW() WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Hold != nil {
+		_, err = tx.Exec(`
+			UPDATE holds SET released_at = NOW()
+			WHERE id = $1 AND confirmed_at IS NULL AND released_at IS NULL
+		`, entry.Hold.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry.Status = WAITLIST_LEFT
+	return entry, tx.Commit()
+}
+
+func (r *PostgresRepository) WaitingEntries(showtimeId int) ([]WaitlistEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT id, showtime_id, user_id, seats, status, created_at
+		FROM waitlist_entries
+		WHERE showtime_id = $1 AND status = 'waiting'
+		ORDER BY created_at, id
+	`, showtimeId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var entry WaitlistEntry
+		err := rows.Scan(&entry.ID, &entry.ShowtimeID, &entry.UserID, &entry.Seats, &entry.Status, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *PostgresRepository) OfferSeats(entryId int, showtime *showtimes.Showtime, seats []string, duration time.Duration) (*Hold, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	err = lockShowtime(tx, showtime.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var userId int
+	err = tx.QueryRow(`
+		SELECT user_id FROM waitlist_entries
+		WHERE id = $1 AND status = 'waiting'
+		FOR UPDATE
+	`, entryId).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return nil, ErrWaitlistEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := seatsTaken(tx, showtime.ID, seats, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if taken {
+		return nil, ErrSeatTaken
+	}
+
+	hold, err := insertHold(tx, showtime, userId, seats, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE waitlist_entries SET status = 'offered', hold_id = $2, updated_at = NOW()
+		WHERE id = $1
+	`, entryId, hold.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, tx.Commit()
+}
+
+func (r *PostgresRepository) ExpireOffers() ([]int, error) {
+	_, err := r.db.Exec(`
+		UPDATE waitlist_entries w SET status = 'expired', updated_at = NOW()
+		FROM holds h
+		WHERE w.hold_id = h.id AND w.status = 'offered'
+			AND h.confirmed_at IS NULL
+			AND (h.released_at IS NOT NULL OR h.expires_at <= NOW())
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT DISTINCT w.showtime_id
+		FROM waitlist_entries w
+		JOIN showtimes s ON w.showtime_id = s.id
+		WHERE w.status = 'waiting' AND s.starts_at > NOW()
+		ORDER BY w.showtime_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	showtimeIds := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		showtimeIds = append(showtimeIds, id)
+	}
+
+	return showtimeIds, rows.Err()
+}
+
+const paymentColumns = `
+	id, user_id, showtime_id, amount_cents, refunded_cents, currency, status, provider,
+	COALESCE(provider_payment_id, ''), created_at
+`
+
+// rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPayment(row rowScanner) (*payments.Payment, error) {
+	var payment payments.Payment
+	err := row.Scan(
+		&payment.ID,
+		&payment.UserID,
+		&payment.ShowtimeID,
+		&payment.Amount,
+		&payment.Refunded,
+		&payment.Currency,
+		&payment.Status,
+		&payment.Provider,
+		&payment.ProviderID,
+		&payment.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, payments.ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+func (r *PostgresRepository) QueueReminders(lead time.Duration) (int64, error) {
+	res, err := r.db.Exec(`
+		INSERT INTO notifications (user_id, kind, recipient, recipient_name, data, dedup_key)
+		SELECT
+			r.user_id,
+			$2,
+			u.email,
+			u.name,
+			json_build_object(
+				'booking_id', r.booking_id,
+				'title', m.title,
+				'starts_at', r.date,
+				'seats', array_agg(r.seat ORDER BY r.seat)
+			),
+			'reminder:' || r.booking_id
+		FROM Reservation r
+		JOIN users u ON r.user_id = u.id
+		JOIN Movies m ON r.movie_id = m.id
+		WHERE r.status = 'paid'
+			AND r.deleted_at IS NULL
+			AND r.date > NOW()
+			AND r.date <= NOW() + $1 * INTERVAL '1 second'
+			AND r.created_at <= r.date - $1 * INTERVAL '1 second'
+		GROUP BY r.booking_id, r.user_id, u.email, u.name, m.title, r.date
+		ON CONFLICT (dedup_key) DO NOTHING
+	`, lead.Seconds(), notifications.KIND_SHOWTIME_REMINDER)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *PostgresRepository) CreatePayment(payment *payments.Payment) error {
+	return r.db.QueryRow(`
+		INSERT INTO payments (user_id, showtime_id, amount_cents, currency, status, provider)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, payment.UserID, payment.ShowtimeID, payment.Amount, payment.Currency, payment.Status, payment.Provider).Scan(&payment.ID, &payment.CreatedAt)
+}
+
+func (r *PostgresRepository) FindPayment(id int) (*payments.Payment, error) {
+	return scanPayment(r.db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = $1", id))
+}
+
+func (r *PostgresRepository) FindPaymentByProviderId(provider string, providerId string) (*payments.Payment, error) {
+	return scanPayment(r.db.QueryRow(
+		"SELECT "+paymentColumns+" FROM payments WHERE provider = $1 AND provider_payment_id = $2",
+		provider,
+		providerId,
+	))
+}
+
+// paymentEffects are the reservation updates each payment status brings.
+var paymentEffects = map[string]string{
+	payments.PAYMENT_CAPTURED: `
+		UPDATE Reservation SET status = 'paid'
+		WHERE payment_id = $1 AND deleted_at IS NULL
+	`,
+	payments.PAYMENT_FAILED: `
+		UPDATE Reservation SET deleted_at = NOW()
+		WHERE payment_id = $1 AND deleted_at IS NULL
+	`,
+	payments.PAYMENT_REFUNDED: `
+		UPDATE Reservation SET status = 'refunded', deleted_at = COALESCE(deleted_at, NOW())
+		WHERE payment_id = $1
+	`,
+}
+
+// queuePaymentNotifications writes a notification of kind about each booking
+// of a payment to the outbox. It must run before the payment effect releases
+// the seats.
+func queuePaymentNotifications(tx *sql.Tx, paymentId int, kind string) error {
+	rows, err := tx.Query(`
+		SELECT r.user_id, COALESCE(r.booking_id, ''), r.date, m.title, array_agg(r.seat ORDER BY r.seat), SUM(r.price_cents)
+		FROM Reservation r
+		JOIN Movies m ON r.movie_id = m.id
+		WHERE r.payment_id = $1 AND r.deleted_at IS NULL
+		GROUP BY r.user_id, r.booking_id, r.date, m.title
+	`, paymentId)
+	if err != nil {
+		return err
+	}
+
+	userIds := []int{}
+	bookings := []notifications.Data{}
+	for rows.Next() {
+		var userId int
+		var data notifications.Data
+		if err := rows.Scan(&userId, &data.BookingID, &data.StartsAt, &data.Title, pq.Array(&data.Seats), &data.Total); err != nil {
+			rows.Close()
+			return err
+		}
+		userIds = append(userIds, userId)
+		bookings = append(bookings, data)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, data := range bookings {
+		if err := notifications.Queue(tx, userIds[i], kind, data, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) SetPaymentStatus(id int, status string, providerId string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow("SELECT status FROM payments WHERE id = $1 FOR UPDATE", id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return payments.ErrPaymentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if current == status {
+		return nil
+	}
+
+	if !payments.CanTransition(current, status) {
+		return payments.ErrInvalidTransition
+	}
+
+	_, err = tx.Exec(`
+		UPDATE payments
+		SET status = $2, provider_payment_id = COALESCE(NULLIF($3, ''), provider_payment_id), updated_at = NOW()
+		WHERE id = $1
+	`, id, status, providerId)
+	if err != nil {
+		return err
+	}
+
+	if status == payments.PAYMENT_REFUNDED {
+		_, err = tx.Exec("UPDATE payments SET refunded_cents = amount_cents WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if kind, ok := paymentNotifications[status]; ok {
+		if err := queuePaymentNotifications(tx, id, kind); err != nil {
+			return err
+		}
+	}
+
+	if effect, ok := paymentEffects[status]; ok {
+		if _, err := tx.Exec(effect, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) StalePayments(olderThan time.Duration) ([]payments.Payment, error) {
+	rows, err := r.db.Query(`
+		SELECT `+paymentColumns+` FROM payments
+		WHERE status IN ('pending', 'authorized')
+			AND created_at <= NOW() - make_interval(secs => $1)
+		ORDER BY id
+	`, olderThan.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	stale := []payments.Payment{}
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		stale = append(stale, *payment)
+	}
+
+	return stale, rows.Err()
+}
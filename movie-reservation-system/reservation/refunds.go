@@ -0,0 +1,133 @@
+package reservation
+
+import (
+	"fmt"
+	"log/slog"
+	"movie-reservation-system/metrics"
+	"movie-reservation-system/payments"
+	"sort"
+	"strings"
+	"time"
+)
+
+const STATUS_REFUND_PENDING = "refund_pending"
+
+const (
+	REFUND_PENDING  = "pending"
+	REFUND_REFUNDED = "refunded"
+)
+
+// REFUND_RETRY_DELAY leaves a refund to the request that created it before
+// the sweeper retries it.
+const REFUND_RETRY_DELAY = time.Minute
+
+// Cancellation is a set of seats of a booking to cancel.
+type Cancellation struct {
+	BookingID string
+	Seats     []string
+}
+
+// Refund is money owed back for canceled seats. It is recorded with the
+// cancellation and sent to the provider afterwards under IdempotencyKey, so
+// retrying it never pays twice.
+type Refund struct {
+	ID                int
+	PaymentID         int
+	ProviderPaymentID string
+	BookingID         string
+	Amount            int
+	IdempotencyKey    string
+	Status            string
+}
+
+// refundKey identifies a refund by its booking and seats. A seat can only be
+// canceled once, so the key never comes back for another refund.
+func refundKey(bookingId string, seats []string) string {
+	sorted := uniqueSeats(seats)
+	sort.Strings(sorted)
+
+	return fmt.Sprintf("refund-%s-%s", bookingId, strings.Join(sorted, "-"))
+}
+
+// uniqueSeats drops repeated seats, keeping their order.
+func uniqueSeats(seats []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, seat := range seats {
+		if !seen[seat] {
+			seen[seat] = true
+			unique = append(unique, seat)
+		}
+	}
+
+	return unique
+}
+
+// sendRefund asks the provider for the money and marks the refund sent.
+func sendRefund(reservations ReservationRepository, provider payments.Provider, refund Refund) error {
+	err := provider.Refund(refund.ProviderPaymentID, refund.Amount, refund.IdempotencyKey)
+	if err != nil {
+		return fmt.Errorf("refunding payment %d: %w", refund.PaymentID, err)
+	}
+
+	return reservations.CompleteRefund(refund.ID)
+}
+
+// cancel releases the seats of every cancellation at once and then sends
+// the refunds they are owed. It returns the amounts refunded and still
+// pending. A refund the provider fails stays pending for the sweeper: the
+// seats are canceled either way.
+func (h *Handler) cancel(cancellations []Cancellation) (int, int, error) {
+	refunds, err := h.reservations.CancelSeats(cancellations)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, cancellation := range cancellations {
+		metrics.CanceledSeats.Add(float64(len(cancellation.Seats)))
+	}
+
+	refunded, pending := 0, 0
+	for _, refund := range refunds {
+		if err := sendRefund(h.reservations, h.payments, refund); err != nil {
+			slog.Error("sending refund", "refund_id", refund.ID, "error", err)
+			pending += refund.Amount
+			continue
+		}
+		refunded += refund.Amount
+	}
+
+	return refunded, pending, nil
+}
+
+// RetryRefunds sends the refunds that are still pending olderThan after
+// they were recorded.
+func RetryRefunds(reservations ReservationRepository, provider payments.Provider, olderThan time.Duration) {
+	refunds, err := reservations.PendingRefunds(olderThan)
+	if err != nil {
+		slog.Error("listing pending refunds", "error", err)
+		return
+	}
+
+	for _, refund := range refunds {
+		if err := sendRefund(reservations, provider, refund); err != nil {
+			slog.Error("retrying refund", "refund_id", refund.ID, "error", err)
+			continue
+		}
+
+		slog.Info("sent pending refund", "refund_id", refund.ID, "amount", refund.Amount)
+	}
+}
+
+// StartRefundSweeper retries pending refunds every interval until the
+// process exits.
+func StartRefundSweeper(reservations ReservationRepository, provider payments.Provider, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			RetryRefunds(reservations, provider, REFUND_RETRY_DELAY)
+		}
+	}()
+}
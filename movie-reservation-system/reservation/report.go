@@ -0,0 +1,51 @@
+package reservation
+
+import "time"
+
+// Report groupings. Reservation dates are screening days, booking days are
+// the days the seats were reserved on.
+const (
+	REPORT_BY_MOVIE       = "movie"
+	REPORT_BY_DATE        = "date"
+	REPORT_BY_BOOKING_DAY = "booking_day"
+	REPORT_DAY_LAYOUT     = "2006-01-02"
+)
+
+var REPORT_GROUPS = map[string]bool{
+	REPORT_BY_MOVIE:       true,
+	REPORT_BY_DATE:        true,
+	REPORT_BY_BOOKING_DAY: true,
+}
+
+// ReportQuery selects the reservations whose grouping date falls in
+// [From, To). Booking day reports filter on the booking time, the others on
+// the screening date. MovieID, when set, restricts the report to one movie.
+type ReportQuery struct {
+	GroupBy string
+	From    time.Time
+	To      time.Time
+	MovieID int
+	// Location is the zone the rows of day reports are bucketed in.
+	Location *time.Location
+}
+
+// ReportRow aggregates the seats of one movie or day. Seats are the seats
+// still reserved, canceled ones were given up by their customer. Seats whose
+// payment failed are not counted at all. Amounts are in cents.
+type ReportRow struct {
+	MovieID          int     `json:"movie_id,omitempty"`
+	Title            string  `json:"title,omitempty"`
+	Day              string  `json:"day,omitempty"`
+	Seats            int     `json:"seats"`
+	Canceled         int     `json:"canceled"`
+	CancellationRate float64 `json:"cancellation_rate"`
+	Customers        int     `json:"customers"`
+	Revenue          int     `json:"revenue"`
+	Refunded         int     `json:"refunded"`
+}
+
+func (r *ReportRow) computeRate() {
+	if total := r.Seats + r.Canceled; total > 0 {
+		r.CancellationRate = float64(r.Canceled) / float64(total)
+	}
+}
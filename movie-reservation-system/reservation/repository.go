@@ -0,0 +1,136 @@
+package reservation
+
+import (
+	"errors"
+	"movie-reservation-system/halls"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/showtimes"
+	"time"
+)
+
+var (
+	ErrSeatTaken             = errors.New("seat already reserved")
+	ErrShowtimeNotFound      = errors.New("showtime not found")
+	ErrHallNotFound          = errors.New("hall not found")
+	ErrHoldNotFound          = errors.New("hold not found")
+	ErrHoldInactive          = errors.New("hold is no longer active")
+	ErrBookingNotFound       = errors.New("booking not found")
+	ErrAlreadyWaitlisted     = errors.New("already on the waitlist")
+	ErrWaitlistEntryNotFound = errors.New("waitlist entry not found")
+)
+
+// MovieReservation is a reservation as listed to admins, with the customer
+// and movie details joined in.
+type MovieReservation struct {
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageUrl    string    `json:"image_url"`
+	Date        time.Time `json:"date"`
+	Seat        string    `json:"seat"`
+	Price       int       `json:"price"`
+	Status      string    `json:"status"`
+}
+
+// Checkout is what a reservation is made under: the booking grouping its
+// seats, the payment covering them and the price of each seat in cents.
+type Checkout struct {
+	BookingID string
+	PaymentID int
+	Prices    map[string]int
+}
+
+// ReservationRepository is the storage behind the reservation, hold, seat
+// availability and admin reservation handlers. Every method that takes seats
+// must check and take them atomically.
+type ReservationRepository interface {
+	FindShowtime(id int) (*showtimes.Showtime, error)
+	FindHall(id int) (*halls.Hall, error)
+	// ListShowtimes returns the showtimes of a movie starting in [from, to).
+	ListShowtimes(movieId int, from time.Time, to time.Time) ([]showtimes.Showtime, error)
+	// TakenSeats returns the reserved seats of a showtime and the seats
+	// under an active hold.
+	TakenSeats(showtimeId int) (map[string]bool, map[string]bool, error)
+
+	// Reserve takes the seats for userId under checkout or returns
+	// ErrSeatTaken when any of them is reserved or held by someone else. The
+	// reservations wait for the checkout payment to be captured.
+	Reserve(showtime *showtimes.Showtime, userId int, seats []string, checkout Checkout) error
+	ListByUser(userId int) ([]Reservation, error)
+	ListForMovie(movieId int) ([]MovieReservation, error)
+	// Report aggregates reservations for the admin reports, ordered by
+	// title or day.
+	Report(query ReportQuery) ([]ReportRow, error)
+
+	// FindBooking returns the seats of a booking that are not canceled, or
+	// ErrBookingNotFound when there are none left.
+	FindBooking(id string) (*Booking, error)
+	// CancelSeats releases the seats of every cancellation in one
+	// transaction, holding them locked while it checks them. It returns
+	// ErrBookingNotFound when a seat is already canceled. Paid seats become
+	// refund_pending under a recorded refund, which is returned to be sent to
+	// the provider. The cancellation notifications are queued with the
+	// change.
+	CancelSeats(cancellations []Cancellation) ([]Refund, error)
+	// CompleteRefund marks a refund sent: its seats become refunded and its
+	// amount is added to the refunded amount of the payment, which is
+	// refunded once it is refunded in full. Completing it again is a no-op.
+	CompleteRefund(id int) error
+	// PendingRefunds returns the refunds recorded more than olderThan ago
+	// that were not sent yet.
+	PendingRefunds(olderThan time.Duration) ([]Refund, error)
+
+	// CreateHold releases the previous holds of userId for the showtime and
+	// holds the seats for duration, or returns ErrSeatTaken.
+	CreateHold(showtime *showtimes.Showtime, userId int, seats []string, duration time.Duration) (*Hold, error)
+	FindHold(id int) (*Hold, error)
+	// ConfirmHold converts an active hold of userId into reservations under
+	// checkout, waiting for its payment to be captured. A waitlist offer made
+	// through the hold is claimed.
+	ConfirmHold(id int, userId int, checkout Checkout) (*Hold, error)
+	ReleaseHold(id int, userId int) error
+	ReleaseExpiredHolds() (int64, error)
+
+	// JoinWaitlist stores a waiting entry and sets its ID and creation time,
+	// or returns ErrAlreadyWaitlisted when the user is already waiting or
+	// holding an offer for the showtime.
+	JoinWaitlist(entry *WaitlistEntry) error
+	// ListWaitlist returns the entries of userId, newest first, with their
+	// offers.
+	ListWaitlist(userId int) ([]WaitlistEntry, error)
+	// LeaveWaitlist marks a waiting or offered entry of userId as left and
+	// releases its offer, or returns ErrWaitlistEntryNotFound.
+	LeaveWaitlist(id int, userId int) (*WaitlistEntry, error)
+	// WaitingEntries returns the waiting entries of a showtime in the order
+	// they joined.
+	WaitingEntries(showtimeId int) ([]WaitlistEntry, error)
+	// OfferSeats holds the seats for the user of a waiting entry for
+	// duration and marks the entry offered. It returns ErrSeatTaken, or
+	// ErrWaitlistEntryNotFound once the entry is no longer waiting.
+	OfferSeats(entryId int, showtime *showtimes.Showtime, seats []string, duration time.Duration) (*Hold, error)
+	// ExpireOffers marks offered entries whose hold ended unconfirmed as
+	// expired and returns the upcoming showtimes that have waiting entries.
+	ExpireOffers() ([]int, error)
+
+	// QueueReminders queues a reminder for each paid booking of a showtime
+	// starting within lead, once per booking. Bookings made after the
+	// reminder would have been due are left out. It returns how many were
+	// queued.
+	QueueReminders(lead time.Duration) (int64, error)
+
+	// CreatePayment stores a pending payment and sets its ID.
+	CreatePayment(payment *payments.Payment) error
+	FindPayment(id int) (*payments.Payment, error)
+	FindPaymentByProviderId(provider string, providerId string) (*payments.Payment, error)
+	// SetPaymentStatus moves a payment to status and its reservations along:
+	// captured marks them paid, failed releases their seats and refunded
+	// marks them refunded and releases their seats. Setting the current
+	// status again is a no-op and a providerId, when given, is recorded.
+	// Capturing queues the confirmation of the bookings of the payment and
+	// failing queues a notice that their seats were released.
+	SetPaymentStatus(id int, status string, providerId string) error
+	// StalePayments returns the pending and authorized payments older than
+	// olderThan.
+	StalePayments(olderThan time.Duration) ([]payments.Payment, error)
+}
@@ -1,35 +1,44 @@
 package reservation
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"movie-reservation-system/database"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/halls"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/pricing"
+	"movie-reservation-system/showtimes"
 	"movie-reservation-system/users"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"github.com/lib/pq"
 )
 
-func generalError(c *gin.Context, err error) {
-	fmt.Println(err)
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "an error ocurred"})
-}
+// MAX_SEATS is how many seats one reservation or hold may take.
+const MAX_SEATS = 5
 
 type Reservation struct {
-	Date     string `json:"date"`
-	Seat     string `json:"seat"`
-	Title    string `json:"title"`
-	ImageUrl string `json:"image_url"`
+	BookingID  string `json:"booking_id"`
+	ShowtimeID int    `json:"showtime_id"`
+	Date       string `json:"date"`
+	Seat       string `json:"seat"`
+	Price      int    `json:"price"`
+	Status     string `json:"status"`
+	Title      string `json:"title"`
+	ImageUrl   string `json:"image_url"`
 }
 
 type ReservationMap struct {
-	ImageUrl string   `json:"image_url"`
-	Title    string   `json:"title"`
-	Date     string   `json:"date"`
-	Seats    []string `json:"seats"`
+	BookingID  string   `json:"booking_id"`
+	ShowtimeID int      `json:"showtime_id"`
+	ImageUrl   string   `json:"image_url"`
+	Title      string   `json:"title"`
+	Date       string   `json:"date"`
+	Seats      []string `json:"seats"`
+	Total      int      `json:"total"`
+	// Status is pending_payment while any seat waits for its payment.
+	Status string `json:"status"`
 }
 
 type UserClaims struct {
@@ -38,163 +47,169 @@ type UserClaims struct {
 }
 
 type ReserveBody struct {
-	Seats []string `json:"seats"`
-	Date  string   `json:"date"`
+	Seats        []string `json:"seats"`
+	ShowtimeID   int      `json:"showtime_id"`
+	PaymentToken string   `json:"payment_token"`
 }
 
-func ReserveMovie(c *gin.Context) {
-	var reserveBody ReserveBody
-	jsonData, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-		return
-	}
+// Ticket is a reserved seat with its price breakdown.
+type Ticket struct {
+	Seat string `json:"seat"`
+	pricing.Price
+}
 
-	json.Unmarshal(jsonData, &reserveBody)
+type Handler struct {
+	reservations ReservationRepository
+	users        users.UserRepository
+	payments     payments.Provider
+	pricing      pricing.Rules
+	cutoff       time.Duration
+	location     *time.Location
+}
 
-	if len(reserveBody.Seats) == 0 || reserveBody.Date == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "date and seat are required"})
-		return
+// NewHandler prices seats with rules. Users can cancel their bookings until
+// cutoff before the screening. Days in requests are days in location.
+func NewHandler(reservations ReservationRepository, users users.UserRepository, provider payments.Provider, rules pricing.Rules, cutoff time.Duration, location *time.Location) *Handler {
+	return &Handler{reservations: reservations, users: users, payments: provider, pricing: rules, cutoff: cutoff, location: location}
+}
+
+// priceSeats quotes every seat for userId. The returned prices, by seat, are
+// what gets stored on the reservations.
+func (h *Handler) priceSeats(showtime *showtimes.Showtime, userId int, seats []string) ([]Ticket, map[string]int, int, error) {
+	hall, err := h.reservations.FindHall(showtime.HallID)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("hall %d of showtime %d: %w", showtime.HallID, showtime.ID, err)
 	}
 
-	if len(reserveBody.Seats) > 5 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "max 5 seats per reservation"})
-		return
+	user, err := h.users.FindById(userId)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	age := user.Age(showtime.StartsAt)
+
+	tickets := []Ticket{}
+	prices := make(map[string]int)
+	total := 0
+	for _, seat := range seats {
+		price := h.pricing.Quote(hall.CategoryOf(seat), showtime.StartsAt, age)
+		tickets = append(tickets, Ticket{Seat: seat, Price: price})
+		prices[seat] = price.Amount
+		total += price.Amount
 	}
 
-	date := reserveBody.Date
+	return tickets, prices, total, nil
+}
 
-	userId := users.ExtractUserIdFromClaims(c)
-	movieId := c.Param("id")
+// validateSeatRequest checks that the showtime belongs to the movie in the
+// URL, has not started yet and that every seat exists in its hall. Seats are
+// normalized in place. On failure the response has already been written.
+func (h *Handler) validateSeatRequest(c *gin.Context, showtimeId int, seats []string) (*showtimes.Showtime, bool) {
+	fields := make(map[string]string)
+	if showtimeId < 1 {
+		fields["showtime_id"] = "is required"
+	}
+	if len(seats) == 0 {
+		fields["seats"] = "is required"
+	} else if len(seats) > MAX_SEATS {
+		fields["seats"] = fmt.Sprintf("must have at most %d items", MAX_SEATS)
+	}
+	if len(fields) > 0 {
+		apierror.Abort(c, apierror.Validation(fields))
+		return nil, false
+	}
 
-	tx, err := database.Db.Begin()
+	movieId, err := apierror.IDParam(c, "id", "movie")
 	if err != nil {
-		generalError(c, err)
-		return
+		apierror.Abort(c, err)
+		return nil, false
 	}
 
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	exists := false
-	err = tx.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM Reservation
-			WHERE movie_id = $1
-				AND seat = ANY($2)
-			FOR UPDATE
-		)
-	`, movieId, pq.Array(reserveBody.Seats)).Scan(&exists)
+	showtime, err := h.reservations.FindShowtime(showtimeId)
+	if err == ErrShowtimeNotFound || (err == nil && showtime.MovieID != movieId) {
+		apierror.Abort(c, apierror.NotFound("showtime not found"))
+		return nil, false
+	}
 	if err != nil {
-		generalError(c, err)
-		return
+		abortUncommitted(c, err)
+		return nil, false
 	}
 
-	if exists {
-		c.JSON(http.StatusConflict, gin.H{"error": "seat already reserved"})
-		return
+	if showtime.StartsAt.Before(time.Now()) {
+		apierror.Abort(c, apierror.Invalid("showtime already started"))
+		return nil, false
 	}
 
-	for _, seat := range reserveBody.Seats {
-		_, err = tx.Exec(`
-			INSERT INTO Reservation (movie_id, user_id, date, seat)
-			VALUES ($1, $2, $3, $4)
-		`, movieId, userId, date, seat)
-		if err != nil {
-			generalError(c, err)
-			return
-		}
+	hall, err := h.reservations.FindHall(showtime.HallID)
+	if err != nil {
+		abortUncommitted(c, fmt.Errorf("hall %d of showtime %d: %w", showtime.HallID, showtime.ID, err))
+		return nil, false
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "an error ocurred"})
-		return
+	if err := hall.ValidateSeats(seats); err != nil {
+		apierror.Abort(c, apierror.InvalidField("seats", err.Error()))
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{"date": date, "seats": reserveBody.Seats})
-}
+	for i, seat := range seats {
+		seats[i] = halls.NormalizeSeat(seat)
+	}
 
-func GetReservations(c *gin.Context) {
-	userId := users.ExtractUserIdFromClaims(c)
+	return showtime, true
+}
 
-	query := `
-		SELECT
-			r.date,
-			r.seat,
-			m.title,
-			m.image_url
-		FROM
-			Reservation r
-		JOIN
-			Movies m ON r.movie_id = m.id
-		WHERE
-			r.user_id = $1 AND r.deleted_at IS NULL
-		`
-
-	rows, err := database.Db.Query(query, userId)
-	if err != nil {
-		generalError(c, err)
+func (h *Handler) ReserveMovie(c *gin.Context) {
+	var reserveBody ReserveBody
+	if err := apierror.BindJSON(c, &reserveBody); err != nil {
+		apierror.Abort(c, err)
 		return
 	}
 
-	defer rows.Close()
-
-	var reservations []Reservation
-	var reservation Reservation
-
-	for rows.Next() {
-		rows.Scan(&reservation.Date, &reservation.Seat, &reservation.Title, &reservation.ImageUrl)
-		reservations = append(reservations, reservation)
+	showtime, ok := h.validateSeatRequest(c, reserveBody.ShowtimeID, reserveBody.Seats)
+	if !ok {
+		return
 	}
 
-	reservationsMap := make(map[string]ReservationMap)
-	for _, r := range reservations {
-		if entry, ok := reservationsMap[r.Title]; ok {
-			entry.Seats = append(entry.Seats, r.Seat)
-			reservationsMap[r.Title] = entry
-		} else {
-			reservationsMap[r.Title] = ReservationMap{
-				Title:    r.Title,
-				ImageUrl: r.ImageUrl,
-				Date:     r.Date,
-				Seats:    []string{r.Seat},
-			}
-		}
-	}
+	userId := users.ExtractUserIdFromClaims(c)
 
-	c.JSON(http.StatusOK, gin.H{"reservations": reservationsMap})
+	h.checkout(c, showtime, userId, reserveBody.Seats, reserveBody.PaymentToken, func(checkout Checkout) error {
+		return h.reservations.Reserve(showtime, userId, reserveBody.Seats, checkout)
+	})
 }
 
-func CancelReservation(c *gin.Context) {
+func (h *Handler) GetReservations(c *gin.Context) {
 	userId := users.ExtractUserIdFromClaims(c)
-	movieId := c.Param("id")
-
-	query := `
-		UPDATE Reservation
-		SET deleted_at = NOW()
-		WHERE movie_id = $1 AND user_id = $2 AND deleted_at IS NULL
-	`
 
-	res, err := database.Db.Exec(query, movieId, userId)
+	reservations, err := h.reservations.ListByUser(userId)
 	if err != nil {
-		generalError(c, err)
+		apierror.Abort(c, err)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		generalError(c, err)
-		return
-	}
+	// Group by booking so two checkouts for the same screening stay apart.
+	reservationsMap := make(map[string]ReservationMap)
+	for _, r := range reservations {
+		key := r.BookingID
 
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "reservation not found"})
-		return
+		if entry, ok := reservationsMap[key]; ok {
+			entry.Seats = append(entry.Seats, r.Seat)
+			entry.Total += r.Price
+			if r.Status == STATUS_PENDING_PAYMENT {
+				entry.Status = r.Status
+			}
+			reservationsMap[key] = entry
+		} else {
+			reservationsMap[key] = ReservationMap{
+				BookingID:  r.BookingID,
+				ShowtimeID: r.ShowtimeID,
+				Title:      r.Title,
+				ImageUrl:   r.ImageUrl,
+				Date:       r.Date,
+				Seats:      []string{r.Seat},
+				Total:      r.Price,
+				Status:     r.Status,
+			}
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "reservation canceled"})
+	c.JSON(http.StatusOK, gin.H{"reservations": reservationsMap})
 }
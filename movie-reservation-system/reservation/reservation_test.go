@@ -0,0 +1,951 @@
+package reservation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/halls"
+	"movie-reservation-system/movies"
+	"movie-reservation-system/notifications"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/pricing"
+	"movie-reservation-system/showtimes"
+	"movie-reservation-system/users"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// asUser stands in for JwtAuth so handlers see the claims of userId.
+func asUser(userId int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user", jwt.MapClaims{"_id": fmt.Sprint(userId), "role": "user"})
+		c.Next()
+	}
+}
+
+var testProvider = payments.NewFakeProvider("secret")
+
+const TEST_TOKEN = "tok_visa"
+
+// newTestUsers holds an adult (1), a child (2) and a senior (3).
+func newTestUsers() *users.MemoryRepository {
+	repo := users.NewMemoryRepository()
+	repo.Create(&users.User{Name: "Ripley", Birthdate: "1990-01-01", Email: "ripley@example.com"})
+	repo.Create(&users.User{Name: "Newt", Birthdate: time.Now().AddDate(-8, 0, 0).Format(users.BIRTHDATE_LAYOUT), Email: "newt@example.com"})
+	repo.Create(&users.User{Name: "Burke", Birthdate: "1940-01-01", Email: "burke@example.com"})
+	return repo
+}
+
+func newTestRouter(repo ReservationRepository, userId int) *gin.Engine {
+	handler := NewHandler(repo, newTestUsers(), testProvider, pricing.DefaultRules(), DEFAULT_CANCELLATION_CUTOFF, time.UTC)
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/movie/:id/seats", handler.GetSeatAvailability)
+	router.POST("/movie/:id/reserve", asUser(userId), handler.ReserveMovie)
+	router.POST("/movie/:id/hold", asUser(userId), handler.HoldSeats)
+	router.POST("/holds/:id/confirm", asUser(userId), handler.ConfirmHold)
+	router.DELETE("/holds/:id", asUser(userId), handler.ReleaseHold)
+	router.GET("/user/reservations", asUser(userId), handler.GetReservations)
+	router.DELETE("/user/reservations/:id", asUser(userId), handler.CancelBooking)
+	router.GET("/user/bookings/:id", asUser(userId), handler.GetBooking)
+	router.DELETE("/user/bookings/:id", asUser(userId), handler.CancelBooking)
+	router.POST("/user/bookings/:id/cancel", asUser(userId), handler.CancelBookingSeats)
+	router.DELETE("/bookings/:id", asUser(userId), handler.RefundBooking)
+	router.POST("/movie/:id/waitlist", asUser(userId), handler.JoinWaitlist)
+	router.GET("/user/waitlist", asUser(userId), handler.GetWaitlist)
+	router.DELETE("/user/waitlist/:id", asUser(userId), handler.LeaveWaitlist)
+	router.POST("/payments/webhook", handler.HandlePaymentWebhook)
+	return router
+}
+
+func newTestRepository(startsAt time.Time) *MemoryRepository {
+	repo := NewMemoryRepository()
+	repo.AddMovie(movies.Movie{ID: 1, Title: "Alien"})
+	repo.AddHall(halls.Hall{ID: 1, Name: "Main", Layout: halls.Layout{
+		Rows:          2,
+		Columns:       3,
+		DisabledSeats: []string{"B3"},
+		Categories:    map[string][]string{"premium": {"B"}},
+	}})
+	repo.AddShowtime(showtimes.Showtime{ID: 1, MovieID: 1, HallID: 1, HallName: "Main", StartsAt: startsAt})
+	return repo
+}
+
+func request(router *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestReserveMovie(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"a1", "A2"}})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	reserved, _, _ := repo.TakenSeats(1)
+	if !reserved["A1"] || !reserved["A2"] {
+		t.Fatalf("expected A1 and A2 to be reserved, got %v", reserved)
+	}
+
+	res = request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A2"}})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken seat, got %d", res.Code)
+	}
+}
+
+func TestReserveMovieRejectsInvalidRequests(t *testing.T) {
+	router := newTestRouter(newTestRepository(time.Now().Add(24*time.Hour)), 1)
+
+	cases := []struct {
+		name string
+		path string
+		body interface{}
+		code int
+	}{
+		{"missing seats", "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1}, http.StatusBadRequest},
+		{"missing payment token", "/movie/1/reserve", ReserveBody{ShowtimeID: 1, Seats: []string{"A1"}}, http.StatusBadRequest},
+		{"too many seats", "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A1", "A2", "A3", "B1", "B2", "C1"}}, http.StatusBadRequest},
+		{"out of bounds seat", "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"C1"}}, http.StatusBadRequest},
+		{"disabled seat", "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"B3"}}, http.StatusBadRequest},
+		{"unknown showtime", "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 2, Seats: []string{"A1"}}, http.StatusNotFound},
+		{"showtime of another movie", "/movie/2/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A1"}}, http.StatusNotFound},
+		{"showtime as text", "/movie/1/reserve", map[string]interface{}{"payment_token": TEST_TOKEN, "showtime_id": "1", "seats": []string{"A1"}}, http.StatusBadRequest},
+		{"invalid movie id", "/movie/abc/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A1"}}, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		res := request(router, http.MethodPost, tc.path, tc.body)
+		if res.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.code, res.Code, res.Body)
+		}
+	}
+}
+
+func TestReserveMovieRejectsStartedShowtime(t *testing.T) {
+	router := newTestRouter(newTestRepository(time.Now().Add(-time.Minute)), 1)
+
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A1"}})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", res.Code)
+	}
+}
+
+func TestHoldBlocksOtherUsers(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	holder := newTestRouter(repo, 1)
+	other := newTestRouter(repo, 2)
+
+	res := request(holder, http.MethodPost, "/movie/1/hold", HoldBody{ShowtimeID: 1, Seats: []string{"A1"}})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(other, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A1"}})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a held seat, got %d", res.Code)
+	}
+
+	res = request(other, http.MethodPost, "/movie/1/hold", HoldBody{ShowtimeID: 1, Seats: []string{"A1"}})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 when holding a held seat, got %d", res.Code)
+	}
+}
+
+func TestConfirmHold(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+
+	res := request(router, http.MethodPost, "/movie/1/hold", HoldBody{ShowtimeID: 1, Seats: []string{"A1", "A2"}})
+	var hold Hold
+	json.Unmarshal(res.Body.Bytes(), &hold)
+
+	res = request(newTestRouter(repo, 2), http.MethodPost, fmt.Sprintf("/holds/%d/confirm", hold.ID), ConfirmHoldBody{PaymentToken: TEST_TOKEN})
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 confirming someone else's hold, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPost, fmt.Sprintf("/holds/%d/confirm", hold.ID), ConfirmHoldBody{PaymentToken: TEST_TOKEN})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	reserved, held, _ := repo.TakenSeats(1)
+	if !reserved["A1"] || !reserved["A2"] || len(held) != 0 {
+		t.Fatalf("expected the hold to become reservations, got reserved %v held %v", reserved, held)
+	}
+
+	res = request(router, http.MethodPost, fmt.Sprintf("/holds/%d/confirm", hold.ID), ConfirmHoldBody{PaymentToken: TEST_TOKEN})
+	if res.Code != http.StatusGone {
+		t.Fatalf("expected 410 confirming twice, got %d", res.Code)
+	}
+}
+
+func TestExpiredHoldsAreReleased(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	showtime, _ := repo.FindShowtime(1)
+
+	hold, err := repo.CreateHold(showtime, 1, []string{"A1"}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released, _ := repo.ReleaseExpiredHolds()
+	if released != 1 {
+		t.Fatalf("expected 1 released hold, got %d", released)
+	}
+
+	res := request(newTestRouter(repo, 1), http.MethodPost, fmt.Sprintf("/holds/%d/confirm", hold.ID), ConfirmHoldBody{PaymentToken: TEST_TOKEN})
+	if res.Code != http.StatusGone {
+		t.Fatalf("expected 410 for an expired hold, got %d", res.Code)
+	}
+}
+
+func TestGetSeatAvailability(t *testing.T) {
+	startsAt := time.Now().Add(24 * time.Hour)
+	repo := newTestRepository(startsAt)
+	showtime, _ := repo.FindShowtime(1)
+	repo.Reserve(showtime, 1, []string{"A1"}, Checkout{BookingID: "b1"})
+	repo.CreateHold(showtime, 2, []string{"A2"}, time.Minute)
+
+	res := request(newTestRouter(repo, 1), http.MethodGet, "/movie/1/seats?date="+startsAt.UTC().Format("2006-01-02"), nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var body struct {
+		Showtimes []ShowtimeSeats `json:"showtimes"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if len(body.Showtimes) != 1 {
+		t.Fatalf("expected 1 showtime, got %d", len(body.Showtimes))
+	}
+
+	expected := SeatCounts{Total: 6, Free: 3, Reserved: 1, Held: 1, Disabled: 1}
+	if body.Showtimes[0].Counts != expected {
+		t.Fatalf("expected counts %+v, got %+v", expected, body.Showtimes[0].Counts)
+	}
+
+	res = request(newTestRouter(repo, 1), http.MethodGet, "/movie/1/seats", nil)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a date, got %d", res.Code)
+	}
+}
+
+func TestSeatAvailabilityUsesLocation(t *testing.T) {
+	// 20:00 UTC on June 1st is already June 2nd ten hours east.
+	repo := newTestRepository(time.Date(2030, 6, 1, 20, 0, 0, 0, time.UTC))
+	handler := NewHandler(repo, newTestUsers(), testProvider, pricing.DefaultRules(), DEFAULT_CANCELLATION_CUTOFF, time.FixedZone("UTC+10", 10*60*60))
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/movie/:id/seats", handler.GetSeatAvailability)
+
+	cases := map[string]int{"2030-06-01": 0, "2030-06-02": 1}
+	for date, expected := range cases {
+		res := request(router, http.MethodGet, "/movie/1/seats?date="+date, nil)
+		var body struct {
+			Showtimes []ShowtimeSeats `json:"showtimes"`
+		}
+		json.Unmarshal(res.Body.Bytes(), &body)
+		if res.Code != http.StatusOK || len(body.Showtimes) != expected {
+			t.Errorf("%s: expected %d showtimes, got %d: %s", date, expected, res.Code, res.Body)
+		}
+	}
+}
+
+func TestCancelReservation(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+	bookingId := reserveBooking(t, router, 1, TEST_TOKEN, "A1")
+	other := reserveBooking(t, router, 1, TEST_TOKEN, "A2")
+
+	res := request(router, http.MethodGet, "/user/reservations", nil)
+	var body struct {
+		Reservations map[string]ReservationMap `json:"reservations"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	for _, entry := range body.Reservations {
+		if entry.BookingID == "" || len(entry.Seats) != 1 || entry.Title != "Alien" {
+			t.Fatalf("unexpected reservation: %+v", entry)
+		}
+	}
+	if len(body.Reservations) != 2 {
+		t.Fatalf("unexpected reservations: %s", res.Body)
+	}
+
+	res = request(router, http.MethodDelete, "/user/reservations/"+bookingId, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(router, http.MethodDelete, "/user/reservations/"+bookingId, nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 canceling twice, got %d", res.Code)
+	}
+
+	if res := request(router, http.MethodGet, "/user/bookings/"+other, nil); res.Code != http.StatusOK {
+		t.Fatalf("expected the other booking of the movie to be kept, got %d", res.Code)
+	}
+}
+
+// nextWeekday returns the next given weekday at hour, at least a day ahead.
+func nextWeekday(weekday time.Weekday, hour int) time.Time {
+	date := time.Now().AddDate(0, 0, 1)
+	for date.Weekday() != weekday {
+		date = date.AddDate(0, 0, 1)
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, time.Local)
+}
+
+func TestReservationPrices(t *testing.T) {
+	cases := []struct {
+		name     string
+		startsAt time.Time
+		userId   int
+		seats    []string
+		total    int
+	}{
+		{"adult evening", nextWeekday(time.Wednesday, 20), 1, []string{"A1", "B1"}, 1000 + 1500},
+		{"adult weekend matinee", nextWeekday(time.Saturday, 14), 1, []string{"A1"}, 920},
+		{"child", nextWeekday(time.Wednesday, 20), 2, []string{"A1"}, 600},
+		{"senior premium", nextWeekday(time.Wednesday, 20), 3, []string{"B1"}, 1050},
+	}
+
+	for _, tc := range cases {
+		repo := newTestRepository(tc.startsAt)
+		router := newTestRouter(repo, tc.userId)
+
+		res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: tc.seats})
+		var body struct {
+			Tickets []Ticket `json:"tickets"`
+			Total   int      `json:"total"`
+		}
+		json.Unmarshal(res.Body.Bytes(), &body)
+		if res.Code != http.StatusOK || body.Total != tc.total || len(body.Tickets) != len(tc.seats) {
+			t.Errorf("%s: expected total %d, got %d: %s", tc.name, tc.total, res.Code, res.Body)
+			continue
+		}
+
+		reservations, _ := repo.ListByUser(tc.userId)
+		stored := 0
+		for _, reservation := range reservations {
+			stored += reservation.Price
+		}
+		if stored != tc.total {
+			t.Errorf("%s: expected %d to be stored, got %d", tc.name, tc.total, stored)
+		}
+	}
+}
+
+func TestDeclinedPaymentReleasesSeats(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: payments.FAKE_TOKEN_DECLINE, ShowtimeID: 1, Seats: []string{"A1"}})
+	if res.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected 402, got %d: %s", res.Code, res.Body)
+	}
+
+	reserved, _, _ := repo.TakenSeats(1)
+	if len(reserved) != 0 {
+		t.Fatalf("expected the seat to be released, got %v", reserved)
+	}
+
+	payment, _ := repo.FindPayment(1)
+	if payment.Status != payments.PAYMENT_FAILED {
+		t.Fatalf("expected a failed payment, got %s", payment.Status)
+	}
+}
+
+func TestCaptureErrorVoidsAuthorization(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: payments.FAKE_TOKEN_CAPTURE_ERROR, ShowtimeID: 1, Seats: []string{"A1"}})
+	if res.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d: %s", res.Code, res.Body)
+	}
+
+	reserved, _, _ := repo.TakenSeats(1)
+	if len(reserved) != 0 {
+		t.Fatalf("expected the seat to be released, got %v", reserved)
+	}
+
+	payment, _ := repo.FindPayment(1)
+	if payment.Status != payments.PAYMENT_FAILED {
+		t.Fatalf("expected a failed payment, got %s", payment.Status)
+	}
+	if _, _, err := testProvider.Complete(payment.ProviderID, true); err != payments.ErrInvalidTransition {
+		t.Fatalf("expected the authorization to be voided, got %v", err)
+	}
+}
+
+func sendWebhook(router *gin.Engine, body []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewReader(body))
+	req.Header.Set(SIGNATURE_HEADER, signature)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestAsyncPaymentWebhook(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: payments.FAKE_TOKEN_ASYNC, ShowtimeID: 1, Seats: []string{"A1"}})
+	var body struct {
+		Status  string           `json:"status"`
+		Payment payments.Payment `json:"payment"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code != http.StatusAccepted || body.Status != STATUS_PENDING_PAYMENT {
+		t.Fatalf("expected a pending reservation, got %d: %s", res.Code, res.Body)
+	}
+
+	payment, _ := repo.FindPayment(body.Payment.ID)
+	event, signature, err := testProvider.Complete(payment.ProviderID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := sendWebhook(router, event, "deadbeef"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bad signature, got %d", res.Code)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := sendWebhook(router, event, signature); res.Code != http.StatusOK {
+			t.Fatalf("expected 200 for delivery %d, got %d: %s", i+1, res.Code, res.Body)
+		}
+	}
+
+	reservations, _ := repo.ListByUser(1)
+	if len(reservations) != 1 || reservations[0].Status != STATUS_PAID {
+		t.Fatalf("expected a paid reservation, got %+v", reservations)
+	}
+}
+
+func TestCancelRefundsPaidReservations(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A1"}})
+	var body struct {
+		BookingID string           `json:"booking_id"`
+		Status    string           `json:"status"`
+		Payment   payments.Payment `json:"payment"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code != http.StatusOK || body.Status != STATUS_PAID {
+		t.Fatalf("expected a paid reservation, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(router, http.MethodDelete, "/user/reservations/"+body.BookingID, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	payment, _ := repo.FindPayment(body.Payment.ID)
+	if payment.Status != payments.PAYMENT_REFUNDED {
+		t.Fatalf("expected a refunded payment, got %s", payment.Status)
+	}
+
+	reserved, _, _ := repo.TakenSeats(1)
+	if len(reserved) != 0 {
+		t.Fatalf("expected the seat to be released, got %v", reserved)
+	}
+}
+
+func TestStalePaymentsAreFailed(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+	request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: payments.FAKE_TOKEN_ASYNC, ShowtimeID: 1, Seats: []string{"A1"}})
+
+	failed, _ := FailStalePayments(repo, testProvider, 0)
+	if failed != 1 {
+		t.Fatalf("expected 1 failed payment, got %d", failed)
+	}
+
+	reserved, _, _ := repo.TakenSeats(1)
+	if len(reserved) != 0 {
+		t.Fatalf("expected the seat to be released, got %v", reserved)
+	}
+
+	payment, _ := repo.FindPayment(1)
+	if _, _, err := testProvider.Complete(payment.ProviderID, true); err != payments.ErrInvalidTransition {
+		t.Fatalf("expected the authorization to be voided, got %v", err)
+	}
+}
+
+func TestStaleCapturedPaymentsAreKept(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+	request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: payments.FAKE_TOKEN_ASYNC, ShowtimeID: 1, Seats: []string{"A1"}})
+
+	// The provider captured the payment but its webhook has not arrived yet.
+	payment, _ := repo.FindPayment(1)
+	testProvider.Complete(payment.ProviderID, true)
+
+	if failed, _ := FailStalePayments(repo, testProvider, 0); failed != 0 {
+		t.Fatalf("expected the captured payment to be left to its webhook, got %d failed", failed)
+	}
+
+	reserved, _, _ := repo.TakenSeats(1)
+	if !reserved["A1"] {
+		t.Fatalf("expected the seat to stay taken, got %v", reserved)
+	}
+}
+
+// reserveBooking reserves seats for the showtime and returns the booking id.
+func reserveBooking(t *testing.T, router *gin.Engine, showtimeId int, token string, seats ...string) string {
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: token, ShowtimeID: showtimeId, Seats: seats})
+	var body struct {
+		BookingID string `json:"booking_id"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code >= 300 || body.BookingID == "" {
+		t.Fatalf("expected a booking, got %d: %s", res.Code, res.Body)
+	}
+	return body.BookingID
+}
+
+func TestCancelBookingSeats(t *testing.T) {
+	repo := newTestRepository(nextWeekday(time.Wednesday, 20))
+	router := newTestRouter(repo, 1)
+	bookingId := reserveBooking(t, router, 1, TEST_TOKEN, "A1", "B1")
+
+	res := request(router, http.MethodPost, "/user/bookings/"+bookingId+"/cancel", CancelSeatsBody{Seats: []string{"A2"}})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a seat outside the booking, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPost, "/user/bookings/"+bookingId+"/cancel", CancelSeatsBody{Seats: []string{"b1"}})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	booking, _ := repo.FindBooking(bookingId)
+	if len(booking.Seats) != 1 || booking.Seats[0].Seat != "A1" {
+		t.Fatalf("expected only A1 to be left, got %+v", booking.Seats)
+	}
+
+	payment, _ := repo.FindPayment(booking.PaymentID)
+	if payment.Status != payments.PAYMENT_CAPTURED || payment.Refunded != 1500 {
+		t.Fatalf("expected 1500 refunded of a captured payment, got %+v", payment)
+	}
+
+	res = request(router, http.MethodDelete, "/user/bookings/"+bookingId, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	payment, _ = repo.FindPayment(booking.PaymentID)
+	if payment.Status != payments.PAYMENT_REFUNDED || payment.Refunded != payment.Amount {
+		t.Fatalf("expected a fully refunded payment, got %+v", payment)
+	}
+
+	res = request(router, http.MethodGet, "/user/bookings/"+bookingId, nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a canceled booking, got %d", res.Code)
+	}
+}
+
+func TestCancelBookingKeepsOtherScreenings(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	repo.AddShowtime(showtimes.Showtime{ID: 2, MovieID: 1, HallID: 1, HallName: "Main", StartsAt: time.Now().Add(48 * time.Hour)})
+	router := newTestRouter(repo, 1)
+	first := reserveBooking(t, router, 1, TEST_TOKEN, "A1")
+	second := reserveBooking(t, router, 2, TEST_TOKEN, "A1")
+
+	res := request(router, http.MethodDelete, "/user/bookings/"+first, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	if _, err := repo.FindBooking(second); err != nil {
+		t.Fatalf("expected the other screening to be kept, got %v", err)
+	}
+
+	if res := request(router, http.MethodGet, "/user/bookings/"+second, nil); res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+
+	other := newTestRouter(repo, 2)
+	if res := request(other, http.MethodGet, "/user/bookings/"+second, nil); res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a booking of another user, got %d", res.Code)
+	}
+}
+
+func TestCancelBookingRefusals(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(time.Hour))
+	router := newTestRouter(repo, 1)
+	late := reserveBooking(t, router, 1, TEST_TOKEN, "A1")
+
+	res := request(router, http.MethodDelete, "/user/bookings/"+late, nil)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 past the cutoff, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodDelete, "/user/reservations/"+late, nil)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 past the cutoff, got %d", res.Code)
+	}
+
+	repo = newTestRepository(time.Now().Add(24 * time.Hour))
+	router = newTestRouter(repo, 1)
+	pending := reserveBooking(t, router, 1, payments.FAKE_TOKEN_ASYNC, "A1")
+
+	res = request(router, http.MethodDelete, "/user/bookings/"+pending, nil)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while the payment is pending, got %d", res.Code)
+	}
+}
+
+func TestRefundBookingIgnoresCutoff(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(time.Hour))
+	router := newTestRouter(repo, 1)
+	bookingId := reserveBooking(t, router, 1, TEST_TOKEN, "A1")
+
+	staff := newTestRouter(repo, 2)
+	res := request(staff, http.MethodDelete, "/bookings/"+bookingId, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	if _, err := repo.FindBooking(bookingId); err != ErrBookingNotFound {
+		t.Fatalf("expected the booking to be gone, got %v", err)
+	}
+
+	if res := request(staff, http.MethodDelete, "/bookings/"+bookingId, nil); res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
+
+func waitlistOf(t *testing.T, router *gin.Engine) []WaitlistEntry {
+	res := request(router, http.MethodGet, "/user/waitlist", nil)
+	var body struct {
+		Waitlist []WaitlistEntry `json:"waitlist"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("expected the waitlist, got %d: %s", res.Code, res.Body)
+	}
+	return body.Waitlist
+}
+
+func TestWaitlistOffersFreedSeats(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	owner := newTestRouter(repo, 1)
+	first := newTestRouter(repo, 2)
+	second := newTestRouter(repo, 3)
+
+	if res := request(first, http.MethodPost, "/movie/1/waitlist", WaitlistBody{ShowtimeID: 1, Seats: 2}); res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while seats are free, got %d", res.Code)
+	}
+
+	bookingId := reserveBooking(t, owner, 1, TEST_TOKEN, "A1", "A2", "A3", "B1", "B2")
+
+	if res := request(second, http.MethodPost, "/movie/1/waitlist", WaitlistBody{ShowtimeID: 1, Seats: 3}); res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body)
+	}
+	if res := request(first, http.MethodPost, "/movie/1/waitlist", WaitlistBody{ShowtimeID: 1, Seats: 2}); res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body)
+	}
+	if res := request(first, http.MethodPost, "/movie/1/waitlist", WaitlistBody{ShowtimeID: 1, Seats: 1}); res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 when joining twice, got %d", res.Code)
+	}
+	if res := request(first, http.MethodPost, "/movie/1/waitlist", WaitlistBody{ShowtimeID: 1, Seats: 9}); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for too many seats, got %d", res.Code)
+	}
+
+	res := request(owner, http.MethodPost, "/user/bookings/"+bookingId+"/cancel", CancelSeatsBody{Seats: []string{"A1", "A2"}})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	// The first in line wants more than was freed, so the next one who fits
+	// gets the offer.
+	if entries := waitlistOf(t, second); entries[0].Status != WAITLIST_WAITING {
+		t.Fatalf("expected the larger request to keep waiting, got %+v", entries[0])
+	}
+
+	entries := waitlistOf(t, first)
+	if len(entries) != 1 || entries[0].Status != WAITLIST_OFFERED || entries[0].Hold == nil || len(entries[0].Hold.Seats) != 2 {
+		t.Fatalf("expected an offer of two seats, got %+v", entries)
+	}
+
+	holdId := entries[0].Hold.ID
+	if res := request(owner, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: entries[0].Hold.Seats}); res.Code != http.StatusConflict {
+		t.Fatalf("expected offered seats to be held, got %d", res.Code)
+	}
+
+	res = request(first, http.MethodPost, fmt.Sprintf("/holds/%d/confirm", holdId), ConfirmHoldBody{PaymentToken: TEST_TOKEN})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected the offer to be claimed, got %d: %s", res.Code, res.Body)
+	}
+
+	if entries := waitlistOf(t, first); entries[0].Status != WAITLIST_CLAIMED {
+		t.Fatalf("expected a claimed entry, got %+v", entries[0])
+	}
+}
+
+func TestWaitlistOfferMovesOn(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	owner := newTestRouter(repo, 1)
+	first := newTestRouter(repo, 2)
+	second := newTestRouter(repo, 3)
+
+	bookingId := reserveBooking(t, owner, 1, TEST_TOKEN, "A1", "A2", "A3", "B1", "B2")
+	request(first, http.MethodPost, "/movie/1/waitlist", WaitlistBody{ShowtimeID: 1, Seats: 1})
+	request(second, http.MethodPost, "/movie/1/waitlist", WaitlistBody{ShowtimeID: 1, Seats: 1})
+
+	request(owner, http.MethodPost, "/user/bookings/"+bookingId+"/cancel", CancelSeatsBody{Seats: []string{"A1"}})
+
+	entry := waitlistOf(t, first)[0]
+	if entry.Status != WAITLIST_OFFERED {
+		t.Fatalf("expected the first in line to get the offer, got %+v", entry)
+	}
+
+	// Leaving hands the offer to the next user.
+	if res := request(first, http.MethodDelete, fmt.Sprintf("/user/waitlist/%d", entry.ID), nil); res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+	if res := request(first, http.MethodDelete, fmt.Sprintf("/user/waitlist/%d", entry.ID), nil); res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when leaving twice, got %d", res.Code)
+	}
+
+	next := waitlistOf(t, second)[0]
+	if next.Status != WAITLIST_OFFERED {
+		t.Fatalf("expected the next user to get the offer, got %+v", next)
+	}
+
+	// An offer that runs out expires and frees the seat again.
+	repo.mu.Lock()
+	repo.holds[next.Hold.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	repo.mu.Unlock()
+
+	repo.ReleaseExpiredHolds()
+	offerWaitlist(repo)
+
+	if entry := waitlistOf(t, second)[0]; entry.Status != WAITLIST_EXPIRED {
+		t.Fatalf("expected the offer to expire, got %+v", entry)
+	}
+	if _, held, _ := repo.TakenSeats(1); len(held) != 0 {
+		t.Fatalf("expected no seats held after the expiry, got %v", held)
+	}
+}
+
+func TestReservationNotifications(t *testing.T) {
+	repo := newTestRepository(nextWeekday(time.Wednesday, 20))
+	repo.AddUser(users.User{ID: 1, Name: "Ripley", Email: "ripley@example.com"})
+	router := newTestRouter(repo, 1)
+
+	bookingId := reserveBooking(t, router, 1, TEST_TOKEN, "A1", "B1")
+	res := request(router, http.MethodPost, "/user/bookings/"+bookingId+"/cancel", CancelSeatsBody{Seats: []string{"B1"}})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	queued := repo.Outbox().List()
+	if len(queued) != 2 {
+		t.Fatalf("expected a confirmation and a cancellation, got %+v", queued)
+	}
+
+	confirmation := queued[0]
+	if confirmation.Kind != notifications.KIND_RESERVATION_CONFIRMED || confirmation.Recipient != "ripley@example.com" || confirmation.Data.BookingID != bookingId || confirmation.Data.Title != "Alien" || len(confirmation.Data.Seats) != 2 || confirmation.Data.Total == 0 {
+		t.Fatalf("unexpected confirmation %+v", confirmation)
+	}
+
+	cancellation := queued[1]
+	if cancellation.Kind != notifications.KIND_RESERVATION_CANCELED || len(cancellation.Data.Seats) != 1 || cancellation.Data.Seats[0] != "B1" || cancellation.Data.Refund != 1500 {
+		t.Fatalf("unexpected cancellation %+v", cancellation)
+	}
+
+	// A seat that cannot be taken queues nothing.
+	request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: TEST_TOKEN, ShowtimeID: 1, Seats: []string{"A1"}})
+	if len(repo.Outbox().List()) != 2 {
+		t.Fatal("expected no notification for a failed reservation")
+	}
+
+	// A declined card releases the seats and says so instead of confirming.
+	res = request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: payments.FAKE_TOKEN_DECLINE, ShowtimeID: 1, Seats: []string{"A2"}})
+	if res.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected 402, got %d: %s", res.Code, res.Body)
+	}
+
+	queued = repo.Outbox().List()
+	if len(queued) != 3 || queued[2].Kind != notifications.KIND_PAYMENT_FAILED || queued[2].Data.Seats[0] != "A2" {
+		t.Fatalf("expected only a payment failure notice, got %+v", queued[2:])
+	}
+}
+
+func TestConfirmationWaitsForCapture(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	repo.AddUser(users.User{ID: 1, Name: "Ripley", Email: "ripley@example.com"})
+	router := newTestRouter(repo, 1)
+
+	res := request(router, http.MethodPost, "/movie/1/reserve", ReserveBody{PaymentToken: payments.FAKE_TOKEN_ASYNC, ShowtimeID: 1, Seats: []string{"A1"}})
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", res.Code, res.Body)
+	}
+
+	if queued := repo.Outbox().List(); len(queued) != 0 {
+		t.Fatalf("expected no confirmation before the capture, got %+v", queued)
+	}
+
+	var body struct {
+		Payment payments.Payment `json:"payment"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if err := repo.SetPaymentStatus(body.Payment.ID, payments.PAYMENT_CAPTURED, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	queued := repo.Outbox().List()
+	if len(queued) != 1 || queued[0].Kind != notifications.KIND_RESERVATION_CONFIRMED {
+		t.Fatalf("expected the confirmation once captured, got %+v", queued)
+	}
+}
+
+func TestQueueReminders(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(3 * time.Hour))
+	repo.AddUser(users.User{ID: 1, Name: "Ripley", Email: "ripley@example.com"})
+	router := newTestRouter(repo, 1)
+
+	bookingId := reserveBooking(t, router, 1, TEST_TOKEN, "A2", "A1")
+
+	// Booked within the lead: the confirmation is reminder enough.
+	if queued, _ := repo.QueueReminders(REMINDER_LEAD); queued != 0 {
+		t.Fatalf("expected no reminder for a late booking, got %d", queued)
+	}
+
+	repo.mu.Lock()
+	for _, reservation := range repo.reservations {
+		reservation.CreatedAt = time.Now().Add(-48 * time.Hour)
+	}
+	repo.mu.Unlock()
+
+	if queued, _ := repo.QueueReminders(REMINDER_LEAD); queued != 1 {
+		t.Fatalf("expected one reminder, got %d", queued)
+	}
+	if queued, _ := repo.QueueReminders(REMINDER_LEAD); queued != 0 {
+		t.Fatalf("expected the reminder to be queued once, got %d", queued)
+	}
+
+	queued := repo.Outbox().List()
+	reminder := queued[len(queued)-1]
+	if reminder.Kind != notifications.KIND_SHOWTIME_REMINDER || reminder.Data.BookingID != bookingId || strings.Join(reminder.Data.Seats, ",") != "A1,A2" {
+		t.Fatalf("unexpected reminder %+v", reminder)
+	}
+}
+
+func TestCancelRefundsOnce(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	router := newTestRouter(repo, 1)
+	bookingId := reserveBooking(t, router, 1, TEST_TOKEN, "A1", "A2")
+	booking, _ := repo.FindBooking(bookingId)
+
+	codes := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			codes <- request(router, http.MethodDelete, "/user/bookings/"+bookingId, nil).Code
+		}()
+	}
+
+	canceled := 0
+	for i := 0; i < 3; i++ {
+		if <-codes == http.StatusOK {
+			canceled++
+		}
+	}
+	if canceled != 1 {
+		t.Fatalf("expected a single cancellation, got %d", canceled)
+	}
+
+	payment, _ := repo.FindPayment(booking.PaymentID)
+	if payment.Status != payments.PAYMENT_REFUNDED || payment.Refunded != payment.Amount {
+		t.Fatalf("expected the payment to be refunded once, got %+v", payment)
+	}
+
+	refunds, err := repo.CancelSeats([]Cancellation{{BookingID: bookingId, Seats: []string{"A1"}}})
+	if err != ErrBookingNotFound || len(refunds) != 0 {
+		t.Fatalf("expected canceled seats to stay canceled, got %v %v", refunds, err)
+	}
+}
+
+// failingRefunds is a provider that is down for refunds.
+type failingRefunds struct {
+	payments.Provider
+	down bool
+}
+
+func (p *failingRefunds) Refund(providerId string, amount int, idempotencyKey string) error {
+	if p.down {
+		return fmt.Errorf("provider unavailable")
+	}
+
+	return p.Provider.Refund(providerId, amount, idempotencyKey)
+}
+
+func TestFailedRefundIsRetried(t *testing.T) {
+	repo := newTestRepository(time.Now().Add(24 * time.Hour))
+	bookingId := reserveBooking(t, newTestRouter(repo, 1), 1, TEST_TOKEN, "A1")
+	booking, _ := repo.FindBooking(bookingId)
+
+	provider := &failingRefunds{Provider: testProvider, down: true}
+	handler := NewHandler(repo, newTestUsers(), provider, pricing.DefaultRules(), DEFAULT_CANCELLATION_CUTOFF, time.UTC)
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.DELETE("/user/bookings/:id", asUser(1), handler.CancelBooking)
+
+	res := request(router, http.MethodDelete, "/user/bookings/"+bookingId, nil)
+	var body struct {
+		Refunded      int `json:"refunded"`
+		RefundPending int `json:"refund_pending"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code != http.StatusOK || body.Refunded != 0 || body.RefundPending != booking.Seats[0].Price {
+		t.Fatalf("expected the refund to be pending, got %d: %s", res.Code, res.Body)
+	}
+
+	reserved, _, _ := repo.TakenSeats(1)
+	if len(reserved) != 0 {
+		t.Fatalf("expected the seat to be released, got %v", reserved)
+	}
+
+	RetryRefunds(repo, provider, 0)
+	if pending, _ := repo.PendingRefunds(0); len(pending) != 1 {
+		t.Fatalf("expected the refund to stay pending, got %+v", pending)
+	}
+
+	provider.down = false
+	RetryRefunds(repo, provider, 0)
+	RetryRefunds(repo, provider, 0)
+
+	payment, _ := repo.FindPayment(booking.PaymentID)
+	if payment.Status != payments.PAYMENT_REFUNDED || payment.Refunded != payment.Amount {
+		t.Fatalf("expected the payment to be refunded once, got %+v", payment)
+	}
+	if pending, _ := repo.PendingRefunds(0); len(pending) != 0 {
+		t.Fatalf("expected no pending refund, got %+v", pending)
+	}
+}
@@ -0,0 +1,237 @@
+package reservation
+
+import (
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/logging"
+	"movie-reservation-system/users"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	WAITLIST_WAITING = "waiting"
+	WAITLIST_OFFERED = "offered"
+	WAITLIST_CLAIMED = "claimed"
+	WAITLIST_EXPIRED = "expired"
+	WAITLIST_LEFT    = "left"
+)
+
+// CLAIM_WINDOW is how long a waitlisted user has to pay for the seats
+// offered to them before they go to the next user.
+const CLAIM_WINDOW = 15 * time.Minute
+
+type WaitlistEntry struct {
+	ID         int    `json:"id"`
+	ShowtimeID int    `json:"showtime_id"`
+	UserID     int    `json:"-"`
+	Seats      int    `json:"seats"`
+	Status     string `json:"status"`
+	// Hold is the offer made to the user, confirmed through the holds
+	// endpoints.
+	Hold      *Hold     `json:"hold,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WaitlistBody struct {
+	ShowtimeID int `json:"showtime_id"`
+	Seats      int `json:"seats"`
+}
+
+// freeSeats lists the seats of the showtime that are neither reserved,
+// held nor disabled, in hall order.
+func freeSeats(reservations ReservationRepository, showtimeId int, hallId int) ([]string, error) {
+	hall, err := reservations.FindHall(hallId)
+	if err != nil {
+		return nil, fmt.Errorf("hall %d of showtime %d: %w", hallId, showtimeId, err)
+	}
+
+	reserved, held, err := reservations.TakenSeats(showtimeId)
+	if err != nil {
+		return nil, err
+	}
+
+	free := []string{}
+	for _, seat := range hall.Seats() {
+		if !seat.Disabled && !reserved[seat.ID] && !held[seat.ID] {
+			free = append(free, seat.ID)
+		}
+	}
+
+	return free, nil
+}
+
+// OfferFreedSeats holds free seats of the showtime for the waiting users, in
+// the order they joined. Users asking for more seats than are left keep
+// their place while the ones behind them who fit get an offer. It returns
+// the offers made.
+func OfferFreedSeats(reservations ReservationRepository, showtimeId int) ([]WaitlistEntry, error) {
+	showtime, err := reservations.FindShowtime(showtimeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if showtime.StartsAt.Before(time.Now()) {
+		return nil, nil
+	}
+
+	entries, err := reservations.WaitingEntries(showtimeId)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	free, err := freeSeats(reservations, showtime.ID, showtime.HallID)
+	if err != nil {
+		return nil, err
+	}
+
+	offers := []WaitlistEntry{}
+	for _, entry := range entries {
+		if entry.Seats > len(free) {
+			continue
+		}
+
+		hold, err := reservations.OfferSeats(entry.ID, showtime, free[:entry.Seats], CLAIM_WINDOW)
+		if err == ErrWaitlistEntryNotFound {
+			// The user left or got an offer from a concurrent request.
+			continue
+		}
+		if err == ErrSeatTaken {
+			// Someone else got there first; the next freed seats retry.
+			break
+		}
+		if err != nil {
+			return offers, err
+		}
+
+		entry.Status = WAITLIST_OFFERED
+		entry.Hold = hold
+		offers = append(offers, entry)
+		free = free[entry.Seats:]
+	}
+
+	return offers, nil
+}
+
+// offerFreedSeats offers seats freed by a request. Failures are only logged
+// since the seats were freed anyway and the sweeper retries.
+func (h *Handler) offerFreedSeats(c *gin.Context, showtimeId int) {
+	offers, err := OfferFreedSeats(h.reservations, showtimeId)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("offering freed seats", "showtime_id", showtimeId, "error", err)
+	}
+
+	for _, offer := range offers {
+		logging.FromContext(c.Request.Context()).Info("offered seats to waitlist", "entry_id", offer.ID, "hold_id", offer.Hold.ID)
+	}
+}
+
+// JoinWaitlist puts the caller in line for a screening that does not have
+// enough free seats left.
+func (h *Handler) JoinWaitlist(c *gin.Context) {
+	var body WaitlistBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	fields := make(map[string]string)
+	if body.ShowtimeID < 1 {
+		fields["showtime_id"] = "is required"
+	}
+	if body.Seats < 1 || body.Seats > MAX_SEATS {
+		fields["seats"] = fmt.Sprintf("must be between 1 and %d", MAX_SEATS)
+	}
+	if len(fields) > 0 {
+		apierror.Abort(c, apierror.Validation(fields))
+		return
+	}
+
+	movieId, err := apierror.IDParam(c, "id", "movie")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	showtime, err := h.reservations.FindShowtime(body.ShowtimeID)
+	if err == ErrShowtimeNotFound || (err == nil && showtime.MovieID != movieId) {
+		apierror.Abort(c, apierror.NotFound("showtime not found"))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if showtime.StartsAt.Before(time.Now()) {
+		apierror.Abort(c, apierror.Invalid("showtime already started"))
+		return
+	}
+
+	free, err := freeSeats(h.reservations, showtime.ID, showtime.HallID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if len(free) >= body.Seats {
+		apierror.Abort(c, apierror.Conflict("enough seats are available, reserve them instead").WithDetails(gin.H{"available": len(free)}))
+		return
+	}
+
+	entry := &WaitlistEntry{
+		ShowtimeID: showtime.ID,
+		UserID:     users.ExtractUserIdFromClaims(c),
+		Seats:      body.Seats,
+		Status:     WAITLIST_WAITING,
+	}
+	err = h.reservations.JoinWaitlist(entry)
+	if err == ErrAlreadyWaitlisted {
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+func (h *Handler) GetWaitlist(c *gin.Context) {
+	entries, err := h.reservations.ListWaitlist(users.ExtractUserIdFromClaims(c))
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"waitlist": entries})
+}
+
+// LeaveWaitlist takes the caller out of line. Seats offered to them go to
+// the next user.
+func (h *Handler) LeaveWaitlist(c *gin.Context) {
+	entryId, err := apierror.IDParam(c, "id", "waitlist entry")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	entry, err := h.reservations.LeaveWaitlist(entryId, users.ExtractUserIdFromClaims(c))
+	if err == ErrWaitlistEntryNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if entry.Hold != nil {
+		h.offerFreedSeats(c, entry.ShowtimeID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "left the waitlist"})
+}
@@ -0,0 +1,228 @@
+package showtimes
+
+import (
+	"database/sql"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/database"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type Showtime struct {
+	ID       int       `json:"id"`
+	MovieID  int       `json:"movie_id"`
+	HallID   int       `json:"hall_id"`
+	HallName string    `json:"hall_name"`
+	StartsAt time.Time `json:"starts_at"`
+}
+
+type CreateShowtimeBody struct {
+	MovieID  int    `json:"movie_id" binding:"required,min=1"`
+	HallID   int    `json:"hall_id" binding:"required,min=1"`
+	StartsAt string `json:"starts_at" binding:"required"`
+}
+
+func FindShowtimeById(id int) *Showtime {
+	row := database.Db.QueryRow(`
+		SELECT s.id, s.movie_id, s.hall_id, h.name, s.starts_at
+		FROM showtimes s
+		JOIN halls h ON s.hall_id = h.id
+		WHERE s.id = $1
+	`, id)
+
+	var showtime Showtime
+	err := row.Scan(&showtime.ID, &showtime.MovieID, &showtime.HallID, &showtime.HallName, &showtime.StartsAt)
+	if err != nil {
+		return nil
+	}
+
+	return &showtime
+}
+
+func GetMovieShowtimes(c *gin.Context) {
+	movieId, err := apierror.IDParam(c, "id", "movie")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	rows, err := database.Db.Query(`
+		SELECT s.id, s.movie_id, s.hall_id, h.name, s.starts_at
+		FROM showtimes s
+		JOIN halls h ON s.hall_id = h.id
+		WHERE s.movie_id = $1 AND s.starts_at > NOW()
+		ORDER BY s.starts_at
+	`, movieId)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	defer rows.Close()
+
+	showtimes := []Showtime{}
+	var showtime Showtime
+	for rows.Next() {
+		err := rows.Scan(&showtime.ID, &showtime.MovieID, &showtime.HallID, &showtime.HallName, &showtime.StartsAt)
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+		showtimes = append(showtimes, showtime)
+	}
+
+	if err := rows.Err(); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"showtimes": showtimes})
+}
+
+func GetShowtime(c *gin.Context) {
+	showtimeId, err := apierror.IDParam(c, "id", "showtime")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	showtime := FindShowtimeById(showtimeId)
+	if showtime == nil {
+		apierror.Abort(c, apierror.NotFound("showtime not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, showtime)
+}
+
+func CreateShowtime(c *gin.Context) {
+	var body CreateShowtimeBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, body.StartsAt)
+	if err != nil {
+		apierror.Abort(c, apierror.InvalidField("starts_at", "must be an RFC3339 timestamp"))
+		return
+	}
+
+	if startsAt.Before(time.Now()) {
+		apierror.Abort(c, apierror.InvalidField("starts_at", "must be in the future"))
+		return
+	}
+
+	var archived bool
+	err = database.Db.QueryRow(`
+		SELECT archived_at IS NOT NULL FROM movies WHERE id = $1
+	`, body.MovieID).Scan(&archived)
+	if err == sql.ErrNoRows {
+		apierror.Abort(c, apierror.Invalid("movie or hall not found"))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if archived {
+		apierror.Abort(c, apierror.InvalidField("movie_id", "movie is archived"))
+		return
+	}
+
+	var showtimeId int
+	err = database.Db.QueryRow(`
+		INSERT INTO showtimes (movie_id, hall_id, starts_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, body.MovieID, body.HallID, startsAt).Scan(&showtimeId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				apierror.Abort(c, apierror.Conflict("hall already has a showtime at that time"))
+				return
+			case "foreign_key_violation":
+				apierror.Abort(c, apierror.Invalid("movie or hall not found"))
+				return
+			}
+		}
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, FindShowtimeById(showtimeId))
+}
+
+// deleteError explains why a showtime could not be deleted. Canceled
+// reservations and payments keep referencing their showtime, so a showtime
+// that ever sold a seat stays for the records.
+func deleteError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+		return apierror.Conflict("showtime has past reservations or payments")
+	}
+
+	return err
+}
+
+func DeleteShowtime(c *gin.Context) {
+	showtimeId, err := apierror.IDParam(c, "id", "showtime")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	tx, err := database.Db.Begin()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var reserved bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM Reservation
+			WHERE showtime_id = $1 AND deleted_at IS NULL
+		)
+	`, showtimeId).Scan(&reserved)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if reserved {
+		apierror.Abort(c, apierror.Conflict("showtime has active reservations"))
+		return
+	}
+
+	res, err := tx.Exec("DELETE FROM showtimes WHERE id = $1", showtimeId)
+	if err != nil {
+		apierror.Abort(c, deleteError(err))
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		apierror.Abort(c, apierror.NotFound("showtime not found"))
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "showtime deleted"})
+}
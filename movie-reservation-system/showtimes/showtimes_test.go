@@ -0,0 +1,23 @@
+package showtimes
+
+import (
+	"errors"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestDeleteError(t *testing.T) {
+	// 23503 is foreign_key_violation.
+	var apiErr *apierror.Error
+	if !errors.As(deleteError(&pq.Error{Code: "23503"}), &apiErr) || apiErr.Status != http.StatusConflict {
+		t.Fatalf("expected a referenced showtime to be a conflict, got %v", apiErr)
+	}
+
+	other := errors.New("connection reset")
+	if deleteError(other) != other {
+		t.Fatal("expected other errors to be left alone")
+	}
+}
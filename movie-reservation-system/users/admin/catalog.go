@@ -0,0 +1,129 @@
+package users
+
+import (
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/movies"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MAX_NAME_LENGTH  = 255
+	FIRST_MOVIE_YEAR = 1888
+)
+
+type NameBody struct {
+	Name string `json:"name"`
+}
+
+func bindName(c *gin.Context) (string, bool) {
+	var body NameBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return "", false
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		apierror.Abort(c, apierror.InvalidField("name", "is required"))
+		return "", false
+	}
+
+	if len(name) > MAX_NAME_LENGTH {
+		apierror.Abort(c, apierror.InvalidField("name", fmt.Sprintf("must be at most %d characters", MAX_NAME_LENGTH)))
+		return "", false
+	}
+
+	return name, true
+}
+
+func namedWriteError(c *gin.Context, err error) {
+	switch err {
+	case movies.ErrGenreNotFound, movies.ErrCastMemberNotFound:
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+	case movies.ErrNameTaken:
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+	default:
+		apierror.Abort(c, err)
+	}
+}
+
+// Genres and cast members are both plain named rows, so they share the
+// handlers below.
+func createNamed(c *gin.Context, create func(string) (int, error)) {
+	name, ok := bindName(c)
+	if !ok {
+		return
+	}
+
+	id, err := create(name)
+	if err != nil {
+		namedWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "name": name})
+}
+
+func updateNamed(c *gin.Context, update func(int, string) error) {
+	id, err := apierror.IDParam(c, "id", "")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	name, ok := bindName(c)
+	if !ok {
+		return
+	}
+
+	if err := update(id, name); err != nil {
+		namedWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "name": name})
+}
+
+// deleteNamed removes the row and detaches it from every movie.
+func deleteNamed(c *gin.Context, remove func(int) error) {
+	id, err := apierror.IDParam(c, "id", "")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if err := remove(id); err != nil {
+		namedWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+func (h *Handler) CreateGenre(c *gin.Context) {
+	createNamed(c, h.movies.CreateGenre)
+}
+
+func (h *Handler) UpdateGenre(c *gin.Context) {
+	updateNamed(c, h.movies.UpdateGenre)
+}
+
+func (h *Handler) DeleteGenre(c *gin.Context) {
+	deleteNamed(c, h.movies.DeleteGenre)
+}
+
+func (h *Handler) CreateCastMember(c *gin.Context) {
+	createNamed(c, h.movies.CreateCastMember)
+}
+
+func (h *Handler) UpdateCastMember(c *gin.Context) {
+	updateNamed(c, h.movies.UpdateCastMember)
+}
+
+func (h *Handler) DeleteCastMember(c *gin.Context) {
+	deleteNamed(c, h.movies.DeleteCastMember)
+}
@@ -1,62 +1,235 @@
 package users
 
 import (
-	"movie-reservation-system/database"
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/movies"
+	"movie-reservation-system/reservation"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type reservation struct {
-	Name        string    `json:"name"`
-	Email       string    `json:"email"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	ImageUrl    string    `json:"image_url"`
-	Date        time.Time `json:"date"`
-	Seat        string    `json:"seat"`
-}
-
-func GetAllMovieReservations(c *gin.Context) {
-	movieId := c.Param("id")
-	query := `
-    SELECT 
-      u.name,
-      u.email,
-      m.title,
-      m.description,
-      m.image_url,
-      r.date,
-      r.seat
-    FROM reservation r
-    JOIN users u ON r.user_id = u.id
-    JOIN movies m ON r.movie_id = m.id
-    WHERE movie_id = $1
-  `
-
-	rows, err := database.Db.Query(query, movieId)
+type Handler struct {
+	movies       movies.MovieRepository
+	reservations reservation.ReservationRepository
+	location     *time.Location
+}
+
+// NewHandler reports on the days of location.
+func NewHandler(movies movies.MovieRepository, reservations reservation.ReservationRepository, location *time.Location) *Handler {
+	return &Handler{movies: movies, reservations: reservations, location: location}
+}
+
+func (h *Handler) GetAllMovieReservations(c *gin.Context) {
+	movieId, err := apierror.IDParam(c, "id", "movie")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		apierror.Abort(c, err)
 		return
 	}
 
-	defer rows.Close()
-
-	var reservations []reservation
-	var reservation reservation
-	for rows.Next() {
-		rows.Scan(
-			&reservation.Name,
-			&reservation.Email,
-			&reservation.Title,
-			&reservation.Description,
-			&reservation.ImageUrl,
-			&reservation.Date,
-			&reservation.Seat,
-		)
-		reservations = append(reservations, reservation)
+	reservations, err := h.reservations.ListForMovie(movieId)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, reservations)
 }
+
+type MovieBody struct {
+	Title       string `json:"title"`
+	Year        int    `json:"year"`
+	Description string `json:"description"`
+	ImageUrl    string `json:"image_url"`
+	GenreIDs    []int  `json:"genre_ids"`
+	CastIDs     []int  `json:"cast_ids"`
+}
+
+type AssociationBody struct {
+	IDs []int `json:"ids" binding:"required"`
+}
+
+// validateMovie trims the body in place and reports every invalid field.
+func validateMovie(body *MovieBody) error {
+	body.Title = strings.TrimSpace(body.Title)
+	body.Description = strings.TrimSpace(body.Description)
+	body.ImageUrl = strings.TrimSpace(body.ImageUrl)
+
+	fields := make(map[string]string)
+	if body.Title == "" {
+		fields["title"] = "is required"
+	} else if len(body.Title) > MAX_NAME_LENGTH {
+		fields["title"] = fmt.Sprintf("must be at most %d characters", MAX_NAME_LENGTH)
+	}
+
+	if body.Year < FIRST_MOVIE_YEAR || body.Year > time.Now().Year()+5 {
+		fields["year"] = fmt.Sprintf("must be between %d and %d", FIRST_MOVIE_YEAR, time.Now().Year()+5)
+	}
+
+	if body.ImageUrl != "" {
+		parsed, err := url.ParseRequestURI(body.ImageUrl)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fields["image_url"] = "must be an http(s) URL"
+		}
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	return nil
+}
+
+func bindMovieBody(c *gin.Context) (*movies.MovieInput, bool) {
+	var body MovieBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return nil, false
+	}
+
+	if err := validateMovie(&body); err != nil {
+		apierror.Abort(c, err)
+		return nil, false
+	}
+
+	return &movies.MovieInput{
+		Title:       body.Title,
+		Year:        body.Year,
+		Description: body.Description,
+		ImageUrl:    body.ImageUrl,
+		GenreIDs:    body.GenreIDs,
+		CastIDs:     body.CastIDs,
+	}, true
+}
+
+func movieIdParam(c *gin.Context) (int, bool) {
+	movieId, err := apierror.IDParam(c, "id", "movie")
+	if err != nil {
+		apierror.Abort(c, err)
+		return 0, false
+	}
+
+	return movieId, true
+}
+
+// movieWriteError maps the repository errors of a movie write to a response.
+func movieWriteError(c *gin.Context, err error) {
+	switch err {
+	case movies.ErrMovieNotFound:
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+	case movies.ErrUnknownReference:
+		apierror.Abort(c, apierror.Invalid(err.Error()))
+	case movies.ErrMovieScheduled:
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+	default:
+		apierror.Abort(c, err)
+	}
+}
+
+func (h *Handler) CreateMovie(c *gin.Context) {
+	movie, ok := bindMovieBody(c)
+	if !ok {
+		return
+	}
+
+	movieId, err := h.movies.Create(*movie)
+	if err != nil {
+		movieWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": movieId})
+}
+
+// UpdateMovie replaces the movie fields. Genres and cast are only replaced
+// when genre_ids or cast_ids are present in the body.
+func (h *Handler) UpdateMovie(c *gin.Context) {
+	movieId, ok := movieIdParam(c)
+	if !ok {
+		return
+	}
+
+	movie, ok := bindMovieBody(c)
+	if !ok {
+		return
+	}
+
+	if err := h.movies.Update(movieId, *movie); err != nil {
+		movieWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": movieId})
+}
+
+func (h *Handler) setArchived(c *gin.Context, archived bool) {
+	movieId, ok := movieIdParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.movies.SetArchived(movieId, archived); err != nil {
+		movieWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": movieId, "archived": archived})
+}
+
+// ArchiveMovie hides a movie from the catalog without touching its
+// reservations.
+func (h *Handler) ArchiveMovie(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+func (h *Handler) UnarchiveMovie(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+// DeleteMovie removes a movie that was never scheduled. Movies with showtimes
+// or reservations must be archived instead.
+func (h *Handler) DeleteMovie(c *gin.Context) {
+	movieId, ok := movieIdParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.movies.Delete(movieId); err != nil {
+		movieWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "movie deleted"})
+}
+
+func (h *Handler) setMovieAssociations(c *gin.Context, set func(int, []int) error) {
+	movieId, ok := movieIdParam(c)
+	if !ok {
+		return
+	}
+
+	var body AssociationBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if err := set(movieId, body.IDs); err != nil {
+		movieWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": movieId, "ids": body.IDs})
+}
+
+func (h *Handler) SetMovieGenres(c *gin.Context) {
+	h.setMovieAssociations(c, h.movies.SetGenres)
+}
+
+func (h *Handler) SetMovieCast(c *gin.Context) {
+	h.setMovieAssociations(c, h.movies.SetCast)
+}
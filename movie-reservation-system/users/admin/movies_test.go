@@ -0,0 +1,100 @@
+package users
+
+import (
+	"bytes"
+	"encoding/json"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/movies"
+	"movie-reservation-system/reservation"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func newTestRouter(repo movies.MovieRepository) *gin.Engine {
+	handler := NewHandler(repo, reservation.NewMemoryRepository(), time.UTC)
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.POST("/movies", handler.CreateMovie)
+	router.PUT("/movies/:id", handler.UpdateMovie)
+	router.DELETE("/movies/:id", handler.DeleteMovie)
+	router.POST("/movies/:id/archive", handler.ArchiveMovie)
+	router.PUT("/movies/:id/genres", handler.SetMovieGenres)
+	router.POST("/genres", handler.CreateGenre)
+	router.DELETE("/genres/:id", handler.DeleteGenre)
+	return router
+}
+
+func request(router *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestCreateMovie(t *testing.T) {
+	repo := movies.NewMemoryRepository()
+	router := newTestRouter(repo)
+
+	res := request(router, http.MethodPost, "/genres", NameBody{Name: "Horror"})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(router, http.MethodPost, "/genres", NameBody{Name: "horror"})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicated genre, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPost, "/movies", MovieBody{Title: "Alien", Year: 1979, GenreIDs: []int{1}})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(router, http.MethodPost, "/movies", MovieBody{Title: "Alien", Year: 1979, GenreIDs: []int{42}})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown genre, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPost, "/movies", MovieBody{Title: "Alien", Year: 1700})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid year, got %d", res.Code)
+	}
+}
+
+func TestDeleteMovie(t *testing.T) {
+	repo := movies.NewMemoryRepository()
+	router := newTestRouter(repo)
+	scheduled, _ := repo.Create(movies.MovieInput{Title: "Alien", Year: 1979})
+	repo.SetScheduled(scheduled, true)
+	unscheduled, _ := repo.Create(movies.MovieInput{Title: "Aliens", Year: 1986})
+
+	res := request(router, http.MethodDelete, "/movies/1", nil)
+	if scheduled != 1 || res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a scheduled movie, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPost, "/movies/1/archive", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200 archiving, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(router, http.MethodDelete, "/movies/2", nil)
+	if unscheduled != 2 || res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(router, http.MethodPut, "/movies/2", MovieBody{Title: "Aliens", Year: 1986})
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 updating a deleted movie, got %d", res.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package users
+
+import (
+	"encoding/csv"
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/logging"
+	"movie-reservation-system/reservation"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DEFAULT_REPORT_DAYS = 30
+	MAX_REPORT_DAYS     = 366
+)
+
+// parseReportQuery reads group (movie, date or booking_day), from and to
+// (inclusive days in location) and movie. Without dates the report covers
+// the last DEFAULT_REPORT_DAYS days.
+func parseReportQuery(c *gin.Context, location *time.Location) (reservation.ReportQuery, error) {
+	query := reservation.ReportQuery{GroupBy: c.DefaultQuery("group", reservation.REPORT_BY_MOVIE), Location: location}
+	if !reservation.REPORT_GROUPS[query.GroupBy] {
+		return query, fmt.Errorf("group must be one of movie, date or booking_day")
+	}
+
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	to := today
+	if value := c.Query("to"); value != "" {
+		date, err := time.ParseInLocation(reservation.REPORT_DAY_LAYOUT, value, location)
+		if err != nil {
+			return query, fmt.Errorf("to must be a date like 2006-01-02")
+		}
+		to = date
+	}
+
+	from := to.AddDate(0, 0, -(DEFAULT_REPORT_DAYS - 1))
+	if value := c.Query("from"); value != "" {
+		date, err := time.ParseInLocation(reservation.REPORT_DAY_LAYOUT, value, location)
+		if err != nil {
+			return query, fmt.Errorf("from must be a date like 2006-01-02")
+		}
+		from = date
+	}
+
+	if from.After(to) {
+		return query, fmt.Errorf("from must not be after to")
+	}
+
+	query.From = from
+	query.To = to.AddDate(0, 0, 1)
+	if query.To.Sub(query.From) > MAX_REPORT_DAYS*24*time.Hour {
+		return query, fmt.Errorf("reports cover at most %d days", MAX_REPORT_DAYS)
+	}
+
+	if value := c.Query("movie"); value != "" {
+		movieId, err := strconv.Atoi(value)
+		if err != nil || movieId < 1 {
+			return query, fmt.Errorf("invalid movie")
+		}
+		query.MovieID = movieId
+	}
+
+	return query, nil
+}
+
+func reportRecords(groupBy string, report []reservation.ReportRow) [][]string {
+	header := []string{"day"}
+	if groupBy == reservation.REPORT_BY_MOVIE {
+		header = []string{"movie_id", "title"}
+	}
+	header = append(header, "seats", "canceled", "cancellation_rate", "customers", "revenue", "refunded")
+
+	records := [][]string{header}
+	for _, row := range report {
+		record := []string{row.Day}
+		if groupBy == reservation.REPORT_BY_MOVIE {
+			record = []string{strconv.Itoa(row.MovieID), row.Title}
+		}
+		record = append(record,
+			strconv.Itoa(row.Seats),
+			strconv.Itoa(row.Canceled),
+			strconv.FormatFloat(row.CancellationRate, 'f', 4, 64),
+			strconv.Itoa(row.Customers),
+			strconv.Itoa(row.Revenue),
+			strconv.Itoa(row.Refunded),
+		)
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// GetReservationReport aggregates reserved and canceled seats, customers and
+// revenue per movie, screening day or booking day. format=csv, or an Accept
+// header asking for text/csv, downloads the report as CSV.
+func (h *Handler) GetReservationReport(c *gin.Context) {
+	query, err := parseReportQuery(c, h.location)
+	if err != nil {
+		apierror.Abort(c, apierror.Invalid(err.Error()))
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" && c.NegotiateFormat(gin.MIMEJSON, "text/csv") == "text/csv" {
+		format = "csv"
+	}
+	if format != "" && format != "json" && format != "csv" {
+		apierror.Abort(c, apierror.InvalidField("format", "must be json or csv"))
+		return
+	}
+
+	report, err := h.reservations.Report(query)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	from := query.From.Format(reservation.REPORT_DAY_LAYOUT)
+	to := query.To.AddDate(0, 0, -1).Format(reservation.REPORT_DAY_LAYOUT)
+
+	if format != "csv" {
+		c.JSON(http.StatusOK, gin.H{"group": query.GroupBy, "from": from, "to": to, "rows": report})
+		return
+	}
+
+	filename := fmt.Sprintf("reservations-%s-%s-%s.csv", query.GroupBy, from, to)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.WriteAll(reportRecords(query.GroupBy, report)); err != nil {
+		logging.FromContext(c.Request.Context()).Error("writing report", "error", err)
+	}
+}
@@ -0,0 +1,151 @@
+package users
+
+import (
+	"encoding/json"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/movies"
+	"movie-reservation-system/payments"
+	"movie-reservation-system/reservation"
+	"movie-reservation-system/showtimes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newReportRouter(location *time.Location) *gin.Engine {
+	repo := reservation.NewMemoryRepository()
+	repo.AddMovie(movies.Movie{ID: 1, Title: "Alien"})
+	repo.AddMovie(movies.Movie{ID: 2, Title: "Brazil"})
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	alien := &showtimes.Showtime{ID: 1, MovieID: 1, HallID: 1, StartsAt: today.Add(20 * time.Hour)}
+	brazil := &showtimes.Showtime{ID: 2, MovieID: 2, HallID: 1, StartsAt: today.AddDate(0, 0, -1).Add(20 * time.Hour)}
+
+	reserve := func(showtime *showtimes.Showtime, userId int, bookingId string, paymentId int, seats ...string) {
+		prices := make(map[string]int)
+		for _, seat := range seats {
+			prices[seat] = 1000
+		}
+		repo.CreatePayment(&payments.Payment{Amount: 1000 * len(seats), Status: payments.PAYMENT_PENDING})
+		repo.Reserve(showtime, userId, seats, reservation.Checkout{BookingID: bookingId, PaymentID: paymentId, Prices: prices})
+		repo.SetPaymentStatus(paymentId, payments.PAYMENT_AUTHORIZED, "")
+		repo.SetPaymentStatus(paymentId, payments.PAYMENT_CAPTURED, "")
+	}
+	reserve(alien, 1, "a", 1, "A1", "A2")
+	reserve(alien, 2, "b", 2, "A3")
+	reserve(brazil, 1, "c", 3, "A1")
+	refunds, _ := repo.CancelSeats([]reservation.Cancellation{{BookingID: "a", Seats: []string{"A2"}}})
+	repo.CompleteRefund(refunds[0].ID)
+
+	handler := NewHandler(movies.NewMemoryRepository(), repo, location)
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.GET("/reports/reservations", handler.GetReservationReport)
+	return router
+}
+
+func TestReservationReportByMovie(t *testing.T) {
+	router := newReportRouter(time.UTC)
+	to := time.Now().UTC().Format(reservation.REPORT_DAY_LAYOUT)
+
+	res := request(router, http.MethodGet, "/reports/reservations?to="+to, nil)
+	var body struct {
+		Rows []reservation.ReportRow `json:"rows"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code != http.StatusOK || len(body.Rows) != 2 {
+		t.Fatalf("expected two movies, got %d: %s", res.Code, res.Body)
+	}
+
+	alien := body.Rows[0]
+	if alien.Title != "Alien" || alien.Seats != 2 || alien.Canceled != 1 || alien.Customers != 2 || alien.Revenue != 2000 || alien.Refunded != 1000 {
+		t.Fatalf("unexpected Alien row: %+v", alien)
+	}
+
+	if rate := alien.CancellationRate; rate < 0.33 || rate > 0.34 {
+		t.Fatalf("expected a third of the seats canceled, got %f", rate)
+	}
+}
+
+func TestReservationReportByDate(t *testing.T) {
+	router := newReportRouter(time.UTC)
+	today := time.Now().UTC()
+	yesterday := today.AddDate(0, 0, -1).Format(reservation.REPORT_DAY_LAYOUT)
+
+	res := request(router, http.MethodGet, "/reports/reservations?group=date&from="+yesterday+"&to="+yesterday, nil)
+	var body struct {
+		Rows []reservation.ReportRow `json:"rows"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code != http.StatusOK || len(body.Rows) != 1 || body.Rows[0].Day != yesterday || body.Rows[0].Seats != 1 {
+		t.Fatalf("expected only the Brazil screening, got %d: %s", res.Code, res.Body)
+	}
+
+	res = request(router, http.MethodGet, "/reports/reservations?group=booking_day&to="+today.Format(reservation.REPORT_DAY_LAYOUT), nil)
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code != http.StatusOK || len(body.Rows) != 1 || body.Rows[0].Seats != 3 || body.Rows[0].Canceled != 1 {
+		t.Fatalf("expected every seat booked today, got %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestReservationReportDaysFollowLocation(t *testing.T) {
+	// The screenings are at 20:00 UTC, which is the next day ten hours east.
+	east := time.FixedZone("UTC+10", 10*60*60)
+	router := newReportRouter(east)
+	today := time.Now().UTC()
+	day := today.Format(reservation.REPORT_DAY_LAYOUT)
+	next := today.AddDate(0, 0, 1).Format(reservation.REPORT_DAY_LAYOUT)
+
+	res := request(router, http.MethodGet, "/reports/reservations?group=date&from="+day+"&to="+next, nil)
+	var body struct {
+		Rows []reservation.ReportRow `json:"rows"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &body)
+	if res.Code != http.StatusOK || len(body.Rows) != 2 || body.Rows[0].Day != day || body.Rows[1].Day != next || body.Rows[1].Seats != 2 {
+		t.Fatalf("expected the Brazil screening on %s and Alien on %s, got %d: %s", day, next, res.Code, res.Body)
+	}
+}
+
+func TestReservationReportCsv(t *testing.T) {
+	router := newReportRouter(time.UTC)
+
+	req := httptest.NewRequest(http.MethodGet, "/reports/reservations?to="+time.Now().UTC().Format(reservation.REPORT_DAY_LAYOUT), nil)
+	req.Header.Set("Accept", "text/csv")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	if res.Code != http.StatusOK || len(lines) != 3 {
+		t.Fatalf("expected a header and two rows, got %d: %s", res.Code, res.Body)
+	}
+
+	if lines[0] != "movie_id,title,seats,canceled,cancellation_rate,customers,revenue,refunded" || lines[1] != "1,Alien,2,1,0.3333,2,2000,1000" {
+		t.Fatalf("unexpected csv: %s", res.Body)
+	}
+
+	if !strings.Contains(res.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("expected an attachment, got %q", res.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestReservationReportRejectsInvalidQueries(t *testing.T) {
+	router := newReportRouter(time.UTC)
+
+	for _, query := range []string{
+		"group=hall",
+		"from=yesterday",
+		"from=2024-02-01&to=2024-01-01",
+		"from=2020-01-01&to=2024-01-01",
+		"format=xml",
+		"movie=abc",
+	} {
+		res := request(router, http.MethodGet, "/reports/reservations?"+query, nil)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, res.Code)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package users
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryRepository keeps users in memory. It is meant for tests and local
+// experiments, not for production.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	users  map[int]User
+	roles  map[string]Role
+	nextId int
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	roles := make(map[string]Role)
+	for _, role := range DefaultRoles() {
+		roles[role.Name] = role
+	}
+
+	return &MemoryRepository{users: make(map[int]User), roles: roles, nextId: 1}
+}
+
+func (r *MemoryRepository) FindById(id int) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (r *MemoryRepository) findByEmail(email string) (*User, bool) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *MemoryRepository) FindByEmail(email string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.findByEmail(email)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (r *MemoryRepository) List() ([]User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := []User{}
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (r *MemoryRepository) Create(user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, taken := r.findByEmail(user.Email); taken {
+		return ErrEmailTaken
+	}
+
+	if user.Role == "" {
+		user.Role = DEFAULT_ROLE
+	}
+	user.ID = r.nextId
+	r.nextId++
+	r.users[user.ID] = *user
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateProfile(id int, name string, birthdate string, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	if other, taken := r.findByEmail(email); taken && other.ID != id {
+		return ErrEmailTaken
+	}
+
+	user.Name = name
+	user.Birthdate = birthdate
+	user.Email = email
+	r.users[id] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdatePassword(id int, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.Password = passwordHash
+	r.users[id] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) FindRole(name string) (*Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role, ok := r.roles[name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+
+	return &role, nil
+}
+
+func (r *MemoryRepository) ListRoles() ([]Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	roles := []Role{}
+	for _, role := range r.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+
+	return roles, nil
+}
+
+func (r *MemoryRepository) SetRole(id int, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.roles[role]; !ok {
+		return ErrRoleNotFound
+	}
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.Role = role
+	r.users[id] = user
+
+	return nil
+}
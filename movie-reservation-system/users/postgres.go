@@ -0,0 +1,201 @@
+package users
+
+import (
+	"database/sql"
+	"movie-reservation-system/database"
+
+	"github.com/lib/pq"
+)
+
+const userColumns = "id, name, birthdate, email, password, role"
+
+type PostgresRepository struct {
+	db *database.DB
+}
+
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "unique_violation"
+}
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Name, &user.Birthdate, &user.Email, &user.Password, &user.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *PostgresRepository) FindById(id int) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+func (r *PostgresRepository) FindByEmail(email string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE LOWER(email) = LOWER($1)", email))
+}
+
+func (r *PostgresRepository) List() ([]User, error) {
+	rows, err := r.db.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *PostgresRepository) Create(user *User) error {
+	if user.Role == "" {
+		user.Role = DEFAULT_ROLE
+	}
+	err := r.db.QueryRow(`
+		INSERT INTO users (name, birthdate, email, password, role)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, user.Name, user.Birthdate, user.Email, user.Password, user.Role).Scan(&user.ID)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+
+	return err
+}
+
+func (r *PostgresRepository) UpdateProfile(id int, name string, birthdate string, email string) error {
+	res, err := r.db.Exec(`
+		UPDATE users SET name = $2, birthdate = $3, email = $4 WHERE id = $1
+	`, id, name, birthdate, email)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) UpdatePassword(id int, passwordHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET password = $2 WHERE id = $1", id, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func isForeignKeyViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "foreign_key_violation"
+}
+
+func (r *PostgresRepository) FindRole(name string) (*Role, error) {
+	role := Role{Permissions: []string{}}
+	err := r.db.QueryRow(`
+		SELECT r.name, r.description, COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		WHERE r.name = $1
+		GROUP BY r.name, r.description
+	`, name).Scan(&role.Name, &role.Description, pq.Array(&role.Permissions))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (r *PostgresRepository) ListRoles() ([]Role, error) {
+	rows, err := r.db.Query(`
+		SELECT r.name, r.description, COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		GROUP BY r.name, r.description
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		role := Role{Permissions: []string{}}
+		if err := rows.Scan(&role.Name, &role.Description, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *PostgresRepository) SetRole(id int, role string) error {
+	res, err := r.db.Exec("UPDATE users SET role = $2 WHERE id = $1", id, role)
+	if isForeignKeyViolation(err) {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
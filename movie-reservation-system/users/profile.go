@@ -0,0 +1,206 @@
+package users
+
+import (
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/hashing"
+	"movie-reservation-system/ratelimit"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	users UserRepository
+	// lockout is shared with the login, so wrong passwords count the same
+	// wherever they are tried.
+	lockout *ratelimit.Lockout
+}
+
+func NewHandler(users UserRepository, lockout *ratelimit.Lockout) *Handler {
+	return &Handler{users: users, lockout: lockout}
+}
+
+// currentUser loads the authenticated user. On failure the response has
+// already been written.
+func (h *Handler) currentUser(c *gin.Context) (*User, bool) {
+	user, err := h.users.FindById(ExtractUserIdFromClaims(c))
+	if err == ErrUserNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return nil, false
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+type Profile struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Birthdate string `json:"birthdate"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+}
+
+type ProfileBody struct {
+	Name      string `json:"name" form:"name"`
+	Birthdate string `json:"birthdate" form:"birthdate"`
+	Email     string `json:"email" form:"email"`
+}
+
+type ChangePasswordBody struct {
+	OldPassword string `json:"old_password" form:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" form:"new_password" binding:"required"`
+}
+
+func (u *User) Profile() Profile {
+	birthdate := u.Birthdate
+	// Dates come back from Postgres as full timestamps.
+	if len(birthdate) > len(BIRTHDATE_LAYOUT) {
+		birthdate = birthdate[:len(BIRTHDATE_LAYOUT)]
+	}
+
+	return Profile{
+		ID:        u.ID,
+		Name:      u.Name,
+		Birthdate: birthdate,
+		Email:     u.Email,
+		Role:      u.Role,
+	}
+}
+
+// ValidateProfile normalizes the body in place and checks every field. The
+// error lists every invalid field.
+func ValidateProfile(body *ProfileBody) error {
+	body.Name = strings.TrimSpace(body.Name)
+	body.Email = NormalizeEmail(body.Email)
+	body.Birthdate = strings.TrimSpace(body.Birthdate)
+
+	fields := make(map[string]string)
+	if body.Name == "" {
+		fields["name"] = "is required"
+	}
+
+	if body.Email == "" {
+		fields["email"] = "is required"
+	} else if err := ValidateEmail(body.Email); err != nil {
+		fields["email"] = err.Error()
+	}
+
+	if body.Birthdate == "" {
+		fields["birthdate"] = "is required"
+	} else if err := ValidateBirthdate(body.Birthdate); err != nil {
+		fields["birthdate"] = err.Error()
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	return nil
+}
+
+func (h *Handler) GetProfile(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user.Profile())
+}
+
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	var body ProfileBody
+	if err := apierror.Bind(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if err := ValidateProfile(&body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	err := h.users.UpdateProfile(ExtractUserIdFromClaims(c), body.Name, body.Birthdate, body.Email)
+	if err == ErrEmailTaken {
+		apierror.Abort(c, apierror.Conflict(err.Error()))
+		return
+	}
+	if err == ErrUserNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user.Profile())
+}
+
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var body ChangePasswordBody
+	if err := apierror.Bind(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	email := NormalizeEmail(user.Email)
+	locked, err := h.lockout.Locked(email)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	if locked > 0 {
+		ratelimit.Abort(c, "too many failed attempts, try again later", locked)
+		return
+	}
+
+	if !hashing.ComparePasswords(user.Password, body.OldPassword) {
+		if _, err := h.lockout.Fail(email); err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CODE_UNAUTHORIZED, "invalid credentials"))
+		return
+	}
+
+	if err := h.lockout.Succeed(email); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if err := ValidatePassword(body.NewPassword); err != nil {
+		apierror.Abort(c, apierror.InvalidField("new_password", err.Error()))
+		return
+	}
+
+	if body.NewPassword == body.OldPassword {
+		apierror.Abort(c, apierror.InvalidField("new_password", "must be different from the old one"))
+		return
+	}
+
+	hash, err := hashing.HashPassword(body.NewPassword)
+	if err == nil {
+		err = h.users.UpdatePassword(user.ID, hash)
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+}
@@ -0,0 +1,167 @@
+package users
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"movie-reservation-system/apierror"
+	"movie-reservation-system/hashing"
+	"movie-reservation-system/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// TEST_LOCKOUT_THRESHOLD wrong passwords lock the account for a minute.
+const TEST_LOCKOUT_THRESHOLD = 3
+
+func newTestLockout() *ratelimit.Lockout {
+	return ratelimit.NewLockout(ratelimit.NewMemoryStore(), "password-failures:", TEST_LOCKOUT_THRESHOLD, time.Minute, time.Minute, time.Hour)
+}
+
+func newTestRouter(repo UserRepository, userId int) *gin.Engine {
+	handler := NewHandler(repo, newTestLockout())
+	router := gin.New()
+	router.Use(apierror.Middleware())
+	router.Use(func(c *gin.Context) {
+		c.Set("user", jwt.MapClaims{"_id": fmt.Sprint(userId), "role": DEFAULT_ROLE})
+		c.Next()
+	})
+	router.GET("/user/me", handler.GetProfile)
+	router.PUT("/user/me", handler.UpdateProfile)
+	router.PUT("/user/me/password", handler.ChangePassword)
+	return router
+}
+
+func newTestUser(t *testing.T, repo *MemoryRepository, email string, password string) *User {
+	hash, err := hashing.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{Name: "Ripley", Birthdate: "1979-05-25", Email: email, Password: hash}
+	if err := repo.Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func request(router *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestGetProfile(t *testing.T) {
+	repo := NewMemoryRepository()
+	user := newTestUser(t, repo, "ripley@example.com", "nostromo1")
+
+	res := request(newTestRouter(repo, user.ID), http.MethodGet, "/user/me", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var profile Profile
+	json.Unmarshal(res.Body.Bytes(), &profile)
+	expected := Profile{ID: user.ID, Name: "Ripley", Birthdate: "1979-05-25", Email: "ripley@example.com", Role: DEFAULT_ROLE}
+	if profile != expected {
+		t.Fatalf("expected %+v, got %+v", expected, profile)
+	}
+
+	if bytes.Contains(res.Body.Bytes(), []byte(user.Password)) {
+		t.Fatal("profile must not expose the password hash")
+	}
+
+	res = request(newTestRouter(repo, user.ID+1), http.MethodGet, "/user/me", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown user, got %d", res.Code)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	repo := NewMemoryRepository()
+	user := newTestUser(t, repo, "ripley@example.com", "nostromo1")
+	newTestUser(t, repo, "dallas@example.com", "nostromo1")
+	router := newTestRouter(repo, user.ID)
+
+	res := request(router, http.MethodPut, "/user/me", ProfileBody{Name: "Ellen Ripley", Birthdate: "1979-05-25", Email: " Ellen@Example.com "})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	updated, _ := repo.FindById(user.ID)
+	if updated.Name != "Ellen Ripley" || updated.Email != "ellen@example.com" {
+		t.Fatalf("profile was not updated: %+v", updated)
+	}
+
+	res = request(router, http.MethodPut, "/user/me", ProfileBody{Name: "Ellen Ripley", Birthdate: "1979-05-25", Email: "DALLAS@example.com"})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken email, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPut, "/user/me", ProfileBody{Name: "Ellen Ripley", Birthdate: "25/05/1979", Email: "ellen@example.com"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid birthdate, got %d", res.Code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	repo := NewMemoryRepository()
+	user := newTestUser(t, repo, "ripley@example.com", "nostromo1")
+	router := newTestRouter(repo, user.ID)
+
+	res := request(router, http.MethodPut, "/user/me/password", ChangePasswordBody{OldPassword: "wrong-password", NewPassword: "sulaco123"})
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPut, "/user/me/password", ChangePasswordBody{OldPassword: "nostromo1", NewPassword: "short"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a short password, got %d", res.Code)
+	}
+
+	res = request(router, http.MethodPut, "/user/me/password", ChangePasswordBody{OldPassword: "nostromo1", NewPassword: "sulaco123"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	updated, _ := repo.FindById(user.ID)
+	if !hashing.ComparePasswords(updated.Password, "sulaco123") {
+		t.Fatal("password was not updated")
+	}
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+	repo := NewMemoryRepository()
+	user := newTestUser(t, repo, "ripley@example.com", "nostromo1")
+	router := newTestRouter(repo, user.ID)
+
+	for i := 0; i < TEST_LOCKOUT_THRESHOLD; i++ {
+		res := request(router, http.MethodPut, "/user/me/password", ChangePasswordBody{OldPassword: "wrong-password", NewPassword: "sulaco123"})
+		if res.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, res.Code)
+		}
+	}
+
+	res := request(router, http.MethodPut, "/user/me/password", ChangePasswordBody{OldPassword: "nostromo1", NewPassword: "sulaco123"})
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a locked account even with the right password, got %d", res.Code)
+	}
+
+	updated, _ := repo.FindById(user.ID)
+	if !hashing.ComparePasswords(updated.Password, "nostromo1") {
+		t.Fatal("expected the password to be unchanged")
+	}
+}
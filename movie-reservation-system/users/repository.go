@@ -0,0 +1,23 @@
+package users
+
+// UserRepository is the storage behind the user handlers, the auth handlers
+// and the user middlewares.
+type UserRepository interface {
+	// FindById and FindByEmail return ErrUserNotFound when there is no match.
+	// Emails are matched case-insensitively.
+	FindById(id int) (*User, error)
+	FindByEmail(email string) (*User, error)
+	List() ([]User, error)
+	// Create stores a new user with the default role and sets its ID. It
+	// returns ErrEmailTaken if the email is already registered.
+	Create(user *User) error
+	UpdateProfile(id int, name string, birthdate string, email string) error
+	// UpdatePassword stores the new hash and revokes every refresh token of
+	// the user.
+	UpdatePassword(id int, passwordHash string) error
+	// FindRole returns ErrRoleNotFound for roles that were never declared.
+	FindRole(name string) (*Role, error)
+	ListRoles() ([]Role, error)
+	// SetRole returns ErrUserNotFound or ErrRoleNotFound.
+	SetRole(id int, role string) error
+}
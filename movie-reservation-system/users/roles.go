@@ -0,0 +1,140 @@
+package users
+
+import (
+	"errors"
+	"movie-reservation-system/apierror"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permissions checked by the routes. Which roles grant them is stored in the
+// database.
+const (
+	PERMISSION_MOVIES_WRITE        = "movies:write"
+	PERMISSION_SHOWTIMES_WRITE     = "showtimes:write"
+	PERMISSION_RESERVATIONS_READ   = "reservations:read"
+	PERMISSION_RESERVATIONS_REFUND = "reservations:refund"
+	PERMISSION_REPORTS_READ        = "reports:read"
+	PERMISSION_USERS_MANAGE        = "users:manage"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// Can reports whether the role grants permission.
+func (r *Role) Can(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DefaultRoles mirrors the roles seeded by the migrations.
+func DefaultRoles() []Role {
+	return []Role{
+		{Name: "admin", Description: "Everything", Permissions: []string{
+			PERMISSION_MOVIES_WRITE,
+			PERMISSION_SHOWTIMES_WRITE,
+			PERMISSION_RESERVATIONS_READ,
+			PERMISSION_RESERVATIONS_REFUND,
+			PERMISSION_REPORTS_READ,
+			PERMISSION_USERS_MANAGE,
+		}},
+		{Name: "manager", Description: "Runs the catalog and the schedule", Permissions: []string{
+			PERMISSION_MOVIES_WRITE,
+			PERMISSION_SHOWTIMES_WRITE,
+			PERMISSION_RESERVATIONS_READ,
+			PERMISSION_REPORTS_READ,
+		}},
+		{Name: "support", Description: "Helps customers with their bookings", Permissions: []string{
+			PERMISSION_RESERVATIONS_READ,
+			PERMISSION_RESERVATIONS_REFUND,
+		}},
+		{Name: DEFAULT_ROLE, Description: "Customer", Permissions: []string{}},
+	}
+}
+
+type UserSummary struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type RoleBody struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (h *Handler) GetRoles(c *gin.Context) {
+	roles, err := h.users.ListRoles()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (h *Handler) GetUsers(c *gin.Context) {
+	list, err := h.users.List()
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	summaries := []UserSummary{}
+	for _, user := range list {
+		summaries = append(summaries, UserSummary{ID: user.ID, Name: user.Name, Email: user.Email, Role: user.Role})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": summaries})
+}
+
+// SetUserRole assigns the role in the body to the user in the URL. Callers
+// cannot change their own role so the last administrator cannot lock
+// everyone out by accident.
+func (h *Handler) SetUserRole(c *gin.Context) {
+	userId, err := apierror.IDParam(c, "id", "user")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	var body RoleBody
+	if err := apierror.BindJSON(c, &body); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if userId == ExtractUserIdFromClaims(c) {
+		apierror.Abort(c, apierror.Forbidden("cannot change your own role"))
+		return
+	}
+
+	role := strings.TrimSpace(body.Role)
+	err = h.users.SetRole(userId, role)
+	if err == ErrRoleNotFound {
+		apierror.Abort(c, apierror.InvalidField("role", "unknown role"))
+		return
+	}
+	if err == ErrUserNotFound {
+		apierror.Abort(c, apierror.NotFound(err.Error()))
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role updated", "id": userId, "role": role})
+}
@@ -0,0 +1,67 @@
+package users
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRolesRouter(repo UserRepository, userId int) *gin.Engine {
+	handler := NewHandler(repo, newTestLockout())
+	router := newTestRouter(repo, userId)
+	router.GET("/roles", handler.GetRoles)
+	router.PUT("/users/:id/role", handler.SetUserRole)
+	return router
+}
+
+func TestSetUserRole(t *testing.T) {
+	repo := NewMemoryRepository()
+	admin := newTestUser(t, repo, "admin@example.com", "nostromo1")
+	repo.SetRole(admin.ID, "admin")
+	user := newTestUser(t, repo, "ripley@example.com", "nostromo1")
+	router := newRolesRouter(repo, admin.ID)
+
+	res := request(router, http.MethodPut, "/users/2/role", RoleBody{Role: "support"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	updated, _ := repo.FindById(user.ID)
+	if updated.Role != "support" {
+		t.Fatalf("expected the support role, got %s", updated.Role)
+	}
+
+	cases := []struct {
+		path     string
+		role     string
+		expected int
+	}{
+		{"/users/2/role", "janitor", http.StatusBadRequest},
+		{"/users/2/role", "", http.StatusBadRequest},
+		{"/users/9/role", "support", http.StatusNotFound},
+		{"/users/1/role", "user", http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		res := request(router, http.MethodPut, tc.path, RoleBody{Role: tc.role})
+		if res.Code != tc.expected {
+			t.Errorf("%s to %q: expected %d, got %d", tc.path, tc.role, tc.expected, res.Code)
+		}
+	}
+}
+
+func TestGetRoles(t *testing.T) {
+	repo := NewMemoryRepository()
+	router := newRolesRouter(repo, 1)
+
+	res := request(router, http.MethodGet, "/roles", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+
+	role, err := repo.FindRole("admin")
+	if err != nil || !role.Can(PERMISSION_USERS_MANAGE) {
+		t.Fatalf("expected admins to manage users, got %+v, %v", role, err)
+	}
+}
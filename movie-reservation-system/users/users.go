@@ -1,14 +1,30 @@
 package users
 
 import (
+	"errors"
 	"fmt"
-	"movie-reservation-system/database"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
+const (
+	DEFAULT_ROLE        = "user"
+	MIN_PASSWORD_LENGTH = 8
+	// bcrypt ignores everything past 72 bytes.
+	MAX_PASSWORD_LENGTH = 72
+	BIRTHDATE_LAYOUT    = "2006-01-02"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("email already registered")
+)
+
 type User struct {
 	ID        int
 	Name      string
@@ -24,54 +40,76 @@ func ExtractUserIdFromClaims(c *gin.Context) int {
 	return userIdInt
 }
 
-func ExtractRoleFromClaims(c *gin.Context) (error, string) {
-	userClaims := c.MustGet("user").(jwt.MapClaims)
-	if userClaims["role"] == nil {
-		return fmt.Errorf("Role not found"), ""
-	}
-	return nil, userClaims["role"].(string)
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
-func FindUserByEmail(email string) *User {
-	row := database.Db.QueryRow("SELECT * FROM users WHERE email = $1", email)
-	var user User
-	err := row.Scan(&user.ID, &user.Name, &user.Birthdate, &user.Email, &user.Password, &user.Role)
-	if err != nil {
-		return nil
+func ValidateEmail(email string) error {
+	at := strings.Index(email, "@")
+	if at < 1 || at != strings.LastIndex(email, "@") || !strings.Contains(email[at:], ".") || strings.ContainsAny(email, " \t") {
+		return fmt.Errorf("invalid email")
 	}
 
-	return &user
+	return nil
 }
 
-func FindUserById(id int) *User {
-	row := database.Db.QueryRow("SELECT * FROM users WHERE id = $1", id)
-	var user User
-	err := row.Scan(&user.ID, &user.Name, &user.Birthdate, &user.Email, &user.Password, &user.Role)
-	if err != nil {
-		return nil
+// ValidatePassword enforces the password policy: 8 to 72 bytes with at least
+// one letter and one digit.
+func ValidatePassword(password string) error {
+	if len(password) < MIN_PASSWORD_LENGTH || len(password) > MAX_PASSWORD_LENGTH {
+		return fmt.Errorf("password must be between %d and %d characters", MIN_PASSWORD_LENGTH, MAX_PASSWORD_LENGTH)
+	}
+
+	hasLetter, hasDigit := false, false
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		}
+		if unicode.IsDigit(r) {
+			hasDigit = true
+		}
 	}
 
-	return &user
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("password must contain at least one letter and one digit")
+	}
+
+	return nil
 }
 
-func GetUsers() ([]User, error) {
-	rows, err := database.Db.Query("SELECT * FROM users")
-	if err != nil {
-		return nil, err
+// Age returns how old the user is at the given time, or -1 when the
+// birthdate cannot be parsed.
+func (u *User) Age(at time.Time) int {
+	birthdate := u.Birthdate
+	// Dates come back from Postgres as full timestamps.
+	if len(birthdate) > len(BIRTHDATE_LAYOUT) {
+		birthdate = birthdate[:len(BIRTHDATE_LAYOUT)]
 	}
 
-	defer rows.Close()
+	born, err := time.Parse(BIRTHDATE_LAYOUT, birthdate)
+	if err != nil || born.After(at) {
+		return -1
+	}
 
-	users := []User{}
-	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Name, &user.Birthdate, &user.Email, &user.Password, &user.Role)
-		if err != nil {
-			return nil, err
-		}
+	// Compare month and day rather than the day of the year, which shifts by
+	// one after February in leap years.
+	age := at.Year() - born.Year()
+	if at.Month() < born.Month() || (at.Month() == born.Month() && at.Day() < born.Day()) {
+		age--
+	}
+
+	return age
+}
+
+func ValidateBirthdate(birthdate string) error {
+	date, err := time.Parse(BIRTHDATE_LAYOUT, birthdate)
+	if err != nil {
+		return fmt.Errorf("birthdate must be formatted as YYYY-MM-DD")
+	}
 
-		users = append(users, user)
+	if !date.Before(time.Now()) {
+		return fmt.Errorf("birthdate must be in the past")
 	}
 
-	return users, nil
+	return nil
 }
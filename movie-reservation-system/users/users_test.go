@@ -0,0 +1,38 @@
+package users
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAge(t *testing.T) {
+	date := func(value string) time.Time {
+		at, _ := time.Parse(BIRTHDATE_LAYOUT, value)
+		return at
+	}
+
+	cases := []struct {
+		birthdate string
+		at        string
+		age       int
+	}{
+		{"2008-03-01", "2026-03-01", 18},
+		{"2008-03-01", "2026-02-28", 17},
+		{"2008-03-01", "2024-03-01", 16},
+		{"2008-03-01", "2024-02-29", 15},
+		{"2008-02-29", "2026-02-28", 17},
+		{"2008-02-29", "2026-03-01", 18},
+		{"2008-02-29", "2028-02-29", 20},
+		{"2007-12-31", "2026-12-31", 19},
+		{"1990-06-15T00:00:00Z", "2026-06-14", 35},
+		{"2030-01-01", "2026-01-01", -1},
+		{"not a date", "2026-01-01", -1},
+	}
+
+	for _, tc := range cases {
+		user := User{Birthdate: tc.birthdate}
+		if age := user.Age(date(tc.at)); age != tc.age {
+			t.Errorf("born %s, on %s: expected %d, got %d", tc.birthdate, tc.at, tc.age, age)
+		}
+	}
+}